@@ -0,0 +1,60 @@
+package chatstore
+
+import "slices"
+
+// Principal is the user a store view acts for, see AsUser
+type Principal struct {
+	// UserID is the ID of the user
+	UserID string
+	// Admin grants the user the admin role in every chat
+	Admin bool
+}
+
+// Policy decides whether a principal may perform an action, one of the
+// ACCESS_ACTION_* constants, given the roles (ACCESS_ROLE_* constants) the
+// principal holds in the chat, or on the message, the action is about.
+type Policy interface {
+	Allowed(principal Principal, action string, roles []string) bool
+}
+
+// PolicyFunc adapts a function to the Policy interface.
+type PolicyFunc func(principal Principal, action string, roles []string) bool
+
+// Allowed calls the function.
+func (f PolicyFunc) Allowed(principal Principal, action string, roles []string) bool {
+	return f(principal, action, roles)
+}
+
+// NewDefaultPolicy returns the default policy:
+//   - admins may do anything
+//   - owners and participants may read the chat and pin its messages
+//   - owners and participants may send messages as themselves
+//   - owners and senders may edit and delete the messages
+//   - owners may manage the chat
+//   - only admins may moderate and administer
+func NewDefaultPolicy() Policy {
+	return PolicyFunc(func(principal Principal, action string, roles []string) bool {
+		has := func(role string) bool {
+			return slices.Contains(roles, role)
+		}
+
+		if has(ACCESS_ROLE_ADMIN) {
+			return true
+		}
+
+		member := has(ACCESS_ROLE_OWNER) || has(ACCESS_ROLE_PARTICIPANT)
+
+		switch action {
+		case ACCESS_ACTION_READ, ACCESS_ACTION_PIN:
+			return member
+		case ACCESS_ACTION_SEND:
+			return member && has(ACCESS_ROLE_SENDER)
+		case ACCESS_ACTION_EDIT:
+			return has(ACCESS_ROLE_OWNER) || has(ACCESS_ROLE_SENDER)
+		case ACCESS_ACTION_MANAGE:
+			return has(ACCESS_ROLE_OWNER)
+		}
+
+		return false
+	})
+}
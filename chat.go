@@ -3,6 +3,9 @@ package chatstore
 import (
 	"encoding/json"
 	"maps"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/dracory/neat/database/orm"
 	"github.com/dracory/neat/database/soft_delete"
@@ -29,6 +32,9 @@ type ChatInterface interface {
 	Memo() string
 	SetMemo(memo string) ChatInterface
 
+	DirectKey() string
+	SetDirectKey(directKey string) ChatInterface
+
 	Meta(key string) (string, error)
 	SetMeta(key string, value string) error
 
@@ -36,6 +42,13 @@ type ChatInterface interface {
 	SetMetas(metas map[string]string) error
 	UpsertMetas(metas map[string]string) error
 
+	MetaBool(key string) (bool, error)
+	MetaFloat(key string) (float64, error)
+	MetaInt(key string) (int64, error)
+	MetaJSON(key string, dest any) error
+	MetaTime(key string) (time.Time, error)
+	SetMetaValue(key string, value any) error
+
 	CreatedAt() string
 	CreatedAtCarbon() *carbon.Carbon
 	SetCreatedAt(createdAt string) ChatInterface
@@ -48,7 +61,26 @@ type ChatInterface interface {
 	UpdatedAtCarbon() *carbon.Carbon
 	SetUpdatedAt(updatedAt string) ChatInterface
 
+	Version() int64
+	SetVersion(version int64) ChatInterface
+
+	LastMessageAt() string
+	LastMessageAtCarbon() *carbon.Carbon
+	SetLastMessageAt(lastMessageAt string) ChatInterface
+
+	MessageCount() int64
+	SetMessageCount(messageCount int64) ChatInterface
+
+	TenantID() string
+	SetTenantID(tenantID string) ChatInterface
+
+	IsDirty() bool
+	DirtyFields() []string
 	MarkAsNotDirty()
+
+	// Validate returns ValidationErrors with all the fields which are
+	// missing or longer than their columns, nil when the chat is valid
+	Validate() error
 }
 
 var _ ChatInterface = (*chatImplementation)(nil)
@@ -63,10 +95,22 @@ type chatImplementation struct {
 	OwnerIDField   string `db:"owner_id"`
 	TitleField     string `db:"title"`
 	MemoField      string `db:"memo"`
+	DirectKeyField string `db:"direct_key"`
 	MetasField     string `db:"metas"`
+	VersionField   int64  `db:"version"`
 	CreatedAtField orm.CreatedAt
 	UpdatedAtField orm.UpdatedAt
 	soft_delete.SoftDeletesMaxDate
+
+	// Activity fields maintained by the store as messages are added and removed
+	LastMessageAtField time.Time `db:"last_message_at"`
+	MessageCountField  int64     `db:"message_count"`
+
+	// TenantIDField is set by the store from the tenant view the chat is created in
+	TenantIDField string `db:"tenant_id"`
+
+	// dirty holds the columns changed since the chat was last persisted
+	dirty map[string]bool
 }
 
 // == CONSTRUCTORS ============================================================
@@ -93,6 +137,7 @@ func NewChatFromExistingData(data map[string]string) ChatInterface {
 	o.SetOwnerID(data[COLUMN_OWNER_ID])
 	o.SetTitle(data[COLUMN_TITLE])
 	o.SetMemo(data[COLUMN_MEMO])
+	o.SetDirectKey(data[COLUMN_DIRECT_KEY])
 	o.MetasField = data[COLUMN_METAS]
 	if v, ok := data[COLUMN_CREATED_AT]; ok {
 		o.SetCreatedAt(v)
@@ -103,11 +148,38 @@ func NewChatFromExistingData(data map[string]string) ChatInterface {
 	if v, ok := data[COLUMN_SOFT_DELETED_AT]; ok {
 		o.SetSoftDeletedAt(v)
 	}
+	if v, ok := data[COLUMN_VERSION]; ok {
+		version, _ := strconv.ParseInt(v, 10, 64)
+		o.SetVersion(version)
+	}
+	if v, ok := data[COLUMN_LAST_MESSAGE_AT]; ok {
+		o.SetLastMessageAt(v)
+	}
+	if v, ok := data[COLUMN_MESSAGE_COUNT]; ok {
+		messageCount, _ := strconv.ParseInt(v, 10, 64)
+		o.SetMessageCount(messageCount)
+	}
+	o.SetTenantID(data[COLUMN_TENANT_ID])
+	o.MarkAsNotDirty()
 	return o
 }
 
 // == METHODS =================================================================
 
+// Validate checks the required fields and the column lengths of the chat.
+func (o *chatImplementation) Validate() error {
+	errs := ValidationErrors{}
+	errs.fieldRequired(COLUMN_ID, o.ID())
+	errs.fieldMaxLength(COLUMN_ID, o.ID(), MAX_LENGTH_ID)
+	errs.fieldRequired(COLUMN_STATUS, o.Status())
+	errs.fieldMaxLength(COLUMN_STATUS, o.Status(), MAX_LENGTH_STATUS)
+	errs.fieldMaxLength(COLUMN_OWNER_ID, o.OwnerID(), MAX_LENGTH_USER_ID)
+	errs.fieldMaxLength(COLUMN_TITLE, o.Title(), MAX_LENGTH_TITLE)
+	errs.fieldMaxLength(COLUMN_DIRECT_KEY, o.DirectKey(), MAX_LENGTH_KEY)
+	errs.fieldMaxLength(COLUMN_TENANT_ID, o.TenantID(), MAX_LENGTH_TENANT_ID)
+	return errs.errorOrNil()
+}
+
 // == SETTERS AND GETTERS =====================================================
 
 // ID returns the id of the chat.
@@ -117,6 +189,9 @@ func (o *chatImplementation) ID() string {
 
 // SetID sets the id of the chat.
 func (o *chatImplementation) SetID(id string) ChatInterface {
+	if o.ShortID.ID != id {
+		o.markDirty(COLUMN_ID)
+	}
 	o.ShortID.ID = id
 	return o
 }
@@ -128,6 +203,9 @@ func (o *chatImplementation) OwnerID() string {
 
 // SetOwnerID sets the owner id of the chat.
 func (o *chatImplementation) SetOwnerID(id string) ChatInterface {
+	if o.OwnerIDField != id {
+		o.markDirty(COLUMN_OWNER_ID)
+	}
 	o.OwnerIDField = id
 	return o
 }
@@ -139,6 +217,9 @@ func (o *chatImplementation) Status() string {
 
 // SetStatus sets the status of the chat.
 func (o *chatImplementation) SetStatus(status string) ChatInterface {
+	if o.StatusField != status {
+		o.markDirty(COLUMN_STATUS)
+	}
 	o.StatusField = status
 	return o
 }
@@ -150,10 +231,28 @@ func (o *chatImplementation) Title() string {
 
 // SetTitle sets the title of the chat.
 func (o *chatImplementation) SetTitle(title string) ChatInterface {
+	if o.TitleField != title {
+		o.markDirty(COLUMN_TITLE)
+	}
 	o.TitleField = title
 	return o
 }
 
+// DirectKey returns the canonical participant key of a one-to-one chat,
+// empty for other chats (see DirectChatKey).
+func (o *chatImplementation) DirectKey() string {
+	return o.DirectKeyField
+}
+
+// SetDirectKey sets the canonical participant key of a one-to-one chat.
+func (o *chatImplementation) SetDirectKey(directKey string) ChatInterface {
+	if o.DirectKeyField != directKey {
+		o.markDirty(COLUMN_DIRECT_KEY)
+	}
+	o.DirectKeyField = directKey
+	return o
+}
+
 // Memo returns the memo of the chat.
 func (o *chatImplementation) Memo() string {
 	return o.MemoField
@@ -161,6 +260,9 @@ func (o *chatImplementation) Memo() string {
 
 // SetMemo sets the memo of the chat.
 func (o *chatImplementation) SetMemo(memo string) ChatInterface {
+	if o.MemoField != memo {
+		o.markDirty(COLUMN_MEMO)
+	}
 	o.MemoField = memo
 	return o
 }
@@ -181,18 +283,14 @@ func (o *chatImplementation) SetMeta(key string, value string) error {
 	})
 }
 
-// Metas returns the metas map of the chat.
+// Metas returns the metas map of the chat. Values which are not strings
+// (e.g. set with SetMetaValue) are returned as their JSON text.
 func (o *chatImplementation) Metas() (map[string]string, error) {
-	metasStr := o.MetasField
-	if metasStr == "" {
-		metasStr = "{}"
-	}
-	var metasJson map[string]string
-	errJson := json.Unmarshal([]byte(metasStr), &metasJson)
-	if errJson != nil {
-		return map[string]string{}, errJson
+	metas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return map[string]string{}, err
 	}
-	return metasJson, nil
+	return metasToStrings(metas), nil
 }
 
 // SetMetas sets the metas map of the chat.
@@ -201,18 +299,115 @@ func (o *chatImplementation) SetMetas(metas map[string]string) error {
 	if err != nil {
 		return err
 	}
-	o.MetasField = string(mapString)
+	o.setMetasField(string(mapString))
 	return nil
 }
 
 // UpsertMetas merges the given metas into the existing metas.
 func (o *chatImplementation) UpsertMetas(metas map[string]string) error {
-	currentMetas, err := o.Metas()
+	currentMetas, err := metasDecode(o.MetasField)
 	if err != nil {
 		return err
 	}
-	maps.Copy(currentMetas, metas)
-	return o.SetMetas(currentMetas)
+	for key, value := range metas {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		currentMetas[key] = raw
+	}
+	return o.setMetasRaw(currentMetas)
+}
+
+// MetaBool returns a meta value by key as a boolean, or false if not set.
+func (o *chatImplementation) MetaBool(key string) (bool, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return false, err
+	}
+	return metaRawBool(key, raw)
+}
+
+// MetaFloat returns a meta value by key as a float, or 0 if not set.
+func (o *chatImplementation) MetaFloat(key string) (float64, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return 0, err
+	}
+	return metaRawFloat(key, raw)
+}
+
+// MetaInt returns a meta value by key as an integer, or 0 if not set.
+func (o *chatImplementation) MetaInt(key string) (int64, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return 0, err
+	}
+	return metaRawInt(key, raw)
+}
+
+// MetaJSON unmarshals a meta value by key into dest, leaving dest untouched if not set.
+func (o *chatImplementation) MetaJSON(key string, dest any) error {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return err
+	}
+	return metaRawJSON(key, raw, dest)
+}
+
+// MetaTime returns a meta value by key as a time, or the zero time if not set.
+func (o *chatImplementation) MetaTime(key string) (time.Time, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return time.Time{}, err
+	}
+	return metaRawTime(key, raw)
+}
+
+// SetMetaValue sets a single meta key to any JSON encodable value
+// (e.g. numbers, booleans, times, slices, maps or structs).
+func (o *chatImplementation) SetMetaValue(key string, value any) error {
+	raw, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	metas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return err
+	}
+	metas[key] = raw
+	return o.setMetasRaw(metas)
+}
+
+// metaRaw returns the raw JSON value of the meta key, or nil if not set.
+func (o *chatImplementation) metaRaw(key string) (json.RawMessage, error) {
+	metas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := metas[key]
+	if !ok || string(raw) == "null" {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// setMetasRaw sets the metas of the chat from their raw JSON values.
+func (o *chatImplementation) setMetasRaw(metas map[string]json.RawMessage) error {
+	metasJSON, err := metasEncode(metas)
+	if err != nil {
+		return err
+	}
+	o.setMetasField(metasJSON)
+	return nil
+}
+
+// setMetasField sets the metas JSON of the chat, marking it dirty if changed.
+func (o *chatImplementation) setMetasField(metasJSON string) {
+	if o.MetasField != metasJSON {
+		o.markDirty(COLUMN_METAS)
+	}
+	o.MetasField = metasJSON
 }
 
 // CreatedAt returns the created at time of the chat.
@@ -233,7 +428,11 @@ func (o *chatImplementation) SetCreatedAt(createdAt string) ChatInterface {
 	if createdAt == "" {
 		return o
 	}
-	o.CreatedAtField.CreatedAt = carbon.Parse(createdAt, carbon.UTC).StdTime()
+	value := carbon.Parse(createdAt, carbon.UTC).StdTime()
+	if !o.CreatedAtField.CreatedAt.Equal(value) {
+		o.markDirty(COLUMN_CREATED_AT)
+	}
+	o.CreatedAtField.CreatedAt = value
 	return o
 }
 
@@ -255,10 +454,27 @@ func (o *chatImplementation) SetSoftDeletedAt(softDeletedAt string) ChatInterfac
 	if softDeletedAt == "" {
 		return o
 	}
-	o.SoftDeletesMaxDate.SoftDeletedAt = carbon.Parse(softDeletedAt, carbon.UTC).StdTime()
+	value := carbon.Parse(softDeletedAt, carbon.UTC).StdTime()
+	if !o.SoftDeletesMaxDate.SoftDeletedAt.Equal(value) {
+		o.markDirty(COLUMN_SOFT_DELETED_AT)
+	}
+	o.SoftDeletesMaxDate.SoftDeletedAt = value
 	return o
 }
 
+// SoftDeletedCondition returns the condition matching the soft deleted
+// chats, used by neat. The soft delete times are stored in UTC, so they
+// are compared with the current time in UTC, whatever the local time zone.
+func (o *chatImplementation) SoftDeletedCondition(quoteIdentifier func(string) string) (string, []any) {
+	return quoteIdentifier(COLUMN_SOFT_DELETED_AT) + " <= ?", []any{time.Now().UTC()}
+}
+
+// NotSoftDeletedCondition returns the condition matching the chats not
+// soft deleted, used by neat, comparing in UTC as SoftDeletedCondition.
+func (o *chatImplementation) NotSoftDeletedCondition(quoteIdentifier func(string) string) (string, []any) {
+	return quoteIdentifier(COLUMN_SOFT_DELETED_AT) + " > ?", []any{time.Now().UTC()}
+}
+
 // UpdatedAt returns the updated at time of the chat.
 func (o *chatImplementation) UpdatedAt() string {
 	if o.UpdatedAtField.UpdatedAt.IsZero() {
@@ -277,10 +493,94 @@ func (o *chatImplementation) SetUpdatedAt(updatedAt string) ChatInterface {
 	if updatedAt == "" {
 		return o
 	}
-	o.UpdatedAtField.UpdatedAt = carbon.Parse(updatedAt, carbon.UTC).StdTime()
+	value := carbon.Parse(updatedAt, carbon.UTC).StdTime()
+	if !o.UpdatedAtField.UpdatedAt.Equal(value) {
+		o.markDirty(COLUMN_UPDATED_AT)
+	}
+	o.UpdatedAtField.UpdatedAt = value
 	return o
 }
 
-// MarkAsNotDirty is a no-op for backward compatibility.
+// Version returns the optimistic locking version of the chat.
+func (o *chatImplementation) Version() int64 {
+	return o.VersionField
+}
+
+// SetVersion sets the optimistic locking version of the chat.
+func (o *chatImplementation) SetVersion(version int64) ChatInterface {
+	o.VersionField = version
+	return o
+}
+
+// LastMessageAt returns the time of the latest message of the chat,
+// empty when the chat has no messages.
+func (o *chatImplementation) LastMessageAt() string {
+	if o.LastMessageAtField.IsZero() {
+		return ""
+	}
+	return carbon.CreateFromStdTime(o.LastMessageAtField).ToDateTimeString()
+}
+
+// LastMessageAtCarbon returns the time of the latest message of the chat as a carbon object.
+func (o *chatImplementation) LastMessageAtCarbon() *carbon.Carbon {
+	return carbon.CreateFromStdTime(o.LastMessageAtField)
+}
+
+// SetLastMessageAt sets the time of the latest message of the chat.
+// The column is maintained by the store, so the chat is not marked dirty.
+func (o *chatImplementation) SetLastMessageAt(lastMessageAt string) ChatInterface {
+	if lastMessageAt == "" {
+		o.LastMessageAtField = time.Time{}
+		return o
+	}
+	o.LastMessageAtField = carbon.Parse(lastMessageAt, carbon.UTC).StdTime()
+	return o
+}
+
+// MessageCount returns the number of (not soft deleted) messages of the chat.
+func (o *chatImplementation) MessageCount() int64 {
+	return o.MessageCountField
+}
+
+// SetMessageCount sets the number of messages of the chat.
+// The column is maintained by the store, so the chat is not marked dirty.
+func (o *chatImplementation) SetMessageCount(messageCount int64) ChatInterface {
+	o.MessageCountField = messageCount
+	return o
+}
+
+// TenantID returns the ID of the tenant of the chat, empty when the chat
+// was created outside of a tenant view.
+func (o *chatImplementation) TenantID() string {
+	return o.TenantIDField
+}
+
+// SetTenantID sets the ID of the tenant of the chat.
+// The column is maintained by the store, so the chat is not marked dirty.
+func (o *chatImplementation) SetTenantID(tenantID string) ChatInterface {
+	o.TenantIDField = tenantID
+	return o
+}
+
+// IsDirty returns true if the chat has changes which are not yet persisted.
+func (o *chatImplementation) IsDirty() bool {
+	return len(o.dirty) > 0
+}
+
+// DirtyFields returns the sorted column names changed since the chat was last persisted.
+func (o *chatImplementation) DirtyFields() []string {
+	return slices.Sorted(maps.Keys(o.dirty))
+}
+
+// MarkAsNotDirty clears the changes, marking the chat as persisted.
 func (o *chatImplementation) MarkAsNotDirty() {
+	o.dirty = nil
+}
+
+// markDirty records the column as changed since the chat was last persisted.
+func (o *chatImplementation) markDirty(column string) {
+	if o.dirty == nil {
+		o.dirty = map[string]bool{}
+	}
+	o.dirty[column] = true
 }
@@ -0,0 +1,35 @@
+package chatstore
+
+import (
+	"slices"
+	"strings"
+)
+
+// directKeySeparators are the characters separating the tenant and the users
+// in a direct key, which the user and tenant IDs may not contain.
+const directKeySeparators = ":/"
+
+// DirectChatKey returns the canonical participant key of the one-to-one chat
+// between the two users, the same whatever the order of the users. The user
+// IDs may not contain a colon or a slash, or the keys could collide.
+func DirectChatKey(userA string, userB string) string {
+	if userB < userA {
+		userA, userB = userB, userA
+	}
+	return strings.Join([]string{userA, userB}, ":")
+}
+
+// directKeyUsers returns the two users of the direct chat with the direct
+// key, which may be prefixed with a tenant, or false for another key.
+func directKeyUsers(directKey string) ([]string, bool) {
+	if i := strings.LastIndex(directKey, "/"); i >= 0 {
+		directKey = directKey[i+1:]
+	}
+
+	users := strings.Split(directKey, ":")
+	if len(users) != 2 || slices.Contains(users, "") {
+		return nil, false
+	}
+
+	return users, true
+}
@@ -0,0 +1,29 @@
+package chatstore
+
+import "testing"
+
+func TestDirectKeyHasUser(t *testing.T) {
+	cases := []struct {
+		directKey string
+		userID    string
+		expected  bool
+	}{
+		{"alice:bob", "alice", true},
+		{"alice:bob", "bob", true},
+		{"acme/alice:bob", "alice", true},
+		{"acme/alice:bob", "bob", true},
+		{"alice:bob", "ali", false},
+		{"alice:bob", "alice:bob", false},
+		{"acme/alice:bob", "acme", false},
+		{"a:b:c", "a:b", false},
+		{"a:b:c", "b:c", false},
+		{"", "", false},
+		{"alice", "alice", false},
+	}
+
+	for _, c := range cases {
+		if got := directKeyHasUser(c.directKey, c.userID); got != c.expected {
+			t.Errorf("directKeyHasUser(%q, %q) = %v, expected %v", c.directKey, c.userID, got, c.expected)
+		}
+	}
+}
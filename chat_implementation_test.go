@@ -1,7 +1,11 @@
 package chatstore
 
 import (
+	"encoding/json"
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewChat(t *testing.T) {
@@ -375,6 +379,167 @@ func TestChatUpsertMetas(t *testing.T) {
 	}
 }
 
+func TestChatTypedMetas(t *testing.T) {
+	chat := NewChat()
+
+	type escalation struct {
+		Level int      `json:"level"`
+		Teams []string `json:"teams"`
+	}
+
+	sentAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	values := map[string]any{
+		"retries":    3,
+		"score":      0.75,
+		"urgent":     true,
+		"sent_at":    sentAt,
+		"escalation": escalation{Level: 2, Teams: []string{"backend", "ops"}},
+	}
+
+	for key, value := range values {
+		if err := chat.SetMetaValue(key, value); err != nil {
+			t.Fatalf("Failed to set meta %s: %v", key, err)
+		}
+	}
+
+	retries, err := chat.MetaInt("retries")
+	if err != nil || retries != 3 {
+		t.Errorf("Expected retries 3, got %d (%v)", retries, err)
+	}
+
+	score, err := chat.MetaFloat("score")
+	if err != nil || score != 0.75 {
+		t.Errorf("Expected score 0.75, got %f (%v)", score, err)
+	}
+
+	urgent, err := chat.MetaBool("urgent")
+	if err != nil || !urgent {
+		t.Errorf("Expected urgent true, got %t (%v)", urgent, err)
+	}
+
+	parsedSentAt, err := chat.MetaTime("sent_at")
+	if err != nil || !parsedSentAt.Equal(sentAt) {
+		t.Errorf("Expected sent_at %v, got %v (%v)", sentAt, parsedSentAt, err)
+	}
+
+	var parsedEscalation escalation
+	err = chat.MetaJSON("escalation", &parsedEscalation)
+	if err != nil || parsedEscalation.Level != 2 || len(parsedEscalation.Teams) != 2 {
+		t.Errorf("Expected escalation level 2 with 2 teams, got %+v (%v)", parsedEscalation, err)
+	}
+
+	// Typed values remain readable as strings
+	metas, err := chat.Metas()
+	if err != nil {
+		t.Fatalf("Failed to get metas: %v", err)
+	}
+
+	if metas["retries"] != "3" || metas["urgent"] != "true" {
+		t.Errorf("Expected string values 3 and true, got %s and %s", metas["retries"], metas["urgent"])
+	}
+
+	// Upserting string metas keeps the typed values
+	err = chat.UpsertMetas(map[string]string{"team": "backend"})
+	if err != nil {
+		t.Fatalf("Failed to upsert metas: %v", err)
+	}
+
+	urgent, err = chat.MetaBool("urgent")
+	if err != nil || !urgent {
+		t.Errorf("Expected urgent to remain true, got %t (%v)", urgent, err)
+	}
+
+	// Missing keys return zero values
+	missing, err := chat.MetaInt("missing")
+	if err != nil || missing != 0 {
+		t.Errorf("Expected missing meta to be 0, got %d (%v)", missing, err)
+	}
+
+	// Non numeric values return an error
+	if _, err := chat.MetaInt("team"); err == nil {
+		t.Error("Expected error reading a text meta as integer")
+	}
+}
+
+func TestChatMetaIntFromJSONNumbers(t *testing.T) {
+	chat := NewChat()
+
+	// Other writers may store whole numbers with a fraction or an exponent
+	values := map[string]string{
+		"fraction": "5.0",
+		"exponent": "1e3",
+		"negative": "-2E1",
+		"decimal":  "5.5",
+		"huge":     "1e19",
+	}
+
+	for key, value := range values {
+		if err := chat.SetMetaValue(key, json.RawMessage(value)); err != nil {
+			t.Fatalf("Failed to set meta %s: %v", key, err)
+		}
+	}
+
+	testCases := []struct {
+		key      string
+		expected int64
+	}{
+		{"fraction", 5},
+		{"exponent", 1000},
+		{"negative", -20},
+	}
+
+	for _, tc := range testCases {
+		value, err := chat.MetaInt(tc.key)
+		if err != nil || value != tc.expected {
+			t.Errorf("Expected %s %d, got %d (%v)", tc.key, tc.expected, value, err)
+		}
+	}
+
+	// Numbers which are not whole or out of range return an error
+	for _, key := range []string{"decimal", "huge"} {
+		if _, err := chat.MetaInt(key); err == nil {
+			t.Errorf("Expected error reading %s as integer", key)
+		}
+	}
+}
+
+func TestChatTypedMetasFromStrings(t *testing.T) {
+	chat := NewChat()
+
+	// Rows written before typed metas hold stringified values
+	err := chat.SetMetas(map[string]string{
+		"retries":    "3",
+		"urgent":     "true",
+		"sent_at":    "2024-01-02 03:04:05",
+		"escalation": `{"level":2}`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set metas: %v", err)
+	}
+
+	retries, err := chat.MetaInt("retries")
+	if err != nil || retries != 3 {
+		t.Errorf("Expected retries 3, got %d (%v)", retries, err)
+	}
+
+	urgent, err := chat.MetaBool("urgent")
+	if err != nil || !urgent {
+		t.Errorf("Expected urgent true, got %t (%v)", urgent, err)
+	}
+
+	sentAt, err := chat.MetaTime("sent_at")
+	if err != nil || !sentAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected sent_at 2024-01-02 03:04:05, got %v (%v)", sentAt, err)
+	}
+
+	escalation := map[string]int{}
+	err = chat.MetaJSON("escalation", &escalation)
+	if err != nil || escalation["level"] != 2 {
+		t.Errorf("Expected escalation level 2, got %v (%v)", escalation, err)
+	}
+}
+
 func TestChatMetasEmpty(t *testing.T) {
 	chat := NewChat()
 
@@ -471,6 +636,65 @@ func TestChatMarkAsNotDirty(t *testing.T) {
 	chat.MarkAsNotDirty()
 }
 
+func TestChatVersion(t *testing.T) {
+	chat := NewChat()
+
+	if chat.Version() != 0 {
+		t.Errorf("Expected initial version 0, got %d", chat.Version())
+	}
+
+	chat.SetVersion(3)
+
+	if chat.Version() != 3 {
+		t.Errorf("Expected version 3, got %d", chat.Version())
+	}
+
+	existing := NewChatFromExistingData(map[string]string{
+		COLUMN_ID:      "test-id",
+		COLUMN_VERSION: "7",
+	})
+
+	if existing.Version() != 7 {
+		t.Errorf("Expected version 7, got %d", existing.Version())
+	}
+}
+
+func TestChatDirtyFields(t *testing.T) {
+	chat := NewChatFromExistingData(map[string]string{
+		COLUMN_ID:     "test-id",
+		COLUMN_STATUS: CHAT_STATUS_ACTIVE,
+	})
+
+	if chat.IsDirty() {
+		t.Errorf("Expected existing chat not to be dirty, got %v", chat.DirtyFields())
+	}
+
+	// Setting the same value is not a change
+	chat.SetStatus(CHAT_STATUS_ACTIVE)
+
+	if chat.IsDirty() {
+		t.Errorf("Expected chat not to be dirty after setting the same status, got %v", chat.DirtyFields())
+	}
+
+	chat.SetTitle("Test Title")
+	chat.SetStatus(CHAT_STATUS_INACTIVE)
+
+	if !chat.IsDirty() {
+		t.Fatal("Expected chat to be dirty")
+	}
+
+	dirtyFields := chat.DirtyFields()
+	if len(dirtyFields) != 2 || dirtyFields[0] != COLUMN_STATUS || dirtyFields[1] != COLUMN_TITLE {
+		t.Errorf("Expected dirty fields [%s %s], got %v", COLUMN_STATUS, COLUMN_TITLE, dirtyFields)
+	}
+
+	chat.MarkAsNotDirty()
+
+	if chat.IsDirty() {
+		t.Errorf("Expected chat not to be dirty after MarkAsNotDirty, got %v", chat.DirtyFields())
+	}
+}
+
 func TestChatChaining(t *testing.T) {
 	chat := NewChat()
 
@@ -508,3 +732,43 @@ func TestChatChaining(t *testing.T) {
 		t.Errorf("Chaining failed: expected memo 'Test Memo', got %s", chat.Memo())
 	}
 }
+
+func TestDirectChatKey(t *testing.T) {
+	key := DirectChatKey("user_b", "user_a")
+
+	if key != "user_a:user_b" {
+		t.Fatal("unexpected direct key:", key)
+	}
+
+	if DirectChatKey("user_a", "user_b") != key {
+		t.Fatal("expected the same key whatever the order of the users")
+	}
+}
+
+func TestChat_Validate(t *testing.T) {
+	chat := NewChat().SetOwnerID("owner-id").SetTitle("Team")
+	if err := chat.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat.SetID("").SetStatus("").SetTitle(strings.Repeat("x", MAX_LENGTH_TITLE+1))
+
+	err := chat.Validate()
+	if !errors.Is(err, ErrValidation) {
+		t.Fatal("expected ErrValidation, got", err)
+	}
+
+	var fieldErrors ValidationErrors
+	if !errors.As(err, &fieldErrors) {
+		t.Fatal("expected ValidationErrors, got", err)
+	}
+
+	fields := []string{}
+	for _, fieldError := range fieldErrors {
+		fields = append(fields, fieldError.Field)
+	}
+
+	if strings.Join(fields, ",") != "id,status,title" {
+		t.Fatal("unexpected fields:", fields)
+	}
+}
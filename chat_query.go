@@ -7,6 +7,10 @@ type ChatQueryInterface interface {
 	// Validation method
 	Validate() error
 
+	// Clone returns a copy of the query, which can be changed without
+	// changing the query
+	Clone() ChatQueryInterface
+
 	// Count related methods
 	IsCountOnlySet() bool
 	GetCountOnly() bool
@@ -26,6 +30,10 @@ type ChatQueryInterface interface {
 	GetOwnerID() string
 	SetOwnerID(ownerID string) ChatQueryInterface
 
+	IsOwnerIDInSet() bool
+	GetOwnerIDIn() []string
+	SetOwnerIDIn(ownerIDs []string) ChatQueryInterface
+
 	IsCreatedAtGteSet() bool
 	GetCreatedAtGte() string
 	SetCreatedAtGte(createdAt string) ChatQueryInterface
@@ -34,6 +42,10 @@ type ChatQueryInterface interface {
 	GetCreatedAtLte() string
 	SetCreatedAtLte(createdAt string) ChatQueryInterface
 
+	IsDirectKeySet() bool
+	GetDirectKey() string
+	SetDirectKey(directKey string) ChatQueryInterface
+
 	IsIDSet() bool
 	GetID() string
 	SetID(id string) ChatQueryInterface
@@ -42,6 +54,22 @@ type ChatQueryInterface interface {
 	GetIDIn() []string
 	SetIDIn(ids []string) ChatQueryInterface
 
+	IsIDNotInSet() bool
+	GetIDNotIn() []string
+	SetIDNotIn(ids []string) ChatQueryInterface
+
+	IsMetaEqualsSet() bool
+	GetMetaEquals() map[string]string
+	SetMetaEquals(key string, value string) ChatQueryInterface
+
+	IsMetaExistsSet() bool
+	GetMetaExists() []string
+	SetMetaExists(key string) ChatQueryInterface
+
+	IsMetaInSet() bool
+	GetMetaIn() map[string][]string
+	SetMetaIn(key string, values []string) ChatQueryInterface
+
 	IsLimitSet() bool
 	GetLimit() int
 	SetLimit(limit int) ChatQueryInterface
@@ -66,6 +94,27 @@ type ChatQueryInterface interface {
 	GetStatusIn() []string
 	SetStatusIn(statuses []string) ChatQueryInterface
 
+	IsStatusNotInSet() bool
+	GetStatusNotIn() []string
+	SetStatusNotIn(statuses []string) ChatQueryInterface
+
+	// Text search methods
+	IsSearchSet() bool
+	GetSearch() string
+	SetSearch(search string) ChatQueryInterface
+
+	IsTitleLikeSet() bool
+	GetTitleLike() string
+	SetTitleLike(titleLike string) ChatQueryInterface
+
+	IsSoftDeletedAtGteSet() bool
+	GetSoftDeletedAtGte() string
+	SetSoftDeletedAtGte(softDeletedAt string) ChatQueryInterface
+
+	IsSoftDeletedAtLteSet() bool
+	GetSoftDeletedAtLte() string
+	SetSoftDeletedAtLte(softDeletedAt string) ChatQueryInterface
+
 	IsUpdatedAtGteSet() bool
 	GetUpdatedAtGte() string
 	SetUpdatedAtGte(updatedAt string) ChatQueryInterface
@@ -73,6 +122,30 @@ type ChatQueryInterface interface {
 	IsUpdatedAtLteSet() bool
 	GetUpdatedAtLte() string
 	SetUpdatedAtLte(updatedAt string) ChatQueryInterface
+
+	// User settings methods, the archived and hidden options apply
+	// to the settings of the settings user
+	IsSettingsUserIDSet() bool
+	GetSettingsUserID() string
+	SetSettingsUserID(userID string) ChatQueryInterface
+
+	// Archived true matches only the archived chats, false excludes them
+	IsArchivedSet() bool
+	GetArchived() bool
+	SetArchived(archived bool) ChatQueryInterface
+
+	// Hidden true matches only the hidden chats, false excludes them
+	IsHiddenSet() bool
+	GetHidden() bool
+	SetHidden(hidden bool) ChatQueryInterface
+}
+
+// ChatQueryResult holds the outcome of executing a chat query
+type ChatQueryResult struct {
+	// Items holds the chats of the requested page (empty when count only is set)
+	Items []ChatInterface
+	// Total holds the number of chats matching the query, ignoring limit and offset
+	Total int64
 }
 
 // ChatQuery creates a new chat query
@@ -94,12 +167,24 @@ type chatQueryImplementation struct {
 	params map[string]any
 }
 
+// Clone returns a copy of the query. The meta setters add to the maps and
+// slices of the parameters, so these are copied too.
+func (q *chatQueryImplementation) Clone() ChatQueryInterface {
+	return &chatQueryImplementation{
+		params: queryParamsClone(q.params),
+	}
+}
+
 // Validate validates the query parameters
 func (q *chatQueryImplementation) Validate() error {
 	if q.IsOwnerIDSet() && q.GetOwnerID() == "" {
 		return errors.New("chat query: owner_id cannot be empty")
 	}
 
+	if q.IsOwnerIDInSet() && len(q.GetOwnerIDIn()) < 1 {
+		return errors.New("chat query: owner_id_in cannot be empty array")
+	}
+
 	if q.IsCreatedAtGteSet() && q.GetCreatedAtGte() == "" {
 		return errors.New("chat query: created_at_gte cannot be empty")
 	}
@@ -108,6 +193,10 @@ func (q *chatQueryImplementation) Validate() error {
 		return errors.New("chat query: created_at_lte cannot be empty")
 	}
 
+	if q.IsDirectKeySet() && q.GetDirectKey() == "" {
+		return errors.New("chat query: direct_key cannot be empty")
+	}
+
 	if q.IsIDSet() && q.GetID() == "" {
 		return errors.New("chat query: id cannot be empty")
 	}
@@ -116,6 +205,32 @@ func (q *chatQueryImplementation) Validate() error {
 		return errors.New("chat query: id_in cannot be empty array")
 	}
 
+	if q.IsIDNotInSet() && len(q.GetIDNotIn()) < 1 {
+		return errors.New("chat query: id_not_in cannot be empty array")
+	}
+
+	for key := range q.GetMetaEquals() {
+		if key == "" {
+			return errors.New("chat query: meta_equals key cannot be empty")
+		}
+	}
+
+	for _, key := range q.GetMetaExists() {
+		if key == "" {
+			return errors.New("chat query: meta_exists key cannot be empty")
+		}
+	}
+
+	for key, values := range q.GetMetaIn() {
+		if key == "" {
+			return errors.New("chat query: meta_in key cannot be empty")
+		}
+
+		if len(values) < 1 {
+			return errors.New("chat query: meta_in values cannot be empty array")
+		}
+	}
+
 	if q.IsLimitSet() && q.GetLimit() < 0 {
 		return errors.New("chat query: limit cannot be negative")
 	}
@@ -132,6 +247,34 @@ func (q *chatQueryImplementation) Validate() error {
 		return errors.New("chat query: status_in cannot be empty array")
 	}
 
+	if q.IsStatusNotInSet() && len(q.GetStatusNotIn()) < 1 {
+		return errors.New("chat query: status_not_in cannot be empty array")
+	}
+
+	if q.IsSearchSet() && q.GetSearch() == "" {
+		return errors.New("chat query: search cannot be empty")
+	}
+
+	if q.IsTitleLikeSet() && q.GetTitleLike() == "" {
+		return errors.New("chat query: title_like cannot be empty")
+	}
+
+	if q.IsSoftDeletedAtGteSet() && q.GetSoftDeletedAtGte() == "" {
+		return errors.New("chat query: soft_deleted_at_gte cannot be empty")
+	}
+
+	if q.IsSoftDeletedAtLteSet() && q.GetSoftDeletedAtLte() == "" {
+		return errors.New("chat query: soft_deleted_at_lte cannot be empty")
+	}
+
+	if q.IsSettingsUserIDSet() && q.GetSettingsUserID() == "" {
+		return errors.New("chat query: settings_user_id cannot be empty")
+	}
+
+	if (q.IsArchivedSet() || q.IsHiddenSet()) && !q.IsSettingsUserIDSet() {
+		return errors.New("chat query: settings_user_id is required with archived or hidden")
+	}
+
 	return nil
 }
 
@@ -160,6 +303,22 @@ func (q *chatQueryImplementation) SetOwnerID(ownerID string) ChatQueryInterface
 	return q
 }
 
+func (q *chatQueryImplementation) IsOwnerIDInSet() bool {
+	return q.hasProperty("owner_id_in")
+}
+
+func (q *chatQueryImplementation) GetOwnerIDIn() []string {
+	if q.IsOwnerIDInSet() {
+		return q.params["owner_id_in"].([]string)
+	}
+	return []string{}
+}
+
+func (q *chatQueryImplementation) SetOwnerIDIn(ownerIDIn []string) ChatQueryInterface {
+	q.params["owner_id_in"] = ownerIDIn
+	return q
+}
+
 func (q *chatQueryImplementation) IsCountOnlySet() bool {
 	return q.hasProperty("count_only")
 }
@@ -208,6 +367,70 @@ func (q *chatQueryImplementation) SetCreatedAtLte(createdAtLte string) ChatQuery
 	return q
 }
 
+func (q *chatQueryImplementation) IsSettingsUserIDSet() bool {
+	return q.hasProperty("settings_user_id")
+}
+
+func (q *chatQueryImplementation) GetSettingsUserID() string {
+	if q.IsSettingsUserIDSet() {
+		return q.params["settings_user_id"].(string)
+	}
+	return ""
+}
+
+func (q *chatQueryImplementation) SetSettingsUserID(userID string) ChatQueryInterface {
+	q.params["settings_user_id"] = userID
+	return q
+}
+
+func (q *chatQueryImplementation) IsArchivedSet() bool {
+	return q.hasProperty("archived")
+}
+
+func (q *chatQueryImplementation) GetArchived() bool {
+	if q.IsArchivedSet() {
+		return q.params["archived"].(bool)
+	}
+	return false
+}
+
+func (q *chatQueryImplementation) SetArchived(archived bool) ChatQueryInterface {
+	q.params["archived"] = archived
+	return q
+}
+
+func (q *chatQueryImplementation) IsHiddenSet() bool {
+	return q.hasProperty("hidden")
+}
+
+func (q *chatQueryImplementation) GetHidden() bool {
+	if q.IsHiddenSet() {
+		return q.params["hidden"].(bool)
+	}
+	return false
+}
+
+func (q *chatQueryImplementation) SetHidden(hidden bool) ChatQueryInterface {
+	q.params["hidden"] = hidden
+	return q
+}
+
+func (q *chatQueryImplementation) IsDirectKeySet() bool {
+	return q.hasProperty("direct_key")
+}
+
+func (q *chatQueryImplementation) GetDirectKey() string {
+	if q.IsDirectKeySet() {
+		return q.params["direct_key"].(string)
+	}
+	return ""
+}
+
+func (q *chatQueryImplementation) SetDirectKey(directKey string) ChatQueryInterface {
+	q.params["direct_key"] = directKey
+	return q
+}
+
 func (q *chatQueryImplementation) IsIDSet() bool {
 	return q.hasProperty("id")
 }
@@ -240,6 +463,77 @@ func (q *chatQueryImplementation) SetIDIn(idIn []string) ChatQueryInterface {
 	return q
 }
 
+func (q *chatQueryImplementation) IsMetaEqualsSet() bool {
+	return q.hasProperty("meta_equals")
+}
+
+func (q *chatQueryImplementation) GetMetaEquals() map[string]string {
+	if q.IsMetaEqualsSet() {
+		return q.params["meta_equals"].(map[string]string)
+	}
+	return map[string]string{}
+}
+
+// SetMetaEquals filters by the meta key having the value. Can be called for multiple keys.
+func (q *chatQueryImplementation) SetMetaEquals(key string, value string) ChatQueryInterface {
+	metaEquals := q.GetMetaEquals()
+	metaEquals[key] = value
+	q.params["meta_equals"] = metaEquals
+	return q
+}
+
+func (q *chatQueryImplementation) IsMetaExistsSet() bool {
+	return q.hasProperty("meta_exists")
+}
+
+func (q *chatQueryImplementation) GetMetaExists() []string {
+	if q.IsMetaExistsSet() {
+		return q.params["meta_exists"].([]string)
+	}
+	return []string{}
+}
+
+// SetMetaExists filters by the meta key being present. Can be called for multiple keys.
+func (q *chatQueryImplementation) SetMetaExists(key string) ChatQueryInterface {
+	q.params["meta_exists"] = append(q.GetMetaExists(), key)
+	return q
+}
+
+func (q *chatQueryImplementation) IsMetaInSet() bool {
+	return q.hasProperty("meta_in")
+}
+
+func (q *chatQueryImplementation) GetMetaIn() map[string][]string {
+	if q.IsMetaInSet() {
+		return q.params["meta_in"].(map[string][]string)
+	}
+	return map[string][]string{}
+}
+
+// SetMetaIn filters by the meta key having one of the values. Can be called for multiple keys.
+func (q *chatQueryImplementation) SetMetaIn(key string, values []string) ChatQueryInterface {
+	metaIn := q.GetMetaIn()
+	metaIn[key] = values
+	q.params["meta_in"] = metaIn
+	return q
+}
+
+func (q *chatQueryImplementation) IsIDNotInSet() bool {
+	return q.hasProperty("id_not_in")
+}
+
+func (q *chatQueryImplementation) GetIDNotIn() []string {
+	if q.IsIDNotInSet() {
+		return q.params["id_not_in"].([]string)
+	}
+	return []string{}
+}
+
+func (q *chatQueryImplementation) SetIDNotIn(idNotIn []string) ChatQueryInterface {
+	q.params["id_not_in"] = idNotIn
+	return q
+}
+
 func (q *chatQueryImplementation) IsLimitSet() bool {
 	return q.hasProperty("limit")
 }
@@ -304,6 +598,38 @@ func (q *chatQueryImplementation) SetWithSoftDeleted(withSoftDeleted bool) ChatQ
 	return q
 }
 
+func (q *chatQueryImplementation) IsSoftDeletedAtGteSet() bool {
+	return q.hasProperty("soft_deleted_at_gte")
+}
+
+func (q *chatQueryImplementation) GetSoftDeletedAtGte() string {
+	if q.IsSoftDeletedAtGteSet() {
+		return q.params["soft_deleted_at_gte"].(string)
+	}
+	return ""
+}
+
+func (q *chatQueryImplementation) SetSoftDeletedAtGte(softDeletedAtGte string) ChatQueryInterface {
+	q.params["soft_deleted_at_gte"] = softDeletedAtGte
+	return q
+}
+
+func (q *chatQueryImplementation) IsSoftDeletedAtLteSet() bool {
+	return q.hasProperty("soft_deleted_at_lte")
+}
+
+func (q *chatQueryImplementation) GetSoftDeletedAtLte() string {
+	if q.IsSoftDeletedAtLteSet() {
+		return q.params["soft_deleted_at_lte"].(string)
+	}
+	return ""
+}
+
+func (q *chatQueryImplementation) SetSoftDeletedAtLte(softDeletedAtLte string) ChatQueryInterface {
+	q.params["soft_deleted_at_lte"] = softDeletedAtLte
+	return q
+}
+
 func (q *chatQueryImplementation) IsOrderBySet() bool {
 	return q.hasProperty("order_by")
 }
@@ -368,6 +694,54 @@ func (q *chatQueryImplementation) SetStatusIn(statuses []string) ChatQueryInterf
 	return q
 }
 
+func (q *chatQueryImplementation) IsStatusNotInSet() bool {
+	return q.hasProperty("status_not_in")
+}
+
+func (q *chatQueryImplementation) GetStatusNotIn() []string {
+	if q.IsStatusNotInSet() {
+		return q.params["status_not_in"].([]string)
+	}
+	return []string{}
+}
+
+func (q *chatQueryImplementation) SetStatusNotIn(statuses []string) ChatQueryInterface {
+	q.params["status_not_in"] = statuses
+	return q
+}
+
+func (q *chatQueryImplementation) IsSearchSet() bool {
+	return q.hasProperty("search")
+}
+
+func (q *chatQueryImplementation) GetSearch() string {
+	if q.IsSearchSet() {
+		return q.params["search"].(string)
+	}
+	return ""
+}
+
+func (q *chatQueryImplementation) SetSearch(search string) ChatQueryInterface {
+	q.params["search"] = search
+	return q
+}
+
+func (q *chatQueryImplementation) IsTitleLikeSet() bool {
+	return q.hasProperty("title_like")
+}
+
+func (q *chatQueryImplementation) GetTitleLike() string {
+	if q.IsTitleLikeSet() {
+		return q.params["title_like"].(string)
+	}
+	return ""
+}
+
+func (q *chatQueryImplementation) SetTitleLike(titleLike string) ChatQueryInterface {
+	q.params["title_like"] = titleLike
+	return q
+}
+
 func (q *chatQueryImplementation) IsUpdatedAtGteSet() bool {
 	return q.hasProperty("updated_at_gte")
 }
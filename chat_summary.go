@@ -0,0 +1,34 @@
+package chatstore
+
+import "time"
+
+// ChatSummaryOptions configures the summaries returned by ChatListWithSummary
+type ChatSummaryOptions struct {
+	// OrderByLastActivity orders the chats by their last activity, using the
+	// order direction of the query (DESC by default) instead of its order by
+	OrderByLastActivity bool
+
+	// UnreadForUserID, when set, counts the unread messages of each chat for
+	// the user: the messages sent by someone else which the user has not
+	// marked read (see MessageMarkRead)
+	UnreadForUserID string
+}
+
+// ChatSummary holds a chat with an overview of its messages, as needed to
+// render an inbox
+type ChatSummary struct {
+	// Chat is the summarized chat
+	Chat ChatInterface
+	// LastMessage is the latest message of the chat, nil when it has none.
+	// Of the messages created within the same second, the one with the
+	// greatest ID is taken
+	LastMessage MessageInterface
+	// LastActivityAt is the time of the latest message, or the time the chat
+	// was created when it has no messages
+	LastActivityAt time.Time
+	// MessageCount is the number of (not soft deleted) messages of the chat
+	MessageCount int64
+	// UnreadCount is the number of unread messages, only counted when
+	// UnreadForUserID is set in the options
+	UnreadCount int64
+}
@@ -0,0 +1,43 @@
+package chatstore
+
+import (
+	"time"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// ChatUserSettings holds the settings of a chat for one of its users,
+// such as archiving or muting the chat for that user only
+type ChatUserSettings struct {
+	ChatID string
+	UserID string
+	// Archived moves the chat out of the user's inbox
+	Archived bool
+	// Hidden removes the chat from the user's chat lists
+	Hidden bool
+	// MutedUntil is the time the notifications of the chat are muted until,
+	// empty when not muted
+	MutedUntil string
+	// NotificationLevel is one of the NOTIFICATION_LEVEL_* constants
+	NotificationLevel string
+	// CustomTitle is the title of the chat shown to the user, empty for the chat title
+	CustomTitle string
+}
+
+// NewChatUserSettings returns the default settings of the chat for the user,
+// which apply until the user changes them.
+func NewChatUserSettings(chatID string, userID string) ChatUserSettings {
+	return ChatUserSettings{
+		ChatID:            chatID,
+		UserID:            userID,
+		NotificationLevel: NOTIFICATION_LEVEL_ALL,
+	}
+}
+
+// IsMuted returns whether the notifications of the chat are muted for the user.
+func (s ChatUserSettings) IsMuted() bool {
+	if s.MutedUntil == "" {
+		return false
+	}
+	return carbon.Parse(s.MutedUntil, carbon.UTC).StdTime().After(time.Now())
+}
@@ -2,19 +2,45 @@ package chatstore
 
 // Column names for the chat and message tables
 const (
-	COLUMN_CHAT_ID         = "chat_id"
-	COLUMN_CREATED_AT      = "created_at"
-	COLUMN_ID              = "id"
-	COLUMN_MEMO            = "memo"
-	COLUMN_METAS           = "metas"
-	COLUMN_RECIPIENT_ID    = "recipient_id"
-	COLUMN_SENDER_ID       = "sender_id"
-	COLUMN_OWNER_ID        = "owner_id"
-	COLUMN_SOFT_DELETED_AT = "soft_deleted_at"
-	COLUMN_STATUS          = "status"
-	COLUMN_TEXT            = "text"
-	COLUMN_TITLE           = "title"
-	COLUMN_UPDATED_AT      = "updated_at"
+	COLUMN_ACTION             = "action"
+	COLUMN_ARCHIVED           = "archived"
+	COLUMN_ATTEMPTS           = "attempts"
+	COLUMN_CHAT_ID            = "chat_id"
+	COLUMN_CLIENT_MESSAGE_ID  = "client_message_id"
+	COLUMN_CREATED_AT         = "created_at"
+	COLUMN_CUSTOM_TITLE       = "custom_title"
+	COLUMN_DELIVERY_STATUS    = "delivery_status"
+	COLUMN_DIRECT_KEY         = "direct_key"
+	COLUMN_EXPIRES_AT         = "expires_at"
+	COLUMN_FAILURE_REASON     = "failure_reason"
+	COLUMN_HIDDEN             = "hidden"
+	COLUMN_ID                 = "id"
+	COLUMN_LAST_MESSAGE_AT    = "last_message_at"
+	COLUMN_MEMO               = "memo"
+	COLUMN_MESSAGE_COUNT      = "message_count"
+	COLUMN_MESSAGE_ID         = "message_id"
+	COLUMN_METAS              = "metas"
+	COLUMN_MODERATION_STATE   = "moderation_state"
+	COLUMN_MUTED_UNTIL        = "muted_until"
+	COLUMN_NOTIFICATION_LEVEL = "notification_level"
+	COLUMN_REASON             = "reason"
+	COLUMN_RECIPIENT_ID       = "recipient_id"
+	COLUMN_REVIEWER_ID        = "reviewer_id"
+	COLUMN_SCHEDULED_AT       = "scheduled_at"
+	COLUMN_SENDER_ID          = "sender_id"
+	COLUMN_OWNER_ID           = "owner_id"
+	COLUMN_PINNED_AT          = "pinned_at"
+	COLUMN_PINNED_BY          = "pinned_by"
+	COLUMN_SOFT_DELETED_AT    = "soft_deleted_at"
+	COLUMN_STARRED_AT         = "starred_at"
+	COLUMN_STATUS             = "status"
+	COLUMN_TENANT_ID          = "tenant_id"
+	COLUMN_TEXT               = "text"
+	COLUMN_TEXT_OFFSET        = "text_offset"
+	COLUMN_TITLE              = "title"
+	COLUMN_UPDATED_AT         = "updated_at"
+	COLUMN_USER_ID            = "user_id"
+	COLUMN_VERSION            = "version"
 )
 
 // Status constants
@@ -31,6 +57,89 @@ const (
 	MESSAGE_STATUS_ACTIVE   = "active"
 	MESSAGE_STATUS_INACTIVE = "inactive"
 	MESSAGE_STATUS_DELETED  = "deleted"
+	// MESSAGE_STATUS_SCHEDULED marks a message waiting to be published at its scheduled time
+	MESSAGE_STATUS_SCHEDULED = "scheduled"
+)
+
+// Delivery status constants, tracking a message per recipient. A delivery
+// only moves forward: sent, then delivered, then read. A failed delivery
+// can be sent again or still be delivered.
+const (
+	DELIVERY_STATUS_SENT      = "sent"
+	DELIVERY_STATUS_DELIVERED = "delivered"
+	DELIVERY_STATUS_READ      = "read"
+	DELIVERY_STATUS_FAILED    = "failed"
+)
+
+// Moderation action constants, the decisions of a Moderator on a message.
+// Reviewers approve or reject the messages held for review.
+const (
+	MODERATION_ACTION_ALLOW   = "allow"
+	MODERATION_ACTION_APPROVE = "approve"
+	MODERATION_ACTION_FLAG    = "flag"
+	MODERATION_ACTION_REDACT  = "redact"
+	MODERATION_ACTION_REJECT  = "reject"
+)
+
+// Moderation state constants, empty for a message allowed as is. A flagged
+// message waits in the review queue, and a rejected message is hidden.
+const (
+	MODERATION_STATE_APPROVED = "approved"
+	MODERATION_STATE_FLAGGED  = "flagged"
+	MODERATION_STATE_REDACTED = "redacted"
+	MODERATION_STATE_REJECTED = "rejected"
+)
+
+// Access action constants, the actions a Policy allows on a chat. Reading
+// covers the messages, stars and delivery receipts of the chat, editing
+// covers updating and deleting a message, and managing covers updating and
+// deleting the chat. Administering covers the store wide operations, and
+// acting for other users.
+const (
+	ACCESS_ACTION_ADMINISTER = "administer"
+	ACCESS_ACTION_EDIT       = "edit"
+	ACCESS_ACTION_MANAGE     = "manage"
+	ACCESS_ACTION_MODERATE   = "moderate"
+	ACCESS_ACTION_PIN        = "pin"
+	ACCESS_ACTION_READ       = "read"
+	ACCESS_ACTION_SEND       = "send"
+)
+
+// Access role constants, the roles of a principal in a chat. A participant
+// sent or received a message in the chat, or is one of the users of the
+// direct chat. The sender role is held on the messages sent by the principal.
+const (
+	ACCESS_ROLE_ADMIN       = "admin"
+	ACCESS_ROLE_OWNER       = "owner"
+	ACCESS_ROLE_PARTICIPANT = "participant"
+	ACCESS_ROLE_SENDER      = "sender"
+)
+
+// Notification level constants, set per user in the chat user settings
+const (
+	NOTIFICATION_LEVEL_ALL      = "all"
+	NOTIFICATION_LEVEL_MENTIONS = "mentions"
+	NOTIFICATION_LEVEL_NONE     = "none"
+)
+
+// Column length constants, the maximum lengths checked by the Validate
+// methods of chats and messages. Lengths are in characters, but the text
+// length is in bytes, as stored by a TEXT column.
+const (
+	MAX_LENGTH_ID        = 40
+	MAX_LENGTH_USER_ID   = 40
+	MAX_LENGTH_TENANT_ID = 40
+	MAX_LENGTH_STATUS    = 40
+	MAX_LENGTH_TITLE     = 255
+	MAX_LENGTH_KEY       = 255
+	MAX_LENGTH_TEXT      = 65535
+)
+
+// Stats period constants, used to bucket the message stats by date
+const (
+	STATS_PERIOD_DAY   = "day"
+	STATS_PERIOD_WEEK  = "week"
+	STATS_PERIOD_MONTH = "month"
 )
 
 // MAX_DATETIME is a far-future datetime used as the default soft-delete sentinel.
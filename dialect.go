@@ -0,0 +1,335 @@
+package chatstore
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	contractsdatabase "github.com/dracory/neat/contracts/database"
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	neatquery "github.com/dracory/neat/database/query"
+)
+
+// == DIALECT =================================================================
+
+// dialect returns the SQL dialect of the store database, treating the SQLite
+// compatible drivers as SQLite.
+func (st *storeImplementation) dialect() contractsdatabase.Driver {
+	driver := st.db.Query().Driver()
+	if driver == contractsdatabase.DriverTurso {
+		return contractsdatabase.DriverSqlite
+	}
+	return driver
+}
+
+// errUnsupportedDialect returns the error for a feature not available for the dialect.
+func errUnsupportedDialect(feature string, driver contractsdatabase.Driver) error {
+	return fmt.Errorf("chat store: %s is not supported for the %s driver", feature, driver)
+}
+
+// metasJSON returns the metas column as a JSON document, treating empty values as an empty object.
+func metasJSON() string {
+	return "COALESCE(NULLIF(" + COLUMN_METAS + ", ''), '{}')"
+}
+
+// metaJSONPath returns the JSON path addressing a top level meta key.
+func metaJSONPath(key string) string {
+	key = strings.ReplaceAll(key, `\`, `\\`)
+	key = strings.ReplaceAll(key, `"`, `\"`)
+	return `$."` + key + `"`
+}
+
+// metaSetExpr returns the expression setting the meta key in the metas column.
+func (st *storeImplementation) metaSetExpr(key string, value string) (neatquery.RawExpression, error) {
+	switch driver := st.dialect(); driver {
+	case contractsdatabase.DriverSqlite:
+		return neatquery.RawExpr("json_set("+metasJSON()+", ?, ?)", metaJSONPath(key), value), nil
+	case contractsdatabase.DriverMysql:
+		return neatquery.RawExpr("JSON_SET("+metasJSON()+", ?, ?)", metaJSONPath(key), value), nil
+	case contractsdatabase.DriverPostgres:
+		return neatquery.RawExpr("jsonb_set("+metasJSON()+"::jsonb, ARRAY[?::text], to_jsonb(?::text))::text", key, value), nil
+	default:
+		return neatquery.RawExpression{}, errUnsupportedDialect("meta set", driver)
+	}
+}
+
+// metaDeleteExpr returns the expression removing the meta key from the metas column.
+func (st *storeImplementation) metaDeleteExpr(key string) (neatquery.RawExpression, error) {
+	switch driver := st.dialect(); driver {
+	case contractsdatabase.DriverSqlite:
+		return neatquery.RawExpr("json_remove("+metasJSON()+", ?)", metaJSONPath(key)), nil
+	case contractsdatabase.DriverMysql:
+		return neatquery.RawExpr("JSON_REMOVE("+metasJSON()+", ?)", metaJSONPath(key)), nil
+	case contractsdatabase.DriverPostgres:
+		return neatquery.RawExpr("("+metasJSON()+"::jsonb - ?::text)::text", key), nil
+	default:
+		return neatquery.RawExpression{}, errUnsupportedDialect("meta delete", driver)
+	}
+}
+
+// sqlPlaceholders returns the comma separated list of n placeholders, used where
+// neat cannot expand a slice argument (e.g. a clause with multiple arguments).
+func sqlPlaceholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// likeEscape escapes the LIKE wildcards in the term, for use with ESCAPE '!'.
+func likeEscape(term string) string {
+	return strings.NewReplacer("!", "!!", "%", "!%", "_", "!_").Replace(term)
+}
+
+// quoteIdentifier quotes the table or column name for the dialect.
+func (st *storeImplementation) quoteIdentifier(name string) string {
+	if st.dialect() == contractsdatabase.DriverMysql {
+		return "`" + strings.ReplaceAll(name, "`", "``") + "`"
+	}
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// metaColumnName returns the name of the generated column holding the indexed meta key.
+func metaColumnName(key string) string {
+	return "meta_" + key
+}
+
+// metaValueSQL returns the SQL expression reading the meta key as text,
+// together with its arguments. Indexed meta keys read their generated column.
+func (st *storeImplementation) metaValueSQL(indexedKeys []string, key string) (string, []any) {
+	if slices.Contains(indexedKeys, key) {
+		return st.quoteIdentifier(metaColumnName(key)), nil
+	}
+
+	switch st.dialect() {
+	case contractsdatabase.DriverSqlite:
+		return "json_extract(" + metasJSON() + ", ?)", []any{metaJSONPath(key)}
+	case contractsdatabase.DriverMysql:
+		return "JSON_UNQUOTE(JSON_EXTRACT(" + metasJSON() + ", ?))", []any{metaJSONPath(key)}
+	case contractsdatabase.DriverPostgres:
+		return "(" + metasJSON() + "::jsonb ->> ?::text)", []any{key}
+	default:
+		// JSON_VALUE is the SQL standard function, supported by SQL Server and Oracle
+		return "JSON_VALUE(" + metasJSON() + ", ?)", []any{metaJSONPath(key)}
+	}
+}
+
+// metaColumnSQL returns the statement adding the generated column
+// for the indexed meta key to the table.
+func (st *storeImplementation) metaColumnSQL(tableName string, key string) (string, error) {
+	table := st.quoteIdentifier(tableName)
+	column := st.quoteIdentifier(metaColumnName(key))
+	path := "'" + metaJSONPath(key) + "'"
+
+	switch driver := st.dialect(); driver {
+	case contractsdatabase.DriverSqlite:
+		return "ALTER TABLE " + table + " ADD COLUMN " + column + " TEXT GENERATED ALWAYS AS (json_extract(" + metasJSON() + ", " + path + ")) VIRTUAL", nil
+	case contractsdatabase.DriverMysql:
+		return "ALTER TABLE " + table + " ADD COLUMN " + column + " VARCHAR(255) GENERATED ALWAYS AS (JSON_UNQUOTE(JSON_EXTRACT(" + metasJSON() + ", " + path + "))) VIRTUAL", nil
+	case contractsdatabase.DriverPostgres:
+		return "ALTER TABLE " + table + " ADD COLUMN " + column + " TEXT GENERATED ALWAYS AS ((" + metasJSON() + "::jsonb ->> '" + key + "')) STORED", nil
+	default:
+		return "", errUnsupportedDialect("indexed meta keys", driver)
+	}
+}
+
+// dateBucketSQL returns the expression truncating the datetime column to the
+// stats period, formatted the same on every dialect: "2006-01-02" for days,
+// the date of the Monday starting the week for weeks and "2006-01" for months.
+func (st *storeImplementation) dateBucketSQL(column string, period string) (string, error) {
+	driver := st.dialect()
+
+	switch driver {
+	case contractsdatabase.DriverSqlite:
+		// SQLite stores datetimes as text, possibly followed by a time zone
+		value := "substr(" + column + ", 1, 19)"
+		switch period {
+		case STATS_PERIOD_DAY:
+			return "strftime('%Y-%m-%d', " + value + ")", nil
+		case STATS_PERIOD_WEEK:
+			return "date(" + value + ", 'weekday 0', '-6 days')", nil
+		case STATS_PERIOD_MONTH:
+			return "strftime('%Y-%m', " + value + ")", nil
+		}
+	case contractsdatabase.DriverMysql:
+		switch period {
+		case STATS_PERIOD_DAY:
+			return "DATE_FORMAT(" + column + ", '%Y-%m-%d')", nil
+		case STATS_PERIOD_WEEK:
+			return "DATE_FORMAT(DATE_SUB(" + column + ", INTERVAL WEEKDAY(" + column + ") DAY), '%Y-%m-%d')", nil
+		case STATS_PERIOD_MONTH:
+			return "DATE_FORMAT(" + column + ", '%Y-%m')", nil
+		}
+	case contractsdatabase.DriverPostgres:
+		switch period {
+		case STATS_PERIOD_DAY:
+			return "to_char(" + column + ", 'YYYY-MM-DD')", nil
+		case STATS_PERIOD_WEEK:
+			return "to_char(date_trunc('week', " + column + "), 'YYYY-MM-DD')", nil
+		case STATS_PERIOD_MONTH:
+			return "to_char(" + column + ", 'YYYY-MM')", nil
+		}
+	default:
+		return "", errUnsupportedDialect("date bucketing", driver)
+	}
+
+	return "", errors.New("stats period must be one of day, week or month")
+}
+
+// secondsBetweenSQL returns the expression of the whole number of seconds
+// from the datetime column from to the datetime column to.
+func (st *storeImplementation) secondsBetweenSQL(from string, to string) (string, error) {
+	switch driver := st.dialect(); driver {
+	case contractsdatabase.DriverSqlite:
+		// SQLite stores datetimes as text, possibly followed by a time zone
+		return "CAST(ROUND((julianday(substr(" + to + ", 1, 19)) - julianday(substr(" + from + ", 1, 19))) * 86400) AS INTEGER)", nil
+	case contractsdatabase.DriverMysql:
+		return "TIMESTAMPDIFF(SECOND, " + from + ", " + to + ")", nil
+	case contractsdatabase.DriverPostgres:
+		return "CAST(EXTRACT(EPOCH FROM (" + to + " - " + from + ")) AS BIGINT)", nil
+	default:
+		return "", errUnsupportedDialect("response times", driver)
+	}
+}
+
+// rebind replaces the ? placeholders of a raw statement with the numbered
+// placeholders of Postgres, as neat executes raw statements as is.
+func (st *storeImplementation) rebind(sql string) string {
+	if st.dialect() != contractsdatabase.DriverPostgres {
+		return sql
+	}
+
+	var b strings.Builder
+	n := 0
+	for _, r := range sql {
+		if r == '?' {
+			n++
+			b.WriteString("$" + strconv.Itoa(n))
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// columnTypeLength returns the length of a column type such as varchar(21)
+// or character varying(21), and false when the type has none.
+func columnTypeLength(columnType string) (int, bool) {
+	start := strings.Index(columnType, "(")
+	end := strings.Index(columnType, ")")
+	if start < 0 || end < start {
+		return 0, false
+	}
+
+	length, err := strconv.Atoi(strings.TrimSpace(columnType[start+1 : end]))
+	if err != nil {
+		return 0, false
+	}
+
+	return length, true
+}
+
+// sqlValue converts the value for a raw statement the way neat does for its
+// own inserts: SQLite receives times as UTC datetime strings.
+func (st *storeImplementation) sqlValue(value any) any {
+	if t, ok := value.(time.Time); ok && st.dialect() == contractsdatabase.DriverSqlite {
+		return t.UTC().Format(time.DateTime)
+	}
+	return value
+}
+
+// insertSQL returns the statement inserting the row. The returned arguments
+// hold the row values in the order of the columns.
+func (st *storeImplementation) insertSQL(tableName string, row map[string]any) (string, []any) {
+	columns := slices.Sorted(maps.Keys(row))
+
+	quoted := make([]string, 0, len(columns))
+	args := make([]any, 0, len(columns))
+	for _, column := range columns {
+		quoted = append(quoted, st.quoteIdentifier(column))
+		args = append(args, st.sqlValue(row[column]))
+	}
+
+	sql := "INSERT INTO " + st.quoteIdentifier(tableName) + " (" + strings.Join(quoted, ", ") + ") VALUES (" + sqlPlaceholders(len(columns)) + ")"
+	return st.rebind(sql), args
+}
+
+// updateByIDSQL returns the statement updating the update columns of the row
+// with the ID of the given row, and incrementing its version.
+func (st *storeImplementation) updateByIDSQL(tableName string, row map[string]any, updateColumns []string) (string, []any) {
+	version := st.quoteIdentifier(COLUMN_VERSION)
+
+	sets := make([]string, 0, len(updateColumns)+1)
+	args := make([]any, 0, len(updateColumns)+1)
+	for _, column := range updateColumns {
+		sets = append(sets, st.quoteIdentifier(column)+" = ?")
+		args = append(args, st.sqlValue(row[column]))
+	}
+	sets = append(sets, version+" = "+version+" + 1")
+	args = append(args, row[COLUMN_ID])
+
+	sql := "UPDATE " + st.quoteIdentifier(tableName) + " SET " + strings.Join(sets, ", ") + " WHERE " + st.quoteIdentifier(COLUMN_ID) + " = ?"
+	return st.rebind(sql), args
+}
+
+// upsertSQL returns the statement inserting the row, or updating the update
+// columns of the existing row with the same ID and incrementing its version.
+// The returned arguments hold the row values in the order of the columns.
+// The conflict is on the ID only, so a row colliding on another unique key
+// fails to insert. MySQL has no such statement, see upsert.
+func (st *storeImplementation) upsertSQL(tableName string, row map[string]any, updateColumns []string) (string, []any, error) {
+	switch driver := st.dialect(); driver {
+	case contractsdatabase.DriverSqlite, contractsdatabase.DriverPostgres:
+		insert, args := st.insertSQL(tableName, row)
+
+		table := st.quoteIdentifier(tableName)
+		version := st.quoteIdentifier(COLUMN_VERSION)
+
+		sets := make([]string, 0, len(updateColumns)+1)
+		for _, column := range updateColumns {
+			sets = append(sets, st.quoteIdentifier(column)+" = excluded."+st.quoteIdentifier(column))
+		}
+		sets = append(sets, version+" = "+table+"."+version+" + 1")
+
+		return insert + " ON CONFLICT (" + st.quoteIdentifier(COLUMN_ID) + ") DO UPDATE SET " + strings.Join(sets, ", "), args, nil
+	default:
+		return "", nil, errUnsupportedDialect("upsert", driver)
+	}
+}
+
+// upsert inserts the row in the transaction, or updates the update columns
+// of the existing row with the same ID and increments its version.
+func (st *storeImplementation) upsert(tx contractsorm.Query, tableName string, row map[string]any, updateColumns []string) error {
+	if st.dialect() != contractsdatabase.DriverMysql {
+		sql, args, err := st.upsertSQL(tableName, row, updateColumns)
+		if err != nil {
+			return err
+		}
+
+		_, err = txQuery(tx).Exec(sql, args...)
+		return err
+	}
+
+	return st.upsertByID(tx, tableName, row, updateColumns)
+}
+
+// upsertByID looks up the row by its ID in the transaction, then updates or
+// inserts it. It is used for MySQL, where ON DUPLICATE KEY UPDATE fires on
+// any unique key and would overwrite e.g. the chat holding the same direct
+// key. A row colliding on another unique key fails to insert instead.
+func (st *storeImplementation) upsertByID(tx contractsorm.Query, tableName string, row map[string]any, updateColumns []string) error {
+	var count int64
+	err := txQuery(tx).Table(tableName).Where(COLUMN_ID+" = ?", row[COLUMN_ID]).Count(&count)
+	if err != nil {
+		return err
+	}
+
+	sql, args := st.insertSQL(tableName, row)
+	if count > 0 {
+		sql, args = st.updateByIDSQL(tableName, row, updateColumns)
+	}
+
+	_, err = txQuery(tx).Exec(sql, args...)
+	return err
+}
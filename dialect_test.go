@@ -0,0 +1,140 @@
+package chatstore
+
+import (
+	"database/sql"
+	"testing"
+
+	"github.com/dracory/neat"
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	neatdatabase "github.com/dracory/neat/database"
+	_ "modernc.org/sqlite"
+)
+
+func initDialectStore(t *testing.T, driver string) *storeImplementation {
+	db, err := sql.Open("sqlite", ":memory:?parseTime=true")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if driver == "" {
+		store, err := NewStore(NewStoreOptions{
+			DB:                 db,
+			TableChatName:      "chat",
+			TableMessageName:   "message",
+			AutomigrateEnabled: true,
+		})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return store.(*storeImplementation)
+	}
+
+	// The statements are only generated, never run, for another driver
+	neatDB, err := neat.NewFromSQLDB(db, neatdatabase.WithDriver(driver))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	return &storeImplementation{db: neatDB}
+}
+
+func TestUpsertSQL(t *testing.T) {
+	row := map[string]any{COLUMN_ID: "1", COLUMN_TEXT: "Hello", COLUMN_VERSION: 1}
+
+	sqlite := initDialectStore(t, "")
+	sql, args, err := sqlite.upsertSQL("message", row, []string{COLUMN_TEXT})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// The conflict is on the ID only, never on another unique key
+	expected := `INSERT INTO "message" ("id", "text", "version") VALUES (?, ?, ?)` +
+		` ON CONFLICT ("id") DO UPDATE SET "text" = excluded."text", "version" = "message"."version" + 1`
+	if sql != expected {
+		t.Fatal("Unexpected upsert SQL:", sql)
+	}
+
+	if len(args) != 3 || args[0] != "1" || args[1] != "Hello" {
+		t.Fatal("Unexpected upsert arguments:", args)
+	}
+
+	mysql := initDialectStore(t, "mysql")
+	if _, _, err := mysql.upsertSQL("message", row, []string{COLUMN_TEXT}); err == nil {
+		t.Fatal("Expected no single statement upsert for MySQL")
+	}
+
+	sql, _ = mysql.insertSQL("message", row)
+	if sql != "INSERT INTO `message` (`id`, `text`, `version`) VALUES (?, ?, ?)" {
+		t.Fatal("Unexpected insert SQL:", sql)
+	}
+
+	sql, args = mysql.updateByIDSQL("message", row, []string{COLUMN_TEXT})
+	if sql != "UPDATE `message` SET `text` = ?, `version` = `version` + 1 WHERE `id` = ?" {
+		t.Fatal("Unexpected update SQL:", sql)
+	}
+
+	if len(args) != 2 || args[0] != "Hello" || args[1] != "1" {
+		t.Fatal("Unexpected update arguments:", args)
+	}
+}
+
+func TestUpsertByID(t *testing.T) {
+	store := initDialectStore(t, "")
+
+	columns := []string{COLUMN_TITLE, COLUMN_DIRECT_KEY}
+	upsert := func(chat ChatInterface) error {
+		return store.db.Query().Transaction(func(tx contractsorm.Query) error {
+			return store.upsertByID(tx, store.tableChat, chatInsertRow(chat), columns)
+		})
+	}
+
+	chat := NewChat().SetOwnerID("user1").SetTitle("Direct").SetDirectKey("user1:user2")
+	if err := upsert(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat.SetTitle("Renamed")
+	if err := upsert(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Another chat with the same direct key fails, instead of updating the first
+	other := NewChat().SetOwnerID("user2").SetTitle("Other").SetDirectKey("user1:user2")
+	if err := upsert(other); err == nil {
+		t.Fatal("Expected an error for a direct key collision")
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.Title() != "Renamed" {
+		t.Fatal("Expected the chat to be renamed")
+	}
+
+	if found.Version() != chat.Version()+1 {
+		t.Fatal("Expected the version to be incremented, got", found.Version())
+	}
+
+	missing, err := store.ChatFindByID(other.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if missing != nil {
+		t.Fatal("Expected the colliding chat not to be inserted")
+	}
+}
+
+func TestColumnTypeLength(t *testing.T) {
+	for columnType, expected := range map[string]int{"varchar(21)": 21, "character varying(40)": 40} {
+		length, ok := columnTypeLength(columnType)
+		if !ok || length != expected {
+			t.Fatal("Unexpected length of", columnType, length)
+		}
+	}
+
+	if _, ok := columnTypeLength("text"); ok {
+		t.Fatal("Expected no length for text")
+	}
+}
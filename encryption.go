@@ -0,0 +1,151 @@
+package chatstore
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Encryptor encrypts the text, memo and metas of the messages at rest.
+// Each value is encrypted with the current key and tagged with its ID,
+// so that the keys can be rotated: values encrypted with an older key
+// still decrypt, and MessageReencrypt moves them to the current key.
+type Encryptor interface {
+	// Encrypt returns the value encrypted with the current key
+	Encrypt(plaintext string) (string, error)
+	// Decrypt returns the plaintext of a value encrypted with any of the
+	// keys, or the value as is when it is not encrypted
+	Decrypt(value string) (string, error)
+	// KeyID returns the ID of the key the value is encrypted with,
+	// empty when it is not encrypted
+	KeyID(value string) string
+	// CurrentKeyID returns the ID of the key new values are encrypted with
+	CurrentKeyID() string
+}
+
+// aesGCMPrefix starts the values encrypted by the AES-GCM encryptor, which
+// are formatted as enc:<key ID>:<base64 of the version, nonce and sealed value>
+const aesGCMPrefix = "enc:"
+
+// aesGCMVersion is the version byte starting the encrypted payload, which
+// together with its length tells the encrypted values from plain text that
+// happens to start with the prefix
+const aesGCMVersion byte = 1
+
+// aesGCMMinLength is the length of the payload of an encrypted empty value:
+// the version byte, the standard nonce and the authentication tag
+const aesGCMMinLength = 1 + 12 + 16
+
+// NewAESGCMEncryptor returns an AES-GCM encryptor with the keys (16, 24 or
+// 32 bytes long, for AES-128, AES-192 or AES-256) keyed by their IDs, new
+// values being encrypted with the key of the current key ID. Values stored
+// before encryption was enabled are returned as is by Decrypt.
+func NewAESGCMEncryptor(currentKeyID string, keys map[string][]byte) (Encryptor, error) {
+	if _, ok := keys[currentKeyID]; !ok {
+		return nil, fmt.Errorf("encryptor: current key %q is missing", currentKeyID)
+	}
+
+	aeads := make(map[string]cipher.AEAD, len(keys))
+	for keyID, key := range keys {
+		if keyID == "" || strings.Contains(keyID, ":") {
+			return nil, fmt.Errorf("encryptor: key ID %q must be non empty and may not contain a colon", keyID)
+		}
+
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("encryptor: key %q: %w", keyID, err)
+		}
+
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("encryptor: key %q: %w", keyID, err)
+		}
+
+		aeads[keyID] = aead
+	}
+
+	return &aesGCMEncryptor{currentKeyID: currentKeyID, aeads: aeads}, nil
+}
+
+// aesGCMEncryptor is the AES-GCM Encryptor.
+type aesGCMEncryptor struct {
+	currentKeyID string
+	aeads        map[string]cipher.AEAD
+}
+
+// Encrypt seals the plaintext with the current key and a random nonce,
+// authenticating the key ID with it.
+func (e *aesGCMEncryptor) Encrypt(plaintext string) (string, error) {
+	aead := e.aeads[e.currentKeyID]
+
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	payload := append([]byte{aesGCMVersion}, nonce...)
+	payload = aead.Seal(payload, nonce, []byte(plaintext), []byte(e.currentKeyID))
+	return aesGCMPrefix + e.currentKeyID + ":" + base64.StdEncoding.EncodeToString(payload), nil
+}
+
+// Decrypt opens the value with the key it was encrypted with.
+func (e *aesGCMEncryptor) Decrypt(value string) (string, error) {
+	keyID, payload, ok := aesGCMParse(value)
+	if !ok {
+		return value, nil
+	}
+
+	aead, ok := e.aeads[keyID]
+	if !ok {
+		return "", fmt.Errorf("encryptor: unknown key %q", keyID)
+	}
+
+	sealed := payload[1:]
+	if len(sealed) < aead.NonceSize()+aead.Overhead() {
+		return "", errors.New("encryptor: malformed value: too short")
+	}
+
+	nonce, ciphertext := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(keyID))
+	if err != nil {
+		return "", fmt.Errorf("encryptor: %w", err)
+	}
+
+	return string(plaintext), nil
+}
+
+// KeyID returns the key ID the value is tagged with.
+func (e *aesGCMEncryptor) KeyID(value string) string {
+	keyID, _, _ := aesGCMParse(value)
+	return keyID
+}
+
+// aesGCMParse returns the key ID and the decoded payload of the encrypted
+// value. Values which are not a well formed envelope, e.g. plain text stored
+// before encryption was enabled, are reported as not encrypted.
+func aesGCMParse(value string) (string, []byte, bool) {
+	if !strings.HasPrefix(value, aesGCMPrefix) {
+		return "", nil, false
+	}
+
+	keyID, encoded, ok := strings.Cut(strings.TrimPrefix(value, aesGCMPrefix), ":")
+	if !ok || keyID == "" {
+		return "", nil, false
+	}
+
+	payload, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(payload) < aesGCMMinLength || payload[0] != aesGCMVersion {
+		return "", nil, false
+	}
+
+	return keyID, payload, true
+}
+
+// CurrentKeyID returns the ID of the current key.
+func (e *aesGCMEncryptor) CurrentKeyID() string {
+	return e.currentKeyID
+}
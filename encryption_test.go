@@ -0,0 +1,72 @@
+package chatstore_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestAESGCMEncryptor(t *testing.T) {
+	oldKey := bytes.Repeat([]byte{1}, 32)
+	newKey := bytes.Repeat([]byte{2}, 32)
+
+	old, err := chatstore.NewAESGCMEncryptor("k1", map[string][]byte{"k1": oldKey})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	encrypted, err := old.Encrypt("Hello")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if strings.Contains(encrypted, "Hello") || old.KeyID(encrypted) != "k1" {
+		t.Fatal("unexpected encrypted value:", encrypted)
+	}
+
+	// After the rotation, the old values still decrypt
+	rotated, err := chatstore.NewAESGCMEncryptor("k2", map[string][]byte{"k1": oldKey, "k2": newKey})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	decrypted, err := rotated.Decrypt(encrypted)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if decrypted != "Hello" {
+		t.Fatal("expected Hello, got", decrypted)
+	}
+
+	// Values stored before encryption was enabled are returned as is
+	if plain, err := rotated.Decrypt("plain text"); err != nil || plain != "plain text" {
+		t.Fatal("expected the plain text, got", plain, err)
+	}
+
+	// Also when they look like an encrypted value
+	for _, plain := range []string{"enc:k1:hello", "enc:k1:", "enc:unknown:" + strings.Repeat("A", 40)} {
+		if rotated.KeyID(plain) != "" {
+			t.Fatalf("expected %q not to be encrypted", plain)
+		}
+
+		if decrypted, err := rotated.Decrypt(plain); err != nil || decrypted != plain {
+			t.Fatal("expected the plain text, got", decrypted, err)
+		}
+	}
+
+	tampered := encrypted[:len(encrypted)-2] + "AA"
+	if _, err := rotated.Decrypt(tampered); err == nil {
+		t.Fatal("expected an error for a tampered value")
+	}
+
+	if _, err := chatstore.NewAESGCMEncryptor("k1", map[string][]byte{"k1": []byte("short")}); err == nil {
+		t.Fatal("expected an error for an invalid key size")
+	}
+
+	if _, err := chatstore.NewAESGCMEncryptor("k3", map[string][]byte{"k1": oldKey}); err == nil {
+		t.Fatal("expected an error for a missing current key")
+	}
+}
@@ -0,0 +1,38 @@
+package chatstore
+
+import "errors"
+
+// ErrStaleEntity is returned when an update is rejected because the record
+// was modified by someone else since it was loaded. Reload and retry.
+var ErrStaleEntity = errors.New("chat store: entity was modified concurrently")
+
+// ErrNotFound is returned when the record to change does not exist.
+var ErrNotFound = errors.New("chat store: record not found")
+
+// ErrInvalidStatus is returned when a chat or message has a status which
+// is not registered on the status machine of the store.
+var ErrInvalidStatus = errors.New("chat store: invalid status")
+
+// ErrInvalidStatusTransition is returned when a chat or message is updated
+// to a status which it is not allowed to move to from its stored status.
+var ErrInvalidStatusTransition = errors.New("chat store: status transition not allowed")
+
+// ErrValidation is matched by the ValidationErrors returned when a chat or
+// message has fields which are missing or too long.
+var ErrValidation = errors.New("chat store: validation failed")
+
+// ErrMessageRejected is returned when the moderator rejects a message.
+// The error holds the reason of the rejection.
+var ErrMessageRejected = errors.New("chat store: message rejected by moderation")
+
+// ErrEncryptedField is returned when an operation needs the database to
+// read a message field which is encrypted, such as filtering by metas.
+var ErrEncryptedField = errors.New("chat store: not supported on encrypted fields")
+
+// ErrDirectKey is returned when the direct key of a chat is set or changed
+// other than by ChatFindOrCreateDirect, which manages the direct keys.
+var ErrDirectKey = errors.New("chat store: the direct key is managed by the store")
+
+// ErrForbidden is returned when the policy of a user view of the store
+// does not allow the user to perform the operation.
+var ErrForbidden = errors.New("chat store: operation not allowed")
@@ -0,0 +1,44 @@
+package chatstore
+
+import "regexp"
+
+// Mention is a user mentioned in the text of a message
+type Mention struct {
+	MessageID string
+	UserID    string
+	// Offset is the byte offset of the mention in the text of the message
+	Offset int
+}
+
+// MentionParser finds the users mentioned in the text of a message.
+// The store parses the text when a message is created or its text is updated.
+type MentionParser interface {
+	// Parse returns the mentions in the text, the message ID left empty
+	Parse(text string) []Mention
+}
+
+// mentionRegexp matches an @ followed by a user ID, not preceded by a word
+// character (as in an email address) nor ending in a dot or dash
+var mentionRegexp = regexp.MustCompile(`(?:^|[^A-Za-z0-9_])(@[A-Za-z0-9_](?:[A-Za-z0-9_.\-]*[A-Za-z0-9_])?)`)
+
+// NewMentionParser returns the default mention parser, which takes the
+// word following an @ as the ID of the mentioned user, e.g. "@alice".
+func NewMentionParser() MentionParser {
+	return mentionParserImplementation{}
+}
+
+// mentionParserImplementation is the default MentionParser.
+type mentionParserImplementation struct{}
+
+// Parse returns the @ mentions in the text.
+func (mentionParserImplementation) Parse(text string) []Mention {
+	mentions := []Mention{}
+	for _, match := range mentionRegexp.FindAllStringSubmatchIndex(text, -1) {
+		start, end := match[2], match[3]
+		mentions = append(mentions, Mention{
+			UserID: text[start+1 : end],
+			Offset: start,
+		})
+	}
+	return mentions
+}
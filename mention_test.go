@@ -0,0 +1,31 @@
+package chatstore_test
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestMentionParser(t *testing.T) {
+	parser := chatstore.NewMentionParser()
+
+	testCases := []struct {
+		text     string
+		expected []chatstore.Mention
+	}{
+		{"no mentions here", []chatstore.Mention{}},
+		{"@alice hello", []chatstore.Mention{{UserID: "alice", Offset: 0}}},
+		{"hi @bob and @carol.", []chatstore.Mention{{UserID: "bob", Offset: 3}, {UserID: "carol", Offset: 12}}},
+		{"(@dave_1)", []chatstore.Mention{{UserID: "dave_1", Offset: 1}}},
+		{"mail me at erin@example.com", []chatstore.Mention{}},
+		{"just an @ sign", []chatstore.Mention{}},
+	}
+
+	for _, tc := range testCases {
+		mentions := parser.Parse(tc.text)
+		if !reflect.DeepEqual(mentions, tc.expected) {
+			t.Fatalf("%q: expected %v, got %v", tc.text, tc.expected, mentions)
+		}
+	}
+}
@@ -3,6 +3,9 @@ package chatstore
 import (
 	"encoding/json"
 	"maps"
+	"slices"
+	"strconv"
+	"time"
 
 	"github.com/dracory/neat/database/orm"
 	"github.com/dracory/neat/database/soft_delete"
@@ -32,6 +35,34 @@ type MessageInterface interface {
 	Memo() string
 	SetMemo(memo string) MessageInterface
 
+	ClientMessageID() string
+	SetClientMessageID(clientMessageID string) MessageInterface
+
+	ScheduledAt() string
+	ScheduledAtCarbon() *carbon.Carbon
+	SetScheduledAt(scheduledAt string) MessageInterface
+
+	ExpiresAt() string
+	ExpiresAtCarbon() *carbon.Carbon
+	SetExpiresAt(expiresAt string) MessageInterface
+	IsExpired() bool
+
+	DeliveryStatus() string
+	SetDeliveryStatus(deliveryStatus string) MessageInterface
+
+	ModerationState() string
+	SetModerationState(moderationState string) MessageInterface
+
+	TenantID() string
+	SetTenantID(tenantID string) MessageInterface
+
+	IsPinned() bool
+	PinnedAt() string
+	PinnedAtCarbon() *carbon.Carbon
+	SetPinnedAt(pinnedAt string) MessageInterface
+	PinnedBy() string
+	SetPinnedBy(userID string) MessageInterface
+
 	Meta(key string) (string, error)
 	SetMeta(key string, value string) error
 
@@ -39,6 +70,13 @@ type MessageInterface interface {
 	SetMetas(metas map[string]string) error
 	UpsertMetas(metas map[string]string) error
 
+	MetaBool(key string) (bool, error)
+	MetaFloat(key string) (float64, error)
+	MetaInt(key string) (int64, error)
+	MetaJSON(key string, dest any) error
+	MetaTime(key string) (time.Time, error)
+	SetMetaValue(key string, value any) error
+
 	Text() string
 	SetText(text string) MessageInterface
 
@@ -54,7 +92,16 @@ type MessageInterface interface {
 	UpdatedAtCarbon() *carbon.Carbon
 	SetUpdatedAt(updatedAt string) MessageInterface
 
+	Version() int64
+	SetVersion(version int64) MessageInterface
+
+	IsDirty() bool
+	DirtyFields() []string
 	MarkAsNotDirty()
+
+	// Validate returns ValidationErrors with all the fields which are
+	// missing or longer than their columns, nil when the message is valid
+	Validate() error
 }
 
 var _ MessageInterface = (*messageImplementation)(nil)
@@ -65,16 +112,28 @@ var _ MessageInterface = (*messageImplementation)(nil)
 type messageImplementation struct {
 	orm.ShortID
 
-	ChatIDField      string `db:"chat_id"`
-	StatusField      string `db:"status"`
-	SenderIDField    string `db:"sender_id"`
-	RecipientIDField string `db:"recipient_id"`
-	TextField        string `db:"text"`
-	MemoField        string `db:"memo"`
-	MetasField       string `db:"metas"`
-	CreatedAtField   orm.CreatedAt
-	UpdatedAtField   orm.UpdatedAt
+	ChatIDField          string    `db:"chat_id"`
+	StatusField          string    `db:"status"`
+	SenderIDField        string    `db:"sender_id"`
+	RecipientIDField     string    `db:"recipient_id"`
+	TextField            string    `db:"text"`
+	MemoField            string    `db:"memo"`
+	ClientMessageIDField string    `db:"client_message_id"`
+	ScheduledAtField     time.Time `db:"scheduled_at"`
+	ExpiresAtField       time.Time `db:"expires_at"`
+	DeliveryStatusField  string    `db:"delivery_status"`
+	PinnedAtField        time.Time `db:"pinned_at"`
+	PinnedByField        string    `db:"pinned_by"`
+	ModerationStateField string    `db:"moderation_state"`
+	TenantIDField        string    `db:"tenant_id"`
+	MetasField           string    `db:"metas"`
+	VersionField         int64     `db:"version"`
+	CreatedAtField       orm.CreatedAt
+	UpdatedAtField       orm.UpdatedAt
 	soft_delete.SoftDeletesMaxDate
+
+	// dirty holds the columns changed since the message was last persisted
+	dirty map[string]bool
 }
 
 // == CONSTRUCTORS ============================================================
@@ -102,6 +161,14 @@ func NewMessageFromExistingData(data map[string]string) MessageInterface {
 	o.SetRecipientID(data[COLUMN_RECIPIENT_ID])
 	o.SetText(data[COLUMN_TEXT])
 	o.SetMemo(data[COLUMN_MEMO])
+	o.SetClientMessageID(data[COLUMN_CLIENT_MESSAGE_ID])
+	o.SetScheduledAt(data[COLUMN_SCHEDULED_AT])
+	o.SetExpiresAt(data[COLUMN_EXPIRES_AT])
+	o.SetDeliveryStatus(data[COLUMN_DELIVERY_STATUS])
+	o.SetPinnedAt(data[COLUMN_PINNED_AT])
+	o.SetPinnedBy(data[COLUMN_PINNED_BY])
+	o.SetModerationState(data[COLUMN_MODERATION_STATE])
+	o.SetTenantID(data[COLUMN_TENANT_ID])
 	o.MetasField = data[COLUMN_METAS]
 	if v, ok := data[COLUMN_CREATED_AT]; ok {
 		o.SetCreatedAt(v)
@@ -112,11 +179,42 @@ func NewMessageFromExistingData(data map[string]string) MessageInterface {
 	if v, ok := data[COLUMN_SOFT_DELETED_AT]; ok {
 		o.SetSoftDeletedAt(v)
 	}
+	if v, ok := data[COLUMN_VERSION]; ok {
+		version, _ := strconv.ParseInt(v, 10, 64)
+		o.SetVersion(version)
+	}
+	o.MarkAsNotDirty()
 	return o
 }
 
 // == METHODS =================================================================
 
+// Validate checks the required fields and the column lengths of the message.
+func (o *messageImplementation) Validate() error {
+	errs := ValidationErrors{}
+	errs.fieldRequired(COLUMN_ID, o.ID())
+	errs.fieldMaxLength(COLUMN_ID, o.ID(), MAX_LENGTH_ID)
+	errs.fieldRequired(COLUMN_CHAT_ID, o.ChatID())
+	errs.fieldMaxLength(COLUMN_CHAT_ID, o.ChatID(), MAX_LENGTH_ID)
+	errs.fieldMaxLength(COLUMN_SENDER_ID, o.SenderID(), MAX_LENGTH_USER_ID)
+	errs.fieldMaxLength(COLUMN_RECIPIENT_ID, o.RecipientID(), MAX_LENGTH_USER_ID)
+	errs.fieldRequired(COLUMN_STATUS, o.Status())
+	errs.fieldMaxLength(COLUMN_STATUS, o.Status(), MAX_LENGTH_STATUS)
+	errs.fieldMaxLength(COLUMN_CLIENT_MESSAGE_ID, o.ClientMessageID(), MAX_LENGTH_KEY)
+	errs.fieldMaxLength(COLUMN_TENANT_ID, o.TenantID(), MAX_LENGTH_TENANT_ID)
+
+	// Without a scheduled time a scheduled message is never published
+	if o.Status() == MESSAGE_STATUS_SCHEDULED {
+		errs.fieldRequired(COLUMN_SCHEDULED_AT, o.ScheduledAt())
+	}
+
+	if len(o.Text()) > MAX_LENGTH_TEXT {
+		errs = append(errs, FieldError{Field: COLUMN_TEXT, Message: "must be at most " + strconv.Itoa(MAX_LENGTH_TEXT) + " bytes"})
+	}
+
+	return errs.errorOrNil()
+}
+
 // == SETTERS AND GETTERS =====================================================
 
 // ID returns the id of the message.
@@ -126,6 +224,9 @@ func (o *messageImplementation) ID() string {
 
 // SetID sets the id of the message.
 func (o *messageImplementation) SetID(id string) MessageInterface {
+	if o.ShortID.ID != id {
+		o.markDirty(COLUMN_ID)
+	}
 	o.ShortID.ID = id
 	return o
 }
@@ -137,6 +238,9 @@ func (o *messageImplementation) ChatID() string {
 
 // SetChatID sets the chat id of the message.
 func (o *messageImplementation) SetChatID(chatID string) MessageInterface {
+	if o.ChatIDField != chatID {
+		o.markDirty(COLUMN_CHAT_ID)
+	}
 	o.ChatIDField = chatID
 	return o
 }
@@ -148,6 +252,9 @@ func (o *messageImplementation) SenderID() string {
 
 // SetSenderID sets the sender id of the message.
 func (o *messageImplementation) SetSenderID(id string) MessageInterface {
+	if o.SenderIDField != id {
+		o.markDirty(COLUMN_SENDER_ID)
+	}
 	o.SenderIDField = id
 	return o
 }
@@ -159,6 +266,9 @@ func (o *messageImplementation) RecipientID() string {
 
 // SetRecipientID sets the recipient id of the message.
 func (o *messageImplementation) SetRecipientID(id string) MessageInterface {
+	if o.RecipientIDField != id {
+		o.markDirty(COLUMN_RECIPIENT_ID)
+	}
 	o.RecipientIDField = id
 	return o
 }
@@ -170,10 +280,172 @@ func (o *messageImplementation) Status() string {
 
 // SetStatus sets the status of the message.
 func (o *messageImplementation) SetStatus(status string) MessageInterface {
+	if o.StatusField != status {
+		o.markDirty(COLUMN_STATUS)
+	}
 	o.StatusField = status
 	return o
 }
 
+// ClientMessageID returns the idempotency key supplied by the client sending
+// the message, empty when none was supplied.
+func (o *messageImplementation) ClientMessageID() string {
+	return o.ClientMessageIDField
+}
+
+// SetClientMessageID sets the idempotency key supplied by the client sending
+// the message, unique within the chat.
+func (o *messageImplementation) SetClientMessageID(clientMessageID string) MessageInterface {
+	if o.ClientMessageIDField != clientMessageID {
+		o.markDirty(COLUMN_CLIENT_MESSAGE_ID)
+	}
+	o.ClientMessageIDField = clientMessageID
+	return o
+}
+
+// ScheduledAt returns the time the message is to be published at, empty when
+// the message is not scheduled.
+func (o *messageImplementation) ScheduledAt() string {
+	if o.ScheduledAtField.IsZero() {
+		return ""
+	}
+	return carbon.CreateFromStdTime(o.ScheduledAtField).ToDateTimeString()
+}
+
+// ScheduledAtCarbon returns the time the message is to be published at as a carbon object.
+func (o *messageImplementation) ScheduledAtCarbon() *carbon.Carbon {
+	return carbon.CreateFromStdTime(o.ScheduledAtField)
+}
+
+// SetScheduledAt sets the time the message is to be published at, empty to
+// publish it right away.
+func (o *messageImplementation) SetScheduledAt(scheduledAt string) MessageInterface {
+	value := time.Time{}
+	if scheduledAt != "" {
+		value = carbon.Parse(scheduledAt, carbon.UTC).StdTime()
+	}
+	if !o.ScheduledAtField.Equal(value) {
+		o.markDirty(COLUMN_SCHEDULED_AT)
+	}
+	o.ScheduledAtField = value
+	return o
+}
+
+// ExpiresAt returns the time the message disappears at, empty when the
+// message does not expire.
+func (o *messageImplementation) ExpiresAt() string {
+	if o.ExpiresAtField.IsZero() {
+		return ""
+	}
+	return carbon.CreateFromStdTime(o.ExpiresAtField).ToDateTimeString()
+}
+
+// ExpiresAtCarbon returns the time the message disappears at as a carbon object.
+func (o *messageImplementation) ExpiresAtCarbon() *carbon.Carbon {
+	return carbon.CreateFromStdTime(o.ExpiresAtField)
+}
+
+// SetExpiresAt sets the time the message disappears at, empty to keep the
+// message until it is deleted.
+func (o *messageImplementation) SetExpiresAt(expiresAt string) MessageInterface {
+	value := time.Time{}
+	if expiresAt != "" {
+		value = carbon.Parse(expiresAt, carbon.UTC).StdTime()
+	}
+	if !o.ExpiresAtField.Equal(value) {
+		o.markDirty(COLUMN_EXPIRES_AT)
+	}
+	o.ExpiresAtField = value
+	return o
+}
+
+// IsExpired returns whether the message has an expiry time which has passed.
+func (o *messageImplementation) IsExpired() bool {
+	return !o.ExpiresAtField.IsZero() && !o.ExpiresAtField.After(time.Now())
+}
+
+// DeliveryStatus returns the delivery status of the message aggregated over
+// its recipients, empty when the message has no deliveries.
+func (o *messageImplementation) DeliveryStatus() string {
+	return o.DeliveryStatusField
+}
+
+// SetDeliveryStatus sets the aggregated delivery status of the message.
+// The column is maintained by the store, so the message is not marked dirty.
+func (o *messageImplementation) SetDeliveryStatus(deliveryStatus string) MessageInterface {
+	o.DeliveryStatusField = deliveryStatus
+	return o
+}
+
+// ModerationState returns the moderation state of the message, one of the
+// MODERATION_STATE_* constants, empty when the message was allowed as is.
+func (o *messageImplementation) ModerationState() string {
+	return o.ModerationStateField
+}
+
+// SetModerationState sets the moderation state of the message.
+// The column is maintained by the store, so the message is not marked dirty.
+func (o *messageImplementation) SetModerationState(moderationState string) MessageInterface {
+	o.ModerationStateField = moderationState
+	return o
+}
+
+// TenantID returns the ID of the tenant of the message, empty when the
+// message was created outside of a tenant view.
+func (o *messageImplementation) TenantID() string {
+	return o.TenantIDField
+}
+
+// SetTenantID sets the ID of the tenant of the message.
+// The column is maintained by the store, so the message is not marked dirty.
+func (o *messageImplementation) SetTenantID(tenantID string) MessageInterface {
+	o.TenantIDField = tenantID
+	return o
+}
+
+// IsPinned returns whether the message is pinned to its chat.
+func (o *messageImplementation) IsPinned() bool {
+	return !o.PinnedAtField.IsZero()
+}
+
+// PinnedAt returns the time the message was pinned to its chat,
+// empty when it is not pinned.
+func (o *messageImplementation) PinnedAt() string {
+	if o.PinnedAtField.IsZero() {
+		return ""
+	}
+	return carbon.CreateFromStdTime(o.PinnedAtField).ToDateTimeString()
+}
+
+// PinnedAtCarbon returns the time the message was pinned to its chat as a carbon object.
+func (o *messageImplementation) PinnedAtCarbon() *carbon.Carbon {
+	return carbon.CreateFromStdTime(o.PinnedAtField)
+}
+
+// SetPinnedAt sets the time the message was pinned to its chat.
+// The column is maintained by the store, so the message is not marked dirty.
+func (o *messageImplementation) SetPinnedAt(pinnedAt string) MessageInterface {
+	if pinnedAt == "" {
+		o.PinnedAtField = time.Time{}
+		return o
+	}
+	o.PinnedAtField = carbon.Parse(pinnedAt, carbon.UTC).StdTime()
+	return o
+}
+
+// PinnedBy returns the ID of the user who pinned the message,
+// empty when it is not pinned.
+func (o *messageImplementation) PinnedBy() string {
+	return o.PinnedByField
+}
+
+// SetPinnedBy sets the ID of the user who pinned the message.
+// The column is maintained by the store, so the message is not marked dirty.
+func (o *messageImplementation) SetPinnedBy(userID string) MessageInterface {
+	o.PinnedByField = userID
+	return o
+}
+
 // Memo returns the memo of the message.
 func (o *messageImplementation) Memo() string {
 	return o.MemoField
@@ -181,6 +453,9 @@ func (o *messageImplementation) Memo() string {
 
 // SetMemo sets the memo of the message.
 func (o *messageImplementation) SetMemo(memo string) MessageInterface {
+	if o.MemoField != memo {
+		o.markDirty(COLUMN_MEMO)
+	}
 	o.MemoField = memo
 	return o
 }
@@ -201,18 +476,14 @@ func (o *messageImplementation) SetMeta(key string, value string) error {
 	})
 }
 
-// Metas returns the metas map of the message.
+// Metas returns the metas map of the message. Values which are not strings
+// (e.g. set with SetMetaValue) are returned as their JSON text.
 func (o *messageImplementation) Metas() (map[string]string, error) {
-	metasStr := o.MetasField
-	if metasStr == "" {
-		metasStr = "{}"
-	}
-	var metasJson map[string]string
-	errJson := json.Unmarshal([]byte(metasStr), &metasJson)
-	if errJson != nil {
-		return map[string]string{}, errJson
+	metas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return map[string]string{}, err
 	}
-	return metasJson, nil
+	return metasToStrings(metas), nil
 }
 
 // SetMetas sets the metas map of the message.
@@ -221,18 +492,115 @@ func (o *messageImplementation) SetMetas(metas map[string]string) error {
 	if err != nil {
 		return err
 	}
-	o.MetasField = string(mapString)
+	o.setMetasField(string(mapString))
 	return nil
 }
 
 // UpsertMetas merges the given metas into the existing metas.
 func (o *messageImplementation) UpsertMetas(metas map[string]string) error {
-	currentMetas, err := o.Metas()
+	currentMetas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return err
+	}
+	for key, value := range metas {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return err
+		}
+		currentMetas[key] = raw
+	}
+	return o.setMetasRaw(currentMetas)
+}
+
+// MetaBool returns a meta value by key as a boolean, or false if not set.
+func (o *messageImplementation) MetaBool(key string) (bool, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return false, err
+	}
+	return metaRawBool(key, raw)
+}
+
+// MetaFloat returns a meta value by key as a float, or 0 if not set.
+func (o *messageImplementation) MetaFloat(key string) (float64, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return 0, err
+	}
+	return metaRawFloat(key, raw)
+}
+
+// MetaInt returns a meta value by key as an integer, or 0 if not set.
+func (o *messageImplementation) MetaInt(key string) (int64, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return 0, err
+	}
+	return metaRawInt(key, raw)
+}
+
+// MetaJSON unmarshals a meta value by key into dest, leaving dest untouched if not set.
+func (o *messageImplementation) MetaJSON(key string, dest any) error {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return err
+	}
+	return metaRawJSON(key, raw, dest)
+}
+
+// MetaTime returns a meta value by key as a time, or the zero time if not set.
+func (o *messageImplementation) MetaTime(key string) (time.Time, error) {
+	raw, err := o.metaRaw(key)
+	if err != nil || raw == nil {
+		return time.Time{}, err
+	}
+	return metaRawTime(key, raw)
+}
+
+// SetMetaValue sets a single meta key to any JSON encodable value
+// (e.g. numbers, booleans, times, slices, maps or structs).
+func (o *messageImplementation) SetMetaValue(key string, value any) error {
+	raw, err := json.Marshal(value)
 	if err != nil {
 		return err
 	}
-	maps.Copy(currentMetas, metas)
-	return o.SetMetas(currentMetas)
+	metas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return err
+	}
+	metas[key] = raw
+	return o.setMetasRaw(metas)
+}
+
+// metaRaw returns the raw JSON value of the meta key, or nil if not set.
+func (o *messageImplementation) metaRaw(key string) (json.RawMessage, error) {
+	metas, err := metasDecode(o.MetasField)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := metas[key]
+	if !ok || string(raw) == "null" {
+		return nil, nil
+	}
+	return raw, nil
+}
+
+// setMetasRaw sets the metas of the message from their raw JSON values.
+func (o *messageImplementation) setMetasRaw(metas map[string]json.RawMessage) error {
+	metasJSON, err := metasEncode(metas)
+	if err != nil {
+		return err
+	}
+	o.setMetasField(metasJSON)
+	return nil
+}
+
+// setMetasField sets the metas JSON of the message, marking it dirty if changed.
+func (o *messageImplementation) setMetasField(metasJSON string) {
+	if o.MetasField != metasJSON {
+		o.markDirty(COLUMN_METAS)
+	}
+	o.MetasField = metasJSON
 }
 
 // Text returns the text of the message.
@@ -242,6 +610,9 @@ func (o *messageImplementation) Text() string {
 
 // SetText sets the text of the message.
 func (o *messageImplementation) SetText(text string) MessageInterface {
+	if o.TextField != text {
+		o.markDirty(COLUMN_TEXT)
+	}
 	o.TextField = text
 	return o
 }
@@ -264,7 +635,11 @@ func (o *messageImplementation) SetCreatedAt(createdAt string) MessageInterface
 	if createdAt == "" {
 		return o
 	}
-	o.CreatedAtField.CreatedAt = carbon.Parse(createdAt, carbon.UTC).StdTime()
+	value := carbon.Parse(createdAt, carbon.UTC).StdTime()
+	if !o.CreatedAtField.CreatedAt.Equal(value) {
+		o.markDirty(COLUMN_CREATED_AT)
+	}
+	o.CreatedAtField.CreatedAt = value
 	return o
 }
 
@@ -286,10 +661,27 @@ func (o *messageImplementation) SetSoftDeletedAt(softDeletedAt string) MessageIn
 	if softDeletedAt == "" {
 		return o
 	}
-	o.SoftDeletesMaxDate.SoftDeletedAt = carbon.Parse(softDeletedAt, carbon.UTC).StdTime()
+	value := carbon.Parse(softDeletedAt, carbon.UTC).StdTime()
+	if !o.SoftDeletesMaxDate.SoftDeletedAt.Equal(value) {
+		o.markDirty(COLUMN_SOFT_DELETED_AT)
+	}
+	o.SoftDeletesMaxDate.SoftDeletedAt = value
 	return o
 }
 
+// SoftDeletedCondition returns the condition matching the soft deleted
+// messages, used by neat. The soft delete times are stored in UTC, so they
+// are compared with the current time in UTC, whatever the local time zone.
+func (o *messageImplementation) SoftDeletedCondition(quoteIdentifier func(string) string) (string, []any) {
+	return quoteIdentifier(COLUMN_SOFT_DELETED_AT) + " <= ?", []any{time.Now().UTC()}
+}
+
+// NotSoftDeletedCondition returns the condition matching the messages not
+// soft deleted, used by neat, comparing in UTC as SoftDeletedCondition.
+func (o *messageImplementation) NotSoftDeletedCondition(quoteIdentifier func(string) string) (string, []any) {
+	return quoteIdentifier(COLUMN_SOFT_DELETED_AT) + " > ?", []any{time.Now().UTC()}
+}
+
 // UpdatedAt returns the updated at time of the message.
 func (o *messageImplementation) UpdatedAt() string {
 	if o.UpdatedAtField.UpdatedAt.IsZero() {
@@ -308,10 +700,44 @@ func (o *messageImplementation) SetUpdatedAt(updatedAt string) MessageInterface
 	if updatedAt == "" {
 		return o
 	}
-	o.UpdatedAtField.UpdatedAt = carbon.Parse(updatedAt, carbon.UTC).StdTime()
+	value := carbon.Parse(updatedAt, carbon.UTC).StdTime()
+	if !o.UpdatedAtField.UpdatedAt.Equal(value) {
+		o.markDirty(COLUMN_UPDATED_AT)
+	}
+	o.UpdatedAtField.UpdatedAt = value
+	return o
+}
+
+// Version returns the optimistic locking version of the message.
+func (o *messageImplementation) Version() int64 {
+	return o.VersionField
+}
+
+// SetVersion sets the optimistic locking version of the message.
+func (o *messageImplementation) SetVersion(version int64) MessageInterface {
+	o.VersionField = version
 	return o
 }
 
-// MarkAsNotDirty is a no-op for backward compatibility.
+// IsDirty returns true if the message has changes which are not yet persisted.
+func (o *messageImplementation) IsDirty() bool {
+	return len(o.dirty) > 0
+}
+
+// DirtyFields returns the sorted column names changed since the message was last persisted.
+func (o *messageImplementation) DirtyFields() []string {
+	return slices.Sorted(maps.Keys(o.dirty))
+}
+
+// MarkAsNotDirty clears the changes, marking the message as persisted.
 func (o *messageImplementation) MarkAsNotDirty() {
+	o.dirty = nil
+}
+
+// markDirty records the column as changed since the message was last persisted.
+func (o *messageImplementation) markDirty(column string) {
+	if o.dirty == nil {
+		o.dirty = map[string]bool{}
+	}
+	o.dirty[column] = true
 }
@@ -0,0 +1,56 @@
+package chatstore
+
+import "slices"
+
+// MessageDelivery holds the delivery of a message to one of its recipients
+type MessageDelivery struct {
+	MessageID   string
+	RecipientID string
+	// Status is one of the DELIVERY_STATUS_* constants
+	Status string
+	// Attempts is the number of failed delivery attempts
+	Attempts int64
+	// FailureReason describes the last failed attempt, empty when none failed
+	FailureReason string
+	CreatedAt     string
+	UpdatedAt     string
+}
+
+// deliveryStatusesFrom returns the statuses a delivery may move from to the
+// given status, so that late or duplicate receipts never move it backwards.
+func deliveryStatusesFrom(status string) []string {
+	switch status {
+	case DELIVERY_STATUS_SENT:
+		return []string{DELIVERY_STATUS_FAILED}
+	case DELIVERY_STATUS_DELIVERED:
+		return []string{DELIVERY_STATUS_SENT, DELIVERY_STATUS_FAILED}
+	case DELIVERY_STATUS_READ:
+		return []string{DELIVERY_STATUS_SENT, DELIVERY_STATUS_FAILED, DELIVERY_STATUS_DELIVERED}
+	case DELIVERY_STATUS_FAILED:
+		// Failing again counts another attempt
+		return []string{DELIVERY_STATUS_SENT, DELIVERY_STATUS_FAILED}
+	default:
+		return nil
+	}
+}
+
+// deliveryStatusAggregate returns the delivery status of a message from the
+// statuses of its deliveries: failed when any failed, otherwise the least
+// advanced status, empty when there are no deliveries.
+func deliveryStatusAggregate(statuses []string) string {
+	if len(statuses) == 0 {
+		return ""
+	}
+
+	if slices.Contains(statuses, DELIVERY_STATUS_FAILED) {
+		return DELIVERY_STATUS_FAILED
+	}
+
+	for _, status := range []string{DELIVERY_STATUS_SENT, DELIVERY_STATUS_DELIVERED} {
+		if slices.Contains(statuses, status) {
+			return status
+		}
+	}
+
+	return DELIVERY_STATUS_READ
+}
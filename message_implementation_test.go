@@ -1,7 +1,10 @@
 package chatstore
 
 import (
+	"errors"
+	"strings"
 	"testing"
+	"time"
 )
 
 func TestNewMessage(t *testing.T) {
@@ -419,6 +422,125 @@ func TestMessageUpsertMetas(t *testing.T) {
 	}
 }
 
+func TestMessageTypedMetas(t *testing.T) {
+	message := NewMessage()
+
+	type escalation struct {
+		Level int      `json:"level"`
+		Teams []string `json:"teams"`
+	}
+
+	sentAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+
+	values := map[string]any{
+		"retries":    3,
+		"score":      0.75,
+		"urgent":     true,
+		"sent_at":    sentAt,
+		"escalation": escalation{Level: 2, Teams: []string{"backend", "ops"}},
+	}
+
+	for key, value := range values {
+		if err := message.SetMetaValue(key, value); err != nil {
+			t.Fatalf("Failed to set meta %s: %v", key, err)
+		}
+	}
+
+	retries, err := message.MetaInt("retries")
+	if err != nil || retries != 3 {
+		t.Errorf("Expected retries 3, got %d (%v)", retries, err)
+	}
+
+	score, err := message.MetaFloat("score")
+	if err != nil || score != 0.75 {
+		t.Errorf("Expected score 0.75, got %f (%v)", score, err)
+	}
+
+	urgent, err := message.MetaBool("urgent")
+	if err != nil || !urgent {
+		t.Errorf("Expected urgent true, got %t (%v)", urgent, err)
+	}
+
+	parsedSentAt, err := message.MetaTime("sent_at")
+	if err != nil || !parsedSentAt.Equal(sentAt) {
+		t.Errorf("Expected sent_at %v, got %v (%v)", sentAt, parsedSentAt, err)
+	}
+
+	var parsedEscalation escalation
+	err = message.MetaJSON("escalation", &parsedEscalation)
+	if err != nil || parsedEscalation.Level != 2 || len(parsedEscalation.Teams) != 2 {
+		t.Errorf("Expected escalation level 2 with 2 teams, got %+v (%v)", parsedEscalation, err)
+	}
+
+	// Typed values remain readable as strings
+	metas, err := message.Metas()
+	if err != nil {
+		t.Fatalf("Failed to get metas: %v", err)
+	}
+
+	if metas["retries"] != "3" || metas["urgent"] != "true" {
+		t.Errorf("Expected string values 3 and true, got %s and %s", metas["retries"], metas["urgent"])
+	}
+
+	// Upserting string metas keeps the typed values
+	err = message.UpsertMetas(map[string]string{"team": "backend"})
+	if err != nil {
+		t.Fatalf("Failed to upsert metas: %v", err)
+	}
+
+	urgent, err = message.MetaBool("urgent")
+	if err != nil || !urgent {
+		t.Errorf("Expected urgent to remain true, got %t (%v)", urgent, err)
+	}
+
+	// Missing keys return zero values
+	missing, err := message.MetaInt("missing")
+	if err != nil || missing != 0 {
+		t.Errorf("Expected missing meta to be 0, got %d (%v)", missing, err)
+	}
+
+	// Non numeric values return an error
+	if _, err := message.MetaInt("team"); err == nil {
+		t.Error("Expected error reading a text meta as integer")
+	}
+}
+
+func TestMessageTypedMetasFromStrings(t *testing.T) {
+	message := NewMessage()
+
+	// Rows written before typed metas hold stringified values
+	err := message.SetMetas(map[string]string{
+		"retries":    "3",
+		"urgent":     "true",
+		"sent_at":    "2024-01-02 03:04:05",
+		"escalation": `{"level":2}`,
+	})
+	if err != nil {
+		t.Fatalf("Failed to set metas: %v", err)
+	}
+
+	retries, err := message.MetaInt("retries")
+	if err != nil || retries != 3 {
+		t.Errorf("Expected retries 3, got %d (%v)", retries, err)
+	}
+
+	urgent, err := message.MetaBool("urgent")
+	if err != nil || !urgent {
+		t.Errorf("Expected urgent true, got %t (%v)", urgent, err)
+	}
+
+	sentAt, err := message.MetaTime("sent_at")
+	if err != nil || !sentAt.Equal(time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Errorf("Expected sent_at 2024-01-02 03:04:05, got %v (%v)", sentAt, err)
+	}
+
+	escalation := map[string]int{}
+	err = message.MetaJSON("escalation", &escalation)
+	if err != nil || escalation["level"] != 2 {
+		t.Errorf("Expected escalation level 2, got %v (%v)", escalation, err)
+	}
+}
+
 func TestMessageMetasEmpty(t *testing.T) {
 	message := NewMessage()
 
@@ -513,6 +635,65 @@ func TestMessageSettersReturnMessageInterface(t *testing.T) {
 	}
 }
 
+func TestMessageVersion(t *testing.T) {
+	message := NewMessage()
+
+	if message.Version() != 0 {
+		t.Errorf("Expected initial version 0, got %d", message.Version())
+	}
+
+	message.SetVersion(3)
+
+	if message.Version() != 3 {
+		t.Errorf("Expected version 3, got %d", message.Version())
+	}
+
+	existing := NewMessageFromExistingData(map[string]string{
+		COLUMN_ID:      "test-id",
+		COLUMN_VERSION: "7",
+	})
+
+	if existing.Version() != 7 {
+		t.Errorf("Expected version 7, got %d", existing.Version())
+	}
+}
+
+func TestMessageDirtyFields(t *testing.T) {
+	message := NewMessageFromExistingData(map[string]string{
+		COLUMN_ID:     "test-id",
+		COLUMN_STATUS: MESSAGE_STATUS_ACTIVE,
+	})
+
+	if message.IsDirty() {
+		t.Errorf("Expected existing message not to be dirty, got %v", message.DirtyFields())
+	}
+
+	// Setting the same value is not a change
+	message.SetStatus(MESSAGE_STATUS_ACTIVE)
+
+	if message.IsDirty() {
+		t.Errorf("Expected message not to be dirty after setting the same status, got %v", message.DirtyFields())
+	}
+
+	message.SetText("Test Text")
+	message.SetStatus(MESSAGE_STATUS_INACTIVE)
+
+	if !message.IsDirty() {
+		t.Fatal("Expected message to be dirty")
+	}
+
+	dirtyFields := message.DirtyFields()
+	if len(dirtyFields) != 2 || dirtyFields[0] != COLUMN_STATUS || dirtyFields[1] != COLUMN_TEXT {
+		t.Errorf("Expected dirty fields [%s %s], got %v", COLUMN_STATUS, COLUMN_TEXT, dirtyFields)
+	}
+
+	message.MarkAsNotDirty()
+
+	if message.IsDirty() {
+		t.Errorf("Expected message not to be dirty after MarkAsNotDirty, got %v", message.DirtyFields())
+	}
+}
+
 func TestMessageChaining(t *testing.T) {
 	message := NewMessage()
 
@@ -562,3 +743,46 @@ func TestMessageChaining(t *testing.T) {
 		t.Errorf("Chaining failed: expected memo 'Test Memo', got %s", message.Memo())
 	}
 }
+
+func TestMessage_Validate(t *testing.T) {
+	message := NewMessage().SetChatID("chat-id").SetSenderID("sender-id").SetText("Hello")
+	if err := message.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message.SetChatID(strings.Repeat("x", MAX_LENGTH_ID+1)).
+		SetSenderID(strings.Repeat("x", MAX_LENGTH_USER_ID+1)).
+		SetText(strings.Repeat("x", MAX_LENGTH_TEXT+1))
+
+	var fieldErrors ValidationErrors
+	if !errors.As(message.Validate(), &fieldErrors) {
+		t.Fatal("expected ValidationErrors")
+	}
+
+	fields := []string{}
+	for _, fieldError := range fieldErrors {
+		fields = append(fields, fieldError.Field)
+	}
+
+	if strings.Join(fields, ",") != "chat_id,sender_id,text" {
+		t.Fatal("unexpected fields:", fields)
+	}
+}
+
+func TestMessage_ValidateScheduled(t *testing.T) {
+	message := NewMessage().SetChatID("chat-id").SetStatus(MESSAGE_STATUS_SCHEDULED)
+
+	var fieldErrors ValidationErrors
+	if !errors.As(message.Validate(), &fieldErrors) {
+		t.Fatal("expected ValidationErrors")
+	}
+
+	if len(fieldErrors) != 1 || fieldErrors[0].Field != COLUMN_SCHEDULED_AT {
+		t.Fatal("expected the scheduled time to be required, got", fieldErrors)
+	}
+
+	message.SetScheduledAt("2030-01-01 00:00:00")
+	if err := message.Validate(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
@@ -1,12 +1,20 @@
 package chatstore
 
-import "errors"
+import (
+	"errors"
+	"maps"
+	"slices"
+)
 
 // MessageQueryInterface defines the interface for querying messages
 type MessageQueryInterface interface {
 	// Validation method
 	Validate() error
 
+	// Clone returns a copy of the query, which can be changed without
+	// changing the query
+	Clone() MessageQueryInterface
+
 	// Basic query methods
 	IsCreatedAtGteSet() bool
 	GetCreatedAtGte() string
@@ -16,6 +24,10 @@ type MessageQueryInterface interface {
 	GetCreatedAtLte() string
 	SetCreatedAtLte(createdAt string) MessageQueryInterface
 
+	IsConversationBetweenSet() bool
+	GetConversationBetween() []string
+	SetConversationBetween(userA string, userB string) MessageQueryInterface
+
 	IsIDSet() bool
 	GetID() string
 	SetID(id string) MessageQueryInterface
@@ -28,6 +40,18 @@ type MessageQueryInterface interface {
 	GetIDNotIn() []string
 	SetIDNotIn(ids []string) MessageQueryInterface
 
+	IsMetaEqualsSet() bool
+	GetMetaEquals() map[string]string
+	SetMetaEquals(key string, value string) MessageQueryInterface
+
+	IsMetaExistsSet() bool
+	GetMetaExists() []string
+	SetMetaExists(key string) MessageQueryInterface
+
+	IsMetaInSet() bool
+	GetMetaIn() map[string][]string
+	SetMetaIn(key string, values []string) MessageQueryInterface
+
 	IsLimitSet() bool
 	GetLimit() int
 	SetLimit(limit int) MessageQueryInterface
@@ -40,6 +64,36 @@ type MessageQueryInterface interface {
 	GetChatIDIn() []string
 	SetChatIDIn(chatIDs []string) MessageQueryInterface
 
+	IsClientMessageIDSet() bool
+	GetClientMessageID() string
+	SetClientMessageID(clientMessageID string) MessageQueryInterface
+
+	IsPinnedSet() bool
+	GetPinned() bool
+	SetPinned(pinned bool) MessageQueryInterface
+
+	IsMentionedUserIDSet() bool
+	GetMentionedUserID() string
+	SetMentionedUserID(userID string) MessageQueryInterface
+
+	IsStarredByUserIDSet() bool
+	GetStarredByUserID() string
+	SetStarredByUserID(userID string) MessageQueryInterface
+
+	IsDeliveryStatusSet() bool
+	GetDeliveryStatus() string
+	SetDeliveryStatus(deliveryStatus string) MessageQueryInterface
+
+	IsModerationStateSet() bool
+	GetModerationState() string
+	SetModerationState(moderationState string) MessageQueryInterface
+
+	// UndeliveredForUserID matches the messages sent to the user
+	// which are not yet delivered, including the failed ones
+	IsUndeliveredForUserIDSet() bool
+	GetUndeliveredForUserID() string
+	SetUndeliveredForUserID(userID string) MessageQueryInterface
+
 	IsOffsetSet() bool
 	GetOffset() int
 	SetOffset(offset int) MessageQueryInterface
@@ -56,10 +110,22 @@ type MessageQueryInterface interface {
 	GetRecipientID() string
 	SetRecipientID(recipientID string) MessageQueryInterface
 
+	IsRecipientIDInSet() bool
+	GetRecipientIDIn() []string
+	SetRecipientIDIn(recipientIDs []string) MessageQueryInterface
+
 	IsSenderIDSet() bool
 	GetSenderID() string
 	SetSenderID(senderID string) MessageQueryInterface
 
+	IsSenderIDInSet() bool
+	GetSenderIDIn() []string
+	SetSenderIDIn(senderIDs []string) MessageQueryInterface
+
+	IsSenderIDNotInSet() bool
+	GetSenderIDNotIn() []string
+	SetSenderIDNotIn(senderIDs []string) MessageQueryInterface
+
 	IsStatusSet() bool
 	GetStatus() string
 	SetStatus(status string) MessageQueryInterface
@@ -68,6 +134,14 @@ type MessageQueryInterface interface {
 	GetStatusIn() []string
 	SetStatusIn(statuses []string) MessageQueryInterface
 
+	IsUpdatedAtGteSet() bool
+	GetUpdatedAtGte() string
+	SetUpdatedAtGte(updatedAt string) MessageQueryInterface
+
+	IsUpdatedAtLteSet() bool
+	GetUpdatedAtLte() string
+	SetUpdatedAtLte(updatedAt string) MessageQueryInterface
+
 	// Count related methods
 	IsCountOnlySet() bool
 	GetCountOnly() bool
@@ -81,6 +155,27 @@ type MessageQueryInterface interface {
 	IsOnlySoftDeletedSet() bool
 	GetOnlySoftDeleted() bool
 	SetOnlySoftDeleted(onlySoftDeleted bool) MessageQueryInterface
+
+	// Scheduled, expired and rejected messages are excluded unless requested
+	IsWithScheduledSet() bool
+	GetWithScheduled() bool
+	SetWithScheduled(withScheduled bool) MessageQueryInterface
+
+	IsWithExpiredSet() bool
+	GetWithExpired() bool
+	SetWithExpired(withExpired bool) MessageQueryInterface
+
+	IsWithRejectedSet() bool
+	GetWithRejected() bool
+	SetWithRejected(withRejected bool) MessageQueryInterface
+}
+
+// MessageQueryResult holds the outcome of executing a message query
+type MessageQueryResult struct {
+	// Items holds the messages of the requested page (empty when count only is set)
+	Items []MessageInterface
+	// Total holds the number of messages matching the query, ignoring limit and offset
+	Total int64
 }
 
 // MessageQuery creates a new message query
@@ -102,12 +197,67 @@ type messageQueryImplementation struct {
 	params map[string]any
 }
 
+// Clone returns a copy of the query. The meta setters add to the maps and
+// slices of the parameters, so these are copied too.
+func (q *messageQueryImplementation) Clone() MessageQueryInterface {
+	return &messageQueryImplementation{
+		params: queryParamsClone(q.params),
+	}
+}
+
+// queryParamsClone returns a copy of the query parameters, copying the
+// maps and slices of the values.
+func queryParamsClone(params map[string]any) map[string]any {
+	clone := make(map[string]any, len(params))
+	for key, value := range params {
+		switch v := value.(type) {
+		case []string:
+			clone[key] = slices.Clone(v)
+		case map[string]string:
+			clone[key] = maps.Clone(v)
+		case map[string][]string:
+			values := make(map[string][]string, len(v))
+			for k, vs := range v {
+				values[k] = slices.Clone(vs)
+			}
+			clone[key] = values
+		default:
+			clone[key] = value
+		}
+	}
+	return clone
+}
+
 // Validate validates the query parameters
 func (q *messageQueryImplementation) Validate() error {
 	if q.IsChatIDSet() && q.GetChatID() == "" {
 		return errors.New("message query: chat_id cannot be empty")
 	}
 
+	if q.IsClientMessageIDSet() && q.GetClientMessageID() == "" {
+		return errors.New("message query: client_message_id cannot be empty")
+	}
+
+	if q.IsMentionedUserIDSet() && q.GetMentionedUserID() == "" {
+		return errors.New("message query: mentioned_user_id cannot be empty")
+	}
+
+	if q.IsStarredByUserIDSet() && q.GetStarredByUserID() == "" {
+		return errors.New("message query: starred_by_user_id cannot be empty")
+	}
+
+	if q.IsDeliveryStatusSet() && q.GetDeliveryStatus() == "" {
+		return errors.New("message query: delivery_status cannot be empty")
+	}
+
+	if q.IsModerationStateSet() && q.GetModerationState() == "" {
+		return errors.New("message query: moderation_state cannot be empty")
+	}
+
+	if q.IsUndeliveredForUserIDSet() && q.GetUndeliveredForUserID() == "" {
+		return errors.New("message query: undelivered_for_user_id cannot be empty")
+	}
+
 	if q.IsCreatedAtGteSet() && q.GetCreatedAtGte() == "" {
 		return errors.New("message query: created_at_gte cannot be empty")
 	}
@@ -116,6 +266,10 @@ func (q *messageQueryImplementation) Validate() error {
 		return errors.New("message query: created_at_lte cannot be empty")
 	}
 
+	if q.IsConversationBetweenSet() && slices.Contains(q.GetConversationBetween(), "") {
+		return errors.New("message query: conversation_between users cannot be empty")
+	}
+
 	if q.IsIDSet() && q.GetID() == "" {
 		return errors.New("message query: id cannot be empty")
 	}
@@ -128,6 +282,28 @@ func (q *messageQueryImplementation) Validate() error {
 		return errors.New("message query: id_not_in cannot be empty array")
 	}
 
+	for key := range q.GetMetaEquals() {
+		if key == "" {
+			return errors.New("message query: meta_equals key cannot be empty")
+		}
+	}
+
+	for _, key := range q.GetMetaExists() {
+		if key == "" {
+			return errors.New("message query: meta_exists key cannot be empty")
+		}
+	}
+
+	for key, values := range q.GetMetaIn() {
+		if key == "" {
+			return errors.New("message query: meta_in key cannot be empty")
+		}
+
+		if len(values) < 1 {
+			return errors.New("message query: meta_in values cannot be empty array")
+		}
+	}
+
 	if q.IsLimitSet() && q.GetLimit() < 0 {
 		return errors.New("message query: limit cannot be negative")
 	}
@@ -148,10 +324,22 @@ func (q *messageQueryImplementation) Validate() error {
 		return errors.New("message query: recipient_id cannot be empty")
 	}
 
+	if q.IsRecipientIDInSet() && len(q.GetRecipientIDIn()) < 1 {
+		return errors.New("message query: recipient_id_in cannot be empty array")
+	}
+
 	if q.IsSenderIDSet() && q.GetSenderID() == "" {
 		return errors.New("message query: sender_id cannot be empty")
 	}
 
+	if q.IsSenderIDInSet() && len(q.GetSenderIDIn()) < 1 {
+		return errors.New("message query: sender_id_in cannot be empty array")
+	}
+
+	if q.IsSenderIDNotInSet() && len(q.GetSenderIDNotIn()) < 1 {
+		return errors.New("message query: sender_id_not_in cannot be empty array")
+	}
+
 	if q.IsStatusSet() && q.GetStatus() == "" {
 		return errors.New("message query: status cannot be empty")
 	}
@@ -160,6 +348,14 @@ func (q *messageQueryImplementation) Validate() error {
 		return errors.New("message query: status_in cannot be empty array")
 	}
 
+	if q.IsUpdatedAtGteSet() && q.GetUpdatedAtGte() == "" {
+		return errors.New("message query: updated_at_gte cannot be empty")
+	}
+
+	if q.IsUpdatedAtLteSet() && q.GetUpdatedAtLte() == "" {
+		return errors.New("message query: updated_at_lte cannot be empty")
+	}
+
 	return nil
 }
 
@@ -220,6 +416,24 @@ func (q *messageQueryImplementation) SetCreatedAtLte(createdAtLte string) Messag
 	return q
 }
 
+func (q *messageQueryImplementation) IsConversationBetweenSet() bool {
+	return q.hasProperty("conversation_between")
+}
+
+func (q *messageQueryImplementation) GetConversationBetween() []string {
+	if q.IsConversationBetweenSet() {
+		return q.params["conversation_between"].([]string)
+	}
+	return []string{}
+}
+
+// SetConversationBetween limits the query to the messages exchanged between
+// the two users, in either direction
+func (q *messageQueryImplementation) SetConversationBetween(userA string, userB string) MessageQueryInterface {
+	q.params["conversation_between"] = []string{userA, userB}
+	return q
+}
+
 func (q *messageQueryImplementation) IsChatIDSet() bool {
 	return q.hasProperty("chat_id")
 }
@@ -252,6 +466,118 @@ func (q *messageQueryImplementation) SetChatIDIn(chatIDIn []string) MessageQuery
 	return q
 }
 
+func (q *messageQueryImplementation) IsPinnedSet() bool {
+	return q.hasProperty("pinned")
+}
+
+func (q *messageQueryImplementation) GetPinned() bool {
+	if q.IsPinnedSet() {
+		return q.params["pinned"].(bool)
+	}
+	return false
+}
+
+func (q *messageQueryImplementation) SetPinned(pinned bool) MessageQueryInterface {
+	q.params["pinned"] = pinned
+	return q
+}
+
+func (q *messageQueryImplementation) IsMentionedUserIDSet() bool {
+	return q.hasProperty("mentioned_user_id")
+}
+
+func (q *messageQueryImplementation) GetMentionedUserID() string {
+	if q.IsMentionedUserIDSet() {
+		return q.params["mentioned_user_id"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetMentionedUserID(userID string) MessageQueryInterface {
+	q.params["mentioned_user_id"] = userID
+	return q
+}
+
+func (q *messageQueryImplementation) IsStarredByUserIDSet() bool {
+	return q.hasProperty("starred_by_user_id")
+}
+
+func (q *messageQueryImplementation) GetStarredByUserID() string {
+	if q.IsStarredByUserIDSet() {
+		return q.params["starred_by_user_id"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetStarredByUserID(userID string) MessageQueryInterface {
+	q.params["starred_by_user_id"] = userID
+	return q
+}
+
+func (q *messageQueryImplementation) IsDeliveryStatusSet() bool {
+	return q.hasProperty("delivery_status")
+}
+
+func (q *messageQueryImplementation) GetDeliveryStatus() string {
+	if q.IsDeliveryStatusSet() {
+		return q.params["delivery_status"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetDeliveryStatus(deliveryStatus string) MessageQueryInterface {
+	q.params["delivery_status"] = deliveryStatus
+	return q
+}
+
+func (q *messageQueryImplementation) IsModerationStateSet() bool {
+	return q.hasProperty("moderation_state")
+}
+
+func (q *messageQueryImplementation) GetModerationState() string {
+	if q.IsModerationStateSet() {
+		return q.params["moderation_state"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetModerationState(moderationState string) MessageQueryInterface {
+	q.params["moderation_state"] = moderationState
+	return q
+}
+
+func (q *messageQueryImplementation) IsUndeliveredForUserIDSet() bool {
+	return q.hasProperty("undelivered_for_user_id")
+}
+
+func (q *messageQueryImplementation) GetUndeliveredForUserID() string {
+	if q.IsUndeliveredForUserIDSet() {
+		return q.params["undelivered_for_user_id"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetUndeliveredForUserID(userID string) MessageQueryInterface {
+	q.params["undelivered_for_user_id"] = userID
+	return q
+}
+
+func (q *messageQueryImplementation) IsClientMessageIDSet() bool {
+	return q.hasProperty("client_message_id")
+}
+
+func (q *messageQueryImplementation) GetClientMessageID() string {
+	if q.IsClientMessageIDSet() {
+		return q.params["client_message_id"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetClientMessageID(clientMessageID string) MessageQueryInterface {
+	q.params["client_message_id"] = clientMessageID
+	return q
+}
+
 func (q *messageQueryImplementation) IsIDSet() bool {
 	return q.hasProperty("id")
 }
@@ -300,6 +626,61 @@ func (q *messageQueryImplementation) SetIDNotIn(idNotIn []string) MessageQueryIn
 	return q
 }
 
+func (q *messageQueryImplementation) IsMetaEqualsSet() bool {
+	return q.hasProperty("meta_equals")
+}
+
+func (q *messageQueryImplementation) GetMetaEquals() map[string]string {
+	if q.IsMetaEqualsSet() {
+		return q.params["meta_equals"].(map[string]string)
+	}
+	return map[string]string{}
+}
+
+// SetMetaEquals filters by the meta key having the value. Can be called for multiple keys.
+func (q *messageQueryImplementation) SetMetaEquals(key string, value string) MessageQueryInterface {
+	metaEquals := q.GetMetaEquals()
+	metaEquals[key] = value
+	q.params["meta_equals"] = metaEquals
+	return q
+}
+
+func (q *messageQueryImplementation) IsMetaExistsSet() bool {
+	return q.hasProperty("meta_exists")
+}
+
+func (q *messageQueryImplementation) GetMetaExists() []string {
+	if q.IsMetaExistsSet() {
+		return q.params["meta_exists"].([]string)
+	}
+	return []string{}
+}
+
+// SetMetaExists filters by the meta key being present. Can be called for multiple keys.
+func (q *messageQueryImplementation) SetMetaExists(key string) MessageQueryInterface {
+	q.params["meta_exists"] = append(q.GetMetaExists(), key)
+	return q
+}
+
+func (q *messageQueryImplementation) IsMetaInSet() bool {
+	return q.hasProperty("meta_in")
+}
+
+func (q *messageQueryImplementation) GetMetaIn() map[string][]string {
+	if q.IsMetaInSet() {
+		return q.params["meta_in"].(map[string][]string)
+	}
+	return map[string][]string{}
+}
+
+// SetMetaIn filters by the meta key having one of the values. Can be called for multiple keys.
+func (q *messageQueryImplementation) SetMetaIn(key string, values []string) MessageQueryInterface {
+	metaIn := q.GetMetaIn()
+	metaIn[key] = values
+	q.params["meta_in"] = metaIn
+	return q
+}
+
 func (q *messageQueryImplementation) IsLimitSet() bool {
 	return q.hasProperty("limit")
 }
@@ -364,6 +745,54 @@ func (q *messageQueryImplementation) SetWithSoftDeleted(withSoftDeleted bool) Me
 	return q
 }
 
+func (q *messageQueryImplementation) IsWithScheduledSet() bool {
+	return q.hasProperty("with_scheduled")
+}
+
+func (q *messageQueryImplementation) GetWithScheduled() bool {
+	if q.IsWithScheduledSet() {
+		return q.params["with_scheduled"].(bool)
+	}
+	return false
+}
+
+func (q *messageQueryImplementation) SetWithScheduled(withScheduled bool) MessageQueryInterface {
+	q.params["with_scheduled"] = withScheduled
+	return q
+}
+
+func (q *messageQueryImplementation) IsWithExpiredSet() bool {
+	return q.hasProperty("with_expired")
+}
+
+func (q *messageQueryImplementation) GetWithExpired() bool {
+	if q.IsWithExpiredSet() {
+		return q.params["with_expired"].(bool)
+	}
+	return false
+}
+
+func (q *messageQueryImplementation) SetWithExpired(withExpired bool) MessageQueryInterface {
+	q.params["with_expired"] = withExpired
+	return q
+}
+
+func (q *messageQueryImplementation) IsWithRejectedSet() bool {
+	return q.hasProperty("with_rejected")
+}
+
+func (q *messageQueryImplementation) GetWithRejected() bool {
+	if q.IsWithRejectedSet() {
+		return q.params["with_rejected"].(bool)
+	}
+	return false
+}
+
+func (q *messageQueryImplementation) SetWithRejected(withRejected bool) MessageQueryInterface {
+	q.params["with_rejected"] = withRejected
+	return q
+}
+
 func (q *messageQueryImplementation) IsOrderBySet() bool {
 	return q.hasProperty("order_by")
 }
@@ -412,6 +841,22 @@ func (q *messageQueryImplementation) SetRecipientID(recipientID string) MessageQ
 	return q
 }
 
+func (q *messageQueryImplementation) IsRecipientIDInSet() bool {
+	return q.hasProperty("recipient_id_in")
+}
+
+func (q *messageQueryImplementation) GetRecipientIDIn() []string {
+	if q.IsRecipientIDInSet() {
+		return q.params["recipient_id_in"].([]string)
+	}
+	return []string{}
+}
+
+func (q *messageQueryImplementation) SetRecipientIDIn(recipientIDIn []string) MessageQueryInterface {
+	q.params["recipient_id_in"] = recipientIDIn
+	return q
+}
+
 func (q *messageQueryImplementation) IsSenderIDSet() bool {
 	return q.hasProperty("sender_id")
 }
@@ -428,6 +873,38 @@ func (q *messageQueryImplementation) SetSenderID(senderID string) MessageQueryIn
 	return q
 }
 
+func (q *messageQueryImplementation) IsSenderIDInSet() bool {
+	return q.hasProperty("sender_id_in")
+}
+
+func (q *messageQueryImplementation) GetSenderIDIn() []string {
+	if q.IsSenderIDInSet() {
+		return q.params["sender_id_in"].([]string)
+	}
+	return []string{}
+}
+
+func (q *messageQueryImplementation) SetSenderIDIn(senderIDIn []string) MessageQueryInterface {
+	q.params["sender_id_in"] = senderIDIn
+	return q
+}
+
+func (q *messageQueryImplementation) IsSenderIDNotInSet() bool {
+	return q.hasProperty("sender_id_not_in")
+}
+
+func (q *messageQueryImplementation) GetSenderIDNotIn() []string {
+	if q.IsSenderIDNotInSet() {
+		return q.params["sender_id_not_in"].([]string)
+	}
+	return []string{}
+}
+
+func (q *messageQueryImplementation) SetSenderIDNotIn(senderIDNotIn []string) MessageQueryInterface {
+	q.params["sender_id_not_in"] = senderIDNotIn
+	return q
+}
+
 func (q *messageQueryImplementation) IsStatusSet() bool {
 	return q.hasProperty("status")
 }
@@ -459,3 +936,35 @@ func (q *messageQueryImplementation) SetStatusIn(statuses []string) MessageQuery
 	q.params["status_in"] = statuses
 	return q
 }
+
+func (q *messageQueryImplementation) IsUpdatedAtGteSet() bool {
+	return q.hasProperty("updated_at_gte")
+}
+
+func (q *messageQueryImplementation) GetUpdatedAtGte() string {
+	if q.IsUpdatedAtGteSet() {
+		return q.params["updated_at_gte"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetUpdatedAtGte(updatedAtGte string) MessageQueryInterface {
+	q.params["updated_at_gte"] = updatedAtGte
+	return q
+}
+
+func (q *messageQueryImplementation) IsUpdatedAtLteSet() bool {
+	return q.hasProperty("updated_at_lte")
+}
+
+func (q *messageQueryImplementation) GetUpdatedAtLte() string {
+	if q.IsUpdatedAtLteSet() {
+		return q.params["updated_at_lte"].(string)
+	}
+	return ""
+}
+
+func (q *messageQueryImplementation) SetUpdatedAtLte(updatedAtLte string) MessageQueryInterface {
+	q.params["updated_at_lte"] = updatedAtLte
+	return q
+}
@@ -0,0 +1,135 @@
+package chatstore
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// == METAS ===================================================================
+
+// Metas are stored as a JSON object. Values written through SetMetas are JSON
+// strings, while SetMetaValue stores any JSON value (numbers, booleans, arrays,
+// objects). The typed getters accept both, so rows holding stringified values
+// keep working.
+
+// metasDecode decodes the metas JSON object into its raw JSON values.
+func metasDecode(metasJSON string) (map[string]json.RawMessage, error) {
+	if metasJSON == "" {
+		metasJSON = "{}"
+	}
+
+	metas := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(metasJSON), &metas); err != nil {
+		return map[string]json.RawMessage{}, err
+	}
+
+	return metas, nil
+}
+
+// metasEncode encodes the raw JSON values into the metas JSON object.
+func metasEncode(metas map[string]json.RawMessage) (string, error) {
+	metasJSON, err := json.Marshal(metas)
+	if err != nil {
+		return "", err
+	}
+	return string(metasJSON), nil
+}
+
+// metasToStrings converts the raw JSON values to strings. JSON strings are
+// unquoted, any other value is kept as its JSON text (e.g. 5, true, [1,2]).
+func metasToStrings(metas map[string]json.RawMessage) map[string]string {
+	result := make(map[string]string, len(metas))
+	for key, raw := range metas {
+		result[key] = metaRawString(raw)
+	}
+	return result
+}
+
+// metaRawString returns the raw JSON value as a string.
+func metaRawString(raw json.RawMessage) string {
+	var value string
+	if err := json.Unmarshal(raw, &value); err == nil {
+		return value
+	}
+	return string(raw)
+}
+
+// metaRawIsString returns true if the raw JSON value is a JSON string.
+func metaRawIsString(raw json.RawMessage) bool {
+	return bytes.HasPrefix(bytes.TrimSpace(raw), []byte(`"`))
+}
+
+// metaRawInt returns the raw JSON value as an integer. JSON numbers written
+// with a fraction or an exponent (e.g. 5.0, 1e3) are accepted when their
+// value is a whole number.
+func metaRawInt(key string, raw json.RawMessage) (int64, error) {
+	text := metaRawString(raw)
+
+	value, err := strconv.ParseInt(text, 10, 64)
+	if err == nil {
+		return value, nil
+	}
+
+	number, floatErr := strconv.ParseFloat(text, 64)
+	if floatErr != nil {
+		return 0, fmt.Errorf("meta %q is not an integer: %w", key, err)
+	}
+
+	// The float64 of math.MaxInt64 rounds up to 2^63, out of range
+	if number != math.Trunc(number) || number < math.MinInt64 || number >= math.MaxInt64 {
+		return 0, fmt.Errorf("meta %q is not an integer: %s", key, text)
+	}
+
+	return int64(number), nil
+}
+
+// metaRawFloat returns the raw JSON value as a float.
+func metaRawFloat(key string, raw json.RawMessage) (float64, error) {
+	value, err := strconv.ParseFloat(metaRawString(raw), 64)
+	if err != nil {
+		return 0, fmt.Errorf("meta %q is not a number: %w", key, err)
+	}
+	return value, nil
+}
+
+// metaRawBool returns the raw JSON value as a boolean.
+func metaRawBool(key string, raw json.RawMessage) (bool, error) {
+	value, err := strconv.ParseBool(metaRawString(raw))
+	if err != nil {
+		return false, fmt.Errorf("meta %q is not a boolean: %w", key, err)
+	}
+	return value, nil
+}
+
+// metaRawTime returns the raw JSON value as a time, parsing any format
+// understood by carbon (e.g. RFC 3339 or "2006-01-02 15:04:05").
+func metaRawTime(key string, raw json.RawMessage) (time.Time, error) {
+	parsed := carbon.Parse(metaRawString(raw), carbon.UTC)
+	if parsed.HasError() {
+		return time.Time{}, fmt.Errorf("meta %q is not a time: %w", key, parsed.Error)
+	}
+	return parsed.StdTime(), nil
+}
+
+// metaRawJSON unmarshals the raw JSON value into dest. A JSON string holding
+// a stringified JSON document is unmarshalled as that document.
+func metaRawJSON(key string, raw json.RawMessage, dest any) error {
+	err := json.Unmarshal(raw, dest)
+	if err == nil {
+		return nil
+	}
+
+	if metaRawIsString(raw) {
+		if errString := json.Unmarshal([]byte(metaRawString(raw)), dest); errString == nil {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("meta %q cannot be unmarshalled: %w", key, err)
+}
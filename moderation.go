@@ -0,0 +1,38 @@
+package chatstore
+
+// ModerationDecision is the decision of a Moderator on a message
+type ModerationDecision struct {
+	// Action is one of the allow, reject, redact or flag MODERATION_ACTION_* constants,
+	// an empty action allows the message
+	Action string
+	// Reason explains the decision, returned with a rejection and kept in the moderation log
+	Reason string
+	// Text replaces the text of a redacted message
+	Text string
+}
+
+// Moderator screens the text of a message before it is stored. The store
+// asks the moderator when a message is created, upserted or its text is updated.
+type Moderator interface {
+	Moderate(message MessageInterface) (ModerationDecision, error)
+}
+
+// ModeratorFunc adapts a function to the Moderator interface.
+type ModeratorFunc func(message MessageInterface) (ModerationDecision, error)
+
+// Moderate calls the function.
+func (f ModeratorFunc) Moderate(message MessageInterface) (ModerationDecision, error) {
+	return f(message)
+}
+
+// ModerationEntry is an entry of the moderation log of a message, recording
+// a decision of the moderator or of a reviewer
+type ModerationEntry struct {
+	MessageID string
+	// Action is one of the MODERATION_ACTION_* constants
+	Action string
+	// ReviewerID is the ID of the reviewer, empty for a decision of the moderator
+	ReviewerID string
+	Reason     string
+	CreatedAt  string
+}
@@ -0,0 +1,100 @@
+package chatstore
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"time"
+)
+
+// defaultSchedulerInterval is the time between the scheduler runs when no
+// interval is given.
+const defaultSchedulerInterval = time.Minute
+
+// NewSchedulerOptions defines the options for creating a new scheduler.
+type NewSchedulerOptions struct {
+	Store StoreInterface
+	// Interval is the time between runs, one minute when zero
+	Interval time.Duration
+	// OnPublish is called with each published message, e.g. to notify its recipient
+	OnPublish func(message MessageInterface)
+	Logger    *slog.Logger
+}
+
+// Scheduler periodically publishes the due scheduled messages and purges
+// the expired messages of a store.
+type Scheduler struct {
+	store     StoreInterface
+	interval  time.Duration
+	onPublish func(message MessageInterface)
+	logger    *slog.Logger
+}
+
+// NewScheduler creates a new scheduler.
+func NewScheduler(opts NewSchedulerOptions) (*Scheduler, error) {
+	if opts.Store == nil {
+		return nil, errors.New("chat store: Store is required")
+	}
+
+	if opts.Interval < 0 {
+		return nil, errors.New("chat store: Interval cannot be negative")
+	}
+
+	if opts.Interval == 0 {
+		opts.Interval = defaultSchedulerInterval
+	}
+
+	if opts.Logger == nil {
+		opts.Logger = slog.New(slog.NewTextHandler(os.Stdout, nil))
+	}
+
+	return &Scheduler{
+		store:     opts.Store,
+		interval:  opts.Interval,
+		onPublish: opts.OnPublish,
+		logger:    opts.Logger,
+	}, nil
+}
+
+// RunOnce publishes the messages due at the given time and purges the
+// messages expired by then. It returns the number of messages published
+// and purged.
+func (s *Scheduler) RunOnce(now time.Time) (published int, purged int64, err error) {
+	messages, err := s.store.MessagePublishDue(now)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	if s.onPublish != nil {
+		for _, message := range messages {
+			s.onPublish(message)
+		}
+	}
+
+	purged, err = s.store.MessagePurgeExpired(now)
+	if err != nil {
+		return len(messages), 0, err
+	}
+
+	return len(messages), purged, nil
+}
+
+// Start runs the scheduler at every interval until the context is done.
+// A failed run is logged and retried at the next interval.
+func (s *Scheduler) Start(ctx context.Context) {
+	ticker := time.NewTicker(s.interval)
+	defer ticker.Stop()
+
+	for {
+		if _, _, err := s.RunOnce(time.Now()); err != nil {
+			s.logger.Error("Scheduler run failed", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
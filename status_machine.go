@@ -0,0 +1,146 @@
+package chatstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+)
+
+// StatusMachine defines the statuses allowed for an entity, and the
+// transitions allowed between them. Keeping the same status is always
+// allowed. It is safe for concurrent use, so custom statuses can be
+// registered on the machine of a running store.
+type StatusMachine struct {
+	mu          sync.RWMutex
+	statuses    []string
+	transitions map[string][]string
+}
+
+// NewStatusMachine returns a status machine allowing the statuses,
+// with no transitions between them.
+func NewStatusMachine(statuses ...string) *StatusMachine {
+	machine := &StatusMachine{transitions: map[string][]string{}}
+	for _, status := range statuses {
+		_ = machine.RegisterStatus(status)
+	}
+	return machine
+}
+
+// NewChatStatusMachine returns the default chat status machine, allowing
+// the active, inactive and deleted statuses and any transition between them.
+func NewChatStatusMachine() *StatusMachine {
+	machine := NewStatusMachine(CHAT_STATUS_ACTIVE, CHAT_STATUS_INACTIVE, CHAT_STATUS_DELETED)
+	for _, from := range machine.Statuses() {
+		_ = machine.AllowTransition(from, machine.Statuses()...)
+	}
+	return machine
+}
+
+// NewMessageStatusMachine returns the default message status machine,
+// allowing the active, inactive and deleted statuses and any transition
+// between them. A scheduled message may be published, deactivated or
+// deleted, while only the store schedules messages.
+func NewMessageStatusMachine() *StatusMachine {
+	machine := NewStatusMachine(MESSAGE_STATUS_ACTIVE, MESSAGE_STATUS_INACTIVE, MESSAGE_STATUS_DELETED)
+	for _, from := range machine.Statuses() {
+		_ = machine.AllowTransition(from, machine.Statuses()...)
+	}
+
+	_ = machine.RegisterStatus(MESSAGE_STATUS_SCHEDULED)
+	_ = machine.AllowTransition(MESSAGE_STATUS_SCHEDULED, MESSAGE_STATUS_ACTIVE, MESSAGE_STATUS_INACTIVE, MESSAGE_STATUS_DELETED)
+	return machine
+}
+
+// RegisterStatus allows the status, e.g. a custom "archived" status.
+// Registering an allowed status does nothing.
+func (m *StatusMachine) RegisterStatus(status string) error {
+	if status == "" {
+		return errors.New("status is required")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if !slices.Contains(m.statuses, status) {
+		m.statuses = append(m.statuses, status)
+	}
+	return nil
+}
+
+// AllowTransition allows the transitions from the status to each of the
+// other statuses. All the statuses must be registered.
+func (m *StatusMachine) AllowTransition(from string, to ...string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, status := range append([]string{from}, to...) {
+		if !slices.Contains(m.statuses, status) {
+			return fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+		}
+	}
+
+	for _, status := range to {
+		if !slices.Contains(m.transitions[from], status) {
+			m.transitions[from] = append(m.transitions[from], status)
+		}
+	}
+	return nil
+}
+
+// Statuses returns the allowed statuses, in the order they were registered.
+func (m *StatusMachine) Statuses() []string {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Clone(m.statuses)
+}
+
+// IsValid returns whether the status is allowed.
+func (m *StatusMachine) IsValid(status string) bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return slices.Contains(m.statuses, status)
+}
+
+// CanTransition returns whether the transition between the statuses is allowed.
+func (m *StatusMachine) CanTransition(from string, to string) bool {
+	return m.ValidateTransition(from, to) == nil
+}
+
+// ValidateStatus returns an error wrapping ErrInvalidStatus when the
+// status is not allowed.
+func (m *StatusMachine) ValidateStatus(status string) error {
+	if !m.IsValid(status) {
+		return fmt.Errorf("%w: %q", ErrInvalidStatus, status)
+	}
+	return nil
+}
+
+// ValidateTransition returns an error wrapping ErrInvalidStatus when the
+// target status is not allowed, or ErrInvalidStatusTransition when the
+// transition to it is not. A status which is not allowed, such as a stored
+// status no longer registered, may be left for any allowed status, so that
+// the record can be repaired.
+func (m *StatusMachine) ValidateTransition(from string, to string) error {
+	if err := m.ValidateStatus(to); err != nil {
+		return err
+	}
+
+	if from == to {
+		return nil
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if !slices.Contains(m.statuses, from) {
+		return nil
+	}
+
+	if !slices.Contains(m.transitions[from], to) {
+		return fmt.Errorf("%w: from %q to %q", ErrInvalidStatusTransition, from, to)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStatusMachine(t *testing.T) {
+	machine := chatstore.NewStatusMachine("draft", "published")
+
+	if err := machine.AllowTransition("draft", "published"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !machine.IsValid("draft") || machine.IsValid("actve") {
+		t.Fatal("Unexpected statuses:", machine.Statuses())
+	}
+
+	if !machine.CanTransition("draft", "published") {
+		t.Fatal("Expected draft to move to published")
+	}
+
+	if !machine.CanTransition("published", "published") {
+		t.Fatal("Expected the same status to be kept")
+	}
+
+	if err := machine.ValidateTransition("published", "draft"); !errors.Is(err, chatstore.ErrInvalidStatusTransition) {
+		t.Fatal("Expected ErrInvalidStatusTransition, got", err)
+	}
+
+	if err := machine.ValidateTransition("draft", "actve"); !errors.Is(err, chatstore.ErrInvalidStatus) {
+		t.Fatal("Expected ErrInvalidStatus, got", err)
+	}
+
+	// A status no longer registered may be repaired
+	if !machine.CanTransition("actve", "draft") {
+		t.Fatal("Expected an unregistered status to be left")
+	}
+
+	if err := machine.ValidateTransition("actve", "actve"); !errors.Is(err, chatstore.ErrInvalidStatus) {
+		t.Fatal("Expected ErrInvalidStatus, got", err)
+	}
+
+	if err := machine.AllowTransition("published", "archived"); !errors.Is(err, chatstore.ErrInvalidStatus) {
+		t.Fatal("Expected ErrInvalidStatus for an unregistered status, got", err)
+	}
+
+	if err := machine.RegisterStatus(""); err == nil {
+		t.Fatal("Expected an error for an empty status")
+	}
+}
+
+func TestStatusMachine_Defaults(t *testing.T) {
+	chats := chatstore.NewChatStatusMachine()
+	if !chats.CanTransition(chatstore.CHAT_STATUS_DELETED, chatstore.CHAT_STATUS_ACTIVE) {
+		t.Fatal("Expected a deleted chat to be restorable")
+	}
+
+	messages := chatstore.NewMessageStatusMachine()
+	if !messages.CanTransition(chatstore.MESSAGE_STATUS_SCHEDULED, chatstore.MESSAGE_STATUS_ACTIVE) {
+		t.Fatal("Expected a scheduled message to be publishable")
+	}
+
+	if messages.CanTransition(chatstore.MESSAGE_STATUS_ACTIVE, chatstore.MESSAGE_STATUS_SCHEDULED) {
+		t.Fatal("Expected an active message not to be schedulable")
+	}
+}
@@ -5,12 +5,17 @@ import (
 	"database/sql"
 	"errors"
 	"log/slog"
+	"maps"
 	"os"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/dracory/neat"
+	contractsdatabase "github.com/dracory/neat/contracts/database"
 	contractsorm "github.com/dracory/neat/contracts/database/orm"
 	contractsschema "github.com/dracory/neat/contracts/database/schema"
+	neatquery "github.com/dracory/neat/database/query"
 	"github.com/dromara/carbon/v2"
 	"github.com/samber/lo"
 )
@@ -26,10 +31,47 @@ type StoreInterface interface {
 	GetMessageTableName() string
 	// SetMessageTableName sets the message table name
 	SetMessageTableName(tableName string)
-
-	// MigrateDown drops the chat and message tables
+	// GetDeliveryTableName returns the message delivery table name
+	GetDeliveryTableName() string
+	// SetDeliveryTableName sets the message delivery table name
+	SetDeliveryTableName(tableName string)
+	// GetStarTableName returns the message star table name
+	GetStarTableName() string
+	// SetStarTableName sets the message star table name
+	SetStarTableName(tableName string)
+	// GetMentionTableName returns the message mention table name
+	GetMentionTableName() string
+	// SetMentionTableName sets the message mention table name
+	SetMentionTableName(tableName string)
+	// GetChatUserSettingsTableName returns the chat user settings table name
+	GetChatUserSettingsTableName() string
+	// SetChatUserSettingsTableName sets the chat user settings table name
+	SetChatUserSettingsTableName(tableName string)
+	// GetModerationTableName returns the message moderation log table name
+	GetModerationTableName() string
+	// SetModerationTableName sets the message moderation log table name
+	SetModerationTableName(tableName string)
+
+	// ChatStatusMachine returns the allowed chat statuses and transitions,
+	// on which custom statuses can be registered
+	ChatStatusMachine() *StatusMachine
+	// MessageStatusMachine returns the allowed message statuses and transitions,
+	// on which custom statuses can be registered
+	MessageStatusMachine() *StatusMachine
+
+	// ForTenant returns a view of the store scoped to the tenant
+	ForTenant(tenantID string) (StoreInterface, error)
+	// TenantID returns the tenant the store is scoped to, empty when not scoped
+	TenantID() string
+
+	// AsUser returns a view of the store acting for the principal, checked against the policy
+	AsUser(principal Principal) (StoreInterface, error)
+	// Principal returns the principal the store acts for, false when not a user view
+	Principal() (Principal, bool)
+
+	// MigrateDown drops the chat and message tables, and the tables related to them
 	MigrateDown(ctx context.Context, tx ...*sql.Tx) error
-	// MigrateUp creates the chat and message tables
+	// MigrateUp creates the chat and message tables, and the tables related to them
 	MigrateUp(ctx context.Context, tx ...*sql.Tx) error
 
 	EnableDebug(enabled bool)
@@ -39,49 +81,170 @@ type StoreInterface interface {
 	ChatDelete(chat ChatInterface) error
 	ChatDeleteByID(id string) error
 	ChatFindByID(id string) (ChatInterface, error)
+	ChatFindOrCreateDirect(userA string, userB string) (chat ChatInterface, created bool, err error)
 	ChatList(options ChatQueryInterface) ([]ChatInterface, error)
+	ChatListWithSummary(options ChatQueryInterface, summaryOptions ChatSummaryOptions) ([]ChatSummary, error)
+	ChatMetaDelete(chatID string, key string) error
+	ChatMetaSet(chatID string, key string, value string) error
+	ChatQuery(options ChatQueryInterface) (ChatQueryResult, error)
 	ChatSoftDelete(chat ChatInterface) error
 	ChatSoftDeleteByID(id string) error
 	ChatUpdate(chat ChatInterface) error
+	ChatUpdateWithRetry(id string, mutate func(chat ChatInterface) error) error
+	ChatUpsert(chat ChatInterface) error
+
+	// ChatUserSettingsFind returns the settings of the chat for the user
+	ChatUserSettingsFind(chatID string, userID string) (ChatUserSettings, error)
+	// ChatUserSettingsSave saves the settings of the chat for the user
+	ChatUserSettingsSave(settings ChatUserSettings) error
+	// ChatUserSettingsUpdate changes the settings of the chat for the user
+	ChatUserSettingsUpdate(chatID string, userID string, mutate func(settings *ChatUserSettings)) error
 
 	MessageCount(options MessageQueryInterface) (int64, error)
 	MessageCreate(message MessageInterface) error
+	MessageCreateIdempotent(message MessageInterface) (existing MessageInterface, created bool, err error)
 	MessageDelete(message MessageInterface) error
 	MessageDeleteByID(id string) error
 	MessageFindByID(id string) (MessageInterface, error)
 	MessageList(options MessageQueryInterface) ([]MessageInterface, error)
+	MessageMetaDelete(messageID string, key string) error
+	MessageMetaSet(messageID string, key string, value string) error
+	MessageQuery(options MessageQueryInterface) (MessageQueryResult, error)
 	MessageSoftDelete(message MessageInterface) error
 	MessageSoftDeleteByID(id string) error
 	MessageUpdate(message MessageInterface) error
+	MessageUpdateWithRetry(id string, mutate func(message MessageInterface) error) error
+	MessageUpsert(message MessageInterface) error
+
+	// MessagePublishDue publishes the scheduled messages due at the given time
+	MessagePublishDue(now time.Time) ([]MessageInterface, error)
+	// MessagePurgeExpired permanently deletes the messages expired at the given time
+	MessagePurgeExpired(now time.Time) (int64, error)
+
+	// MessageDeliveryList returns the deliveries of the message to its recipients
+	MessageDeliveryList(messageID string) ([]MessageDelivery, error)
+	// MessageMarkDelivered records the message as delivered to the recipient
+	MessageMarkDelivered(messageID string, recipientID string) error
+	// MessageMarkFailed records a failed attempt to deliver the message to the recipient
+	MessageMarkFailed(messageID string, recipientID string, reason string) error
+	// MessageMarkRead records the message as read by the recipient
+	MessageMarkRead(messageID string, recipientID string) error
+	// MessageMarkSent records the message as sent to the recipients
+	MessageMarkSent(messageID string, recipientIDs ...string) error
+
+	// MessageListPinned returns the messages pinned to the chat, most recently pinned first
+	MessageListPinned(chatID string) ([]MessageInterface, error)
+	// MessageListStarred returns the messages starred by the user, most recently starred first
+	MessageListStarred(userID string) ([]MessageInterface, error)
+	// MessagePin pins the message to its chat
+	MessagePin(messageID string, userID string) error
+	// MessageStar stars the message for the user
+	MessageStar(messageID string, userID string) error
+	// MessageUnpin unpins the message from its chat
+	MessageUnpin(messageID string) error
+	// MessageUnstar removes the star of the user from the message
+	MessageUnstar(messageID string, userID string) error
+
+	// MessageListMentioning returns the messages matching the query which mention the user
+	MessageListMentioning(userID string, options MessageQueryInterface) ([]MessageInterface, error)
+	// MessageMentionList returns the users mentioned in the message
+	MessageMentionList(messageID string) ([]Mention, error)
+	// MessageUnreadMentionCounts counts the unread messages mentioning the user per chat
+	MessageUnreadMentionCounts(userID string) (map[string]int64, error)
+
+	// MessageApprove approves the message on behalf of the reviewer
+	MessageApprove(messageID string, reviewerID string, note string) error
+	// MessageModerationLog returns the moderation decisions taken on the message
+	MessageModerationLog(messageID string) ([]ModerationEntry, error)
+	// MessageModerationQueue returns the flagged messages matching the query, waiting for review
+	MessageModerationQueue(options MessageQueryInterface) ([]MessageInterface, error)
+	// MessageReject rejects the message on behalf of the reviewer, hiding it
+	MessageReject(messageID string, reviewerID string, reason string) error
+
+	// MessageReencrypt re-encrypts the messages encrypted with an older key
+	MessageReencrypt(batchSize int) (int64, error)
+
+	// StatsActiveChats counts the chats with messages matching the query
+	StatsActiveChats(options MessageQueryInterface) (int64, error)
+	// StatsMedianResponseTime returns the median time between a message and the reply to it
+	StatsMedianResponseTime(options MessageQueryInterface) (time.Duration, error)
+	// StatsMessageVolume counts the messages per period, optionally per chat or sender
+	StatsMessageVolume(options MessageQueryInterface, period string, groupBy string) ([]MessageVolume, error)
+	// StatsTopSenders returns the senders with the most messages
+	StatsTopSenders(options MessageQueryInterface, limit int) ([]SenderCount, error)
+
+	// RecomputeChatStats recomputes the last message time and message count
+	// of the chats (all chats when no IDs are given) from their messages
+	RecomputeChatStats(chatIDs ...string) error
 }
 
 // == TYPE ====================================================================
 
+// updateRetryAttempts is the number of attempts made by the update with retry
+// methods before giving up with ErrStaleEntity.
+const updateRetryAttempts = 5
+
 var _ StoreInterface = (*storeImplementation)(nil)
 
 // storeImplementation implements StoreInterface for chat operations.
 type storeImplementation struct {
-	tableChat          string
-	tableMessage       string
-	db                 *neat.Database
-	automigrateEnabled bool
-	debugEnabled       bool
-	logger             *slog.Logger
+	tableChat             string
+	tableMessage          string
+	tableDelivery         string
+	tableStar             string
+	tableMention          string
+	tableChatUserSettings string
+	tableModeration       string
+	db                    *neat.Database
+	automigrateEnabled    bool
+	debugEnabled          bool
+	logger                *slog.Logger
+
+	chatIndexedMetaKeys    []string
+	messageIndexedMetaKeys []string
+
+	mentionParser MentionParser
+
+	chatStatusMachine    *StatusMachine
+	messageStatusMachine *StatusMachine
+
+	chatValidators    []ChatValidator
+	messageValidators []MessageValidator
+
+	moderator Moderator
+	encryptor Encryptor
+
+	// tenantID is the tenant the store is scoped to, empty for the root store
+	tenantID string
+
+	policy Policy
+	// principal is the user the store acts for, nil for the root store
+	principal *Principal
 }
 
 // == MIGRATE =================================================================
 
-// MigrateUp creates the chat and message tables if they do not already exist.
+// MigrateUp creates the chat and message tables, and the tables related to
+// them, if they do not already exist.
 func (st *storeImplementation) MigrateUp(ctx context.Context, tx ...*sql.Tx) error {
+	if err := st.storeAuthorize(ACCESS_ACTION_ADMINISTER); err != nil {
+		return err
+	}
+
 	if st.db.Schema().HasTable(st.tableChat) && st.db.Schema().HasTable(st.tableMessage) {
 		if st.debugEnabled {
 			st.logger.Info("MigrateUp: tables already exist", "chat_table", st.tableChat, "message_table", st.tableMessage)
 		}
-		return nil
+
+		if err := st.migrateRelatedTables(); err != nil {
+			return err
+		}
+
+		return st.migrateColumns()
 	}
 
 	err := st.db.Schema().Create(st.tableChat, func(table contractsschema.Blueprint) {
-		table.String(COLUMN_ID, 21)
+		table.String(COLUMN_ID, 40)
 		table.Primary(COLUMN_ID)
 		table.String(COLUMN_STATUS, 40)
 		table.String(COLUMN_OWNER_ID, 40)
@@ -101,9 +264,9 @@ func (st *storeImplementation) MigrateUp(ctx context.Context, tx ...*sql.Tx) err
 	}
 
 	err = st.db.Schema().Create(st.tableMessage, func(table contractsschema.Blueprint) {
-		table.String(COLUMN_ID, 21)
+		table.String(COLUMN_ID, 40)
 		table.Primary(COLUMN_ID)
-		table.String(COLUMN_CHAT_ID, 21)
+		table.String(COLUMN_CHAT_ID, 40)
 		table.String(COLUMN_STATUS, 40)
 		table.String(COLUMN_SENDER_ID, 40)
 		table.String(COLUMN_RECIPIENT_ID, 40)
@@ -122,11 +285,428 @@ func (st *storeImplementation) MigrateUp(ctx context.Context, tx ...*sql.Tx) err
 		return err
 	}
 
+	if err := st.migrateRelatedTables(); err != nil {
+		return err
+	}
+
+	return st.migrateColumns()
+}
+
+// migrateRelatedTables creates the tables related to chats and messages which
+// do not yet exist. They were added after the chat and message tables, so existing
+// stores get them on their next migration.
+func (st *storeImplementation) migrateRelatedTables() error {
+	if err := st.migrateDeliveryTable(); err != nil {
+		return err
+	}
+
+	if err := st.migrateStarTable(); err != nil {
+		return err
+	}
+
+	if err := st.migrateMentionTable(); err != nil {
+		return err
+	}
+
+	if err := st.migrateChatUserSettingsTable(); err != nil {
+		return err
+	}
+
+	return st.migrateModerationTable()
+}
+
+// migrateModerationTable creates the moderation log table if it does not already exist.
+func (st *storeImplementation) migrateModerationTable() error {
+	if st.db.Schema().HasTable(st.tableModeration) {
+		return nil
+	}
+
+	err := st.db.Schema().Create(st.tableModeration, func(table contractsschema.Blueprint) {
+		table.String(COLUMN_ID, 40)
+		table.Primary(COLUMN_ID)
+		table.String(COLUMN_MESSAGE_ID, 40)
+		table.String(COLUMN_ACTION, 40)
+		table.String(COLUMN_REVIEWER_ID, 40).Nullable()
+		table.String(COLUMN_REASON, 255).Nullable()
+		table.DateTime(COLUMN_CREATED_AT)
+		// Lists the moderation log of a message
+		table.Index(COLUMN_MESSAGE_ID, COLUMN_CREATED_AT).Name("idx_" + st.tableModeration + "_" + COLUMN_MESSAGE_ID)
+	})
+
+	if err != nil {
+		if st.debugEnabled {
+			st.logger.Error("MigrateUp moderation table failed", "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// migrateDeliveryTable creates the delivery table if it does not already exist.
+func (st *storeImplementation) migrateDeliveryTable() error {
+	if st.db.Schema().HasTable(st.tableDelivery) {
+		return nil
+	}
+
+	err := st.db.Schema().Create(st.tableDelivery, func(table contractsschema.Blueprint) {
+		table.String(COLUMN_MESSAGE_ID, 40)
+		table.String(COLUMN_RECIPIENT_ID, 40)
+		table.Primary(COLUMN_MESSAGE_ID, COLUMN_RECIPIENT_ID)
+		table.String(COLUMN_STATUS, 40)
+		table.Integer(COLUMN_ATTEMPTS).Default(0)
+		table.String(COLUMN_FAILURE_REASON, 255).Nullable()
+		table.DateTime(COLUMN_CREATED_AT)
+		table.DateTime(COLUMN_UPDATED_AT)
+		// Looks up the undelivered messages of a recipient
+		table.Index(COLUMN_RECIPIENT_ID, COLUMN_STATUS).Name("idx_" + st.tableDelivery + "_" + COLUMN_RECIPIENT_ID + "_" + COLUMN_STATUS)
+	})
+
+	if err != nil {
+		if st.debugEnabled {
+			st.logger.Error("MigrateUp delivery table failed", "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// migrateStarTable creates the star table if it does not already exist.
+func (st *storeImplementation) migrateStarTable() error {
+	if st.db.Schema().HasTable(st.tableStar) {
+		return nil
+	}
+
+	err := st.db.Schema().Create(st.tableStar, func(table contractsschema.Blueprint) {
+		table.String(COLUMN_MESSAGE_ID, 40)
+		table.String(COLUMN_USER_ID, 40)
+		table.Primary(COLUMN_MESSAGE_ID, COLUMN_USER_ID)
+		table.DateTime(COLUMN_STARRED_AT)
+		// Lists the starred messages of a user
+		table.Index(COLUMN_USER_ID, COLUMN_STARRED_AT).Name("idx_" + st.tableStar + "_" + COLUMN_USER_ID + "_" + COLUMN_STARRED_AT)
+	})
+
+	if err != nil {
+		if st.debugEnabled {
+			st.logger.Error("MigrateUp star table failed", "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// migrateMentionTable creates the mention table if it does not already exist.
+func (st *storeImplementation) migrateMentionTable() error {
+	if st.db.Schema().HasTable(st.tableMention) {
+		return nil
+	}
+
+	err := st.db.Schema().Create(st.tableMention, func(table contractsschema.Blueprint) {
+		table.String(COLUMN_MESSAGE_ID, 40)
+		table.String(COLUMN_USER_ID, 40)
+		table.Integer(COLUMN_TEXT_OFFSET)
+		table.Primary(COLUMN_MESSAGE_ID, COLUMN_USER_ID, COLUMN_TEXT_OFFSET)
+		// Looks up the messages mentioning a user
+		table.Index(COLUMN_USER_ID).Name("idx_" + st.tableMention + "_" + COLUMN_USER_ID)
+	})
+
+	if err != nil {
+		if st.debugEnabled {
+			st.logger.Error("MigrateUp mention table failed", "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// migrateChatUserSettingsTable creates the chat user settings table if it
+// does not already exist.
+func (st *storeImplementation) migrateChatUserSettingsTable() error {
+	if st.db.Schema().HasTable(st.tableChatUserSettings) {
+		return nil
+	}
+
+	err := st.db.Schema().Create(st.tableChatUserSettings, func(table contractsschema.Blueprint) {
+		table.String(COLUMN_CHAT_ID, 40)
+		table.String(COLUMN_USER_ID, 40)
+		table.Primary(COLUMN_CHAT_ID, COLUMN_USER_ID)
+		table.Boolean(COLUMN_ARCHIVED).Default(false)
+		table.Boolean(COLUMN_HIDDEN).Default(false)
+		table.DateTime(COLUMN_MUTED_UNTIL).Nullable()
+		table.String(COLUMN_NOTIFICATION_LEVEL, 40)
+		table.String(COLUMN_CUSTOM_TITLE, 255).Nullable()
+		table.DateTime(COLUMN_CREATED_AT)
+		table.DateTime(COLUMN_UPDATED_AT)
+		// Looks up the archived and hidden chats of a user
+		table.Index(COLUMN_USER_ID).Name("idx_" + st.tableChatUserSettings + "_" + COLUMN_USER_ID)
+	})
+
+	if err != nil {
+		if st.debugEnabled {
+			st.logger.Error("MigrateUp chat user settings table failed", "error", err)
+		}
+		return err
+	}
+
+	return nil
+}
+
+// tableColumn describes a column added to the initial table schema,
+// so that both new and existing tables can be brought up to date.
+type tableColumn struct {
+	name   string
+	define func(table contractsschema.Blueprint)
+	// unique lists the columns of the unique index named idx_<table>_<column>
+	// added along with the column, none when empty
+	unique []string
+}
+
+// chatTableColumns returns the columns added to the initial chat table schema.
+func (st *storeImplementation) chatTableColumns() []tableColumn {
+	return []tableColumn{
+		{COLUMN_VERSION, func(table contractsschema.Blueprint) {
+			table.Integer(COLUMN_VERSION).Default(0)
+		}, nil},
+		{COLUMN_LAST_MESSAGE_AT, func(table contractsschema.Blueprint) {
+			table.DateTime(COLUMN_LAST_MESSAGE_AT).Nullable()
+			table.Index(COLUMN_LAST_MESSAGE_AT).Name("idx_" + st.tableChat + "_" + COLUMN_LAST_MESSAGE_AT)
+		}, nil},
+		{COLUMN_MESSAGE_COUNT, func(table contractsschema.Blueprint) {
+			table.Integer(COLUMN_MESSAGE_COUNT).Default(0)
+		}, nil},
+		// Unique, so that concurrent callers converge on a single direct chat.
+		// Chats without a key hold NULL, which is not subject to the constraint
+		{COLUMN_DIRECT_KEY, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_DIRECT_KEY, 255).Nullable()
+		}, []string{COLUMN_DIRECT_KEY}},
+		{COLUMN_TENANT_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_TENANT_ID, 40).Nullable()
+			table.Index(COLUMN_TENANT_ID).Name("idx_" + st.tableChat + "_" + COLUMN_TENANT_ID)
+		}, nil},
+	}
+}
+
+// messageTableColumns returns the columns added to the initial message table schema.
+func (st *storeImplementation) messageTableColumns() []tableColumn {
+	return []tableColumn{
+		{COLUMN_VERSION, func(table contractsschema.Blueprint) {
+			table.Integer(COLUMN_VERSION).Default(0)
+		}, nil},
+		// Unique per chat, so that a resent message is not stored twice.
+		// Messages without a key hold NULL, which is not subject to the constraint
+		{COLUMN_CLIENT_MESSAGE_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_CLIENT_MESSAGE_ID, 255).Nullable()
+		}, []string{COLUMN_CHAT_ID, COLUMN_CLIENT_MESSAGE_ID}},
+		// Indexed for the scheduler, which looks up the due and expired messages
+		{COLUMN_SCHEDULED_AT, func(table contractsschema.Blueprint) {
+			table.DateTime(COLUMN_SCHEDULED_AT).Nullable()
+			table.Index(COLUMN_SCHEDULED_AT).Name("idx_" + st.tableMessage + "_" + COLUMN_SCHEDULED_AT)
+		}, nil},
+		{COLUMN_EXPIRES_AT, func(table contractsschema.Blueprint) {
+			table.DateTime(COLUMN_EXPIRES_AT).Nullable()
+			table.Index(COLUMN_EXPIRES_AT).Name("idx_" + st.tableMessage + "_" + COLUMN_EXPIRES_AT)
+		}, nil},
+		{COLUMN_DELIVERY_STATUS, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_DELIVERY_STATUS, 40).Nullable()
+		}, nil},
+		{COLUMN_PINNED_AT, func(table contractsschema.Blueprint) {
+			table.DateTime(COLUMN_PINNED_AT).Nullable()
+			table.Index(COLUMN_CHAT_ID, COLUMN_PINNED_AT).Name("idx_" + st.tableMessage + "_" + COLUMN_PINNED_AT)
+		}, nil},
+		{COLUMN_PINNED_BY, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_PINNED_BY, 40).Nullable()
+		}, nil},
+		// Indexed for the review queue, which looks up the flagged messages
+		{COLUMN_MODERATION_STATE, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_MODERATION_STATE, 40).Nullable()
+			table.Index(COLUMN_MODERATION_STATE).Name("idx_" + st.tableMessage + "_" + COLUMN_MODERATION_STATE)
+		}, nil},
+		{COLUMN_TENANT_ID, func(table contractsschema.Blueprint) {
+			table.String(COLUMN_TENANT_ID, 40).Nullable()
+			table.Index(COLUMN_TENANT_ID, COLUMN_CHAT_ID).Name("idx_" + st.tableMessage + "_" + COLUMN_TENANT_ID)
+		}, nil},
+	}
+}
+
+// migrateColumns adds any missing columns to the chat and message tables.
+func (st *storeImplementation) migrateColumns() error {
+	// The activity columns of existing chats are filled in once when added
+	backfillChatStats := !st.db.Schema().HasColumn(st.tableChat, COLUMN_MESSAGE_COUNT)
+
+	if err := st.migrateTableColumns(st.tableChat, st.chatTableColumns()); err != nil {
+		return err
+	}
+
+	if err := st.migrateTableColumns(st.tableMessage, st.messageTableColumns()); err != nil {
+		return err
+	}
+
+	if err := st.migrateMetaColumns(st.tableChat, st.chatIndexedMetaKeys); err != nil {
+		return err
+	}
+
+	if err := st.migrateMetaColumns(st.tableMessage, st.messageIndexedMetaKeys); err != nil {
+		return err
+	}
+
+	if err := st.migrateIDColumns(); err != nil {
+		return err
+	}
+
+	if backfillChatStats {
+		return st.RecomputeChatStats()
+	}
+
+	return nil
+}
+
+// migrateTableColumns adds the columns (and unique indexes) which do not yet
+// exist to the table.
+func (st *storeImplementation) migrateTableColumns(tableName string, columns []tableColumn) error {
+	for _, column := range columns {
+		if !st.db.Schema().HasColumn(tableName, column.name) {
+			if err := st.db.Schema().Table(tableName, column.define); err != nil {
+				if st.debugEnabled {
+					st.logger.Error("MigrateUp add column failed", "table", tableName, "column", column.name, "error", err)
+				}
+				return err
+			}
+		}
+
+		if len(column.unique) == 0 {
+			continue
+		}
+
+		// Created with plain SQL, as the blueprint creates a non unique index on SQLite
+		index := "idx_" + tableName + "_" + column.name
+		if st.db.Schema().HasIndex(tableName, index) {
+			continue
+		}
+
+		quoted := make([]string, 0, len(column.unique))
+		for _, name := range column.unique {
+			quoted = append(quoted, st.quoteIdentifier(name))
+		}
+
+		sql := "CREATE UNIQUE INDEX " + st.quoteIdentifier(index) +
+			" ON " + st.quoteIdentifier(tableName) + " (" + strings.Join(quoted, ", ") + ")"
+		if err := st.db.Schema().Sql(sql); err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateUp add unique index failed", "table", tableName, "index", index, "error", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// migrateIDColumns widens the ID columns, created 21 characters wide by
+// earlier versions, to MAX_LENGTH_ID. SQLite does not enforce the widths.
+func (st *storeImplementation) migrateIDColumns() error {
+	if st.dialect() == contractsdatabase.DriverSqlite {
+		return nil
+	}
+
+	idColumns := map[string][]string{
+		st.tableChat:             {COLUMN_ID},
+		st.tableMessage:          {COLUMN_ID, COLUMN_CHAT_ID},
+		st.tableModeration:       {COLUMN_ID, COLUMN_MESSAGE_ID},
+		st.tableDelivery:         {COLUMN_MESSAGE_ID},
+		st.tableStar:             {COLUMN_MESSAGE_ID},
+		st.tableMention:          {COLUMN_MESSAGE_ID},
+		st.tableChatUserSettings: {COLUMN_CHAT_ID},
+	}
+
+	for _, tableName := range slices.Sorted(maps.Keys(idColumns)) {
+		columns, err := st.db.Schema().GetColumns(tableName)
+		if err != nil {
+			return err
+		}
+
+		for _, column := range columns {
+			if !slices.Contains(idColumns[tableName], column.Name) {
+				continue
+			}
+
+			if length, ok := columnTypeLength(column.Type); !ok || length >= MAX_LENGTH_ID {
+				continue
+			}
+
+			err := st.db.Schema().Table(tableName, func(table contractsschema.Blueprint) {
+				table.String(column.Name, MAX_LENGTH_ID).Change()
+			})
+			if err != nil {
+				if st.debugEnabled {
+					st.logger.Error("MigrateUp widen column failed", "table", tableName, "column", column.Name, "error", err)
+				}
+				return err
+			}
+		}
+	}
+
 	return nil
 }
 
-// MigrateDown drops the chat and message tables.
+// MigrateDown drops the chat and message tables, and the tables related to them.
 func (st *storeImplementation) MigrateDown(ctx context.Context, tx ...*sql.Tx) error {
+	if err := st.storeAuthorize(ACCESS_ACTION_ADMINISTER); err != nil {
+		return err
+	}
+
+	if st.db.Schema().HasTable(st.tableModeration) {
+		err := st.db.Schema().Drop(st.tableModeration)
+		if err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateDown moderation table failed", "error", err)
+			}
+			return err
+		}
+	}
+
+	if st.db.Schema().HasTable(st.tableChatUserSettings) {
+		err := st.db.Schema().Drop(st.tableChatUserSettings)
+		if err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateDown chat user settings table failed", "error", err)
+			}
+			return err
+		}
+	}
+
+	if st.db.Schema().HasTable(st.tableMention) {
+		err := st.db.Schema().Drop(st.tableMention)
+		if err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateDown mention table failed", "error", err)
+			}
+			return err
+		}
+	}
+
+	if st.db.Schema().HasTable(st.tableStar) {
+		err := st.db.Schema().Drop(st.tableStar)
+		if err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateDown star table failed", "error", err)
+			}
+			return err
+		}
+	}
+
+	if st.db.Schema().HasTable(st.tableDelivery) {
+		err := st.db.Schema().Drop(st.tableDelivery)
+		if err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateDown delivery table failed", "error", err)
+			}
+			return err
+		}
+	}
+
 	if st.db.Schema().HasTable(st.tableMessage) {
 		err := st.db.Schema().Drop(st.tableMessage)
 		if err != nil {
@@ -150,6 +730,45 @@ func (st *storeImplementation) MigrateDown(ctx context.Context, tx ...*sql.Tx) e
 	return nil
 }
 
+// migrateMetaColumns adds the indexed generated columns for the meta keys
+// which do not yet exist to the table.
+func (st *storeImplementation) migrateMetaColumns(tableName string, keys []string) error {
+	for _, key := range keys {
+		column := metaColumnName(key)
+
+		if !st.db.Schema().HasColumn(tableName, column) {
+			sql, err := st.metaColumnSQL(tableName, key)
+			if err != nil {
+				return err
+			}
+
+			if err := st.db.Schema().Sql(sql); err != nil {
+				if st.debugEnabled {
+					st.logger.Error("MigrateUp add meta column failed", "table", tableName, "column", column, "error", err)
+				}
+				return err
+			}
+		}
+
+		index := "idx_" + tableName + "_" + column
+		if st.db.Schema().HasIndex(tableName, index) {
+			continue
+		}
+
+		err := st.db.Schema().Table(tableName, func(table contractsschema.Blueprint) {
+			table.Index(column).Name(index)
+		})
+		if err != nil {
+			if st.debugEnabled {
+				st.logger.Error("MigrateUp add meta index failed", "table", tableName, "index", index, "error", err)
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
 // == DEBUG ===================================================================
 
 // EnableDebug enables or disables debug mode.
@@ -186,6 +805,56 @@ func (st *storeImplementation) SetMessageTableName(tableName string) {
 	st.tableMessage = tableName
 }
 
+// GetDeliveryTableName returns the message delivery table name.
+func (st *storeImplementation) GetDeliveryTableName() string {
+	return st.tableDelivery
+}
+
+// SetDeliveryTableName sets the message delivery table name.
+func (st *storeImplementation) SetDeliveryTableName(tableName string) {
+	st.tableDelivery = tableName
+}
+
+// GetStarTableName returns the message star table name.
+func (st *storeImplementation) GetStarTableName() string {
+	return st.tableStar
+}
+
+// SetStarTableName sets the message star table name.
+func (st *storeImplementation) SetStarTableName(tableName string) {
+	st.tableStar = tableName
+}
+
+// GetMentionTableName returns the message mention table name.
+func (st *storeImplementation) GetMentionTableName() string {
+	return st.tableMention
+}
+
+// SetMentionTableName sets the message mention table name.
+func (st *storeImplementation) SetMentionTableName(tableName string) {
+	st.tableMention = tableName
+}
+
+// GetChatUserSettingsTableName returns the chat user settings table name.
+func (st *storeImplementation) GetChatUserSettingsTableName() string {
+	return st.tableChatUserSettings
+}
+
+// SetChatUserSettingsTableName sets the chat user settings table name.
+func (st *storeImplementation) SetChatUserSettingsTableName(tableName string) {
+	st.tableChatUserSettings = tableName
+}
+
+// GetModerationTableName returns the message moderation log table name.
+func (st *storeImplementation) GetModerationTableName() string {
+	return st.tableModeration
+}
+
+// SetModerationTableName sets the message moderation log table name.
+func (st *storeImplementation) SetModerationTableName(tableName string) {
+	st.tableModeration = tableName
+}
+
 // == CHAT METHODS ============================================================
 
 // ChatCount counts the number of chats that match the query.
@@ -194,43 +863,67 @@ func (st *storeImplementation) ChatCount(options ChatQueryInterface) (int64, err
 		return 0, errors.New("query is nil")
 	}
 
-	q := st.buildChatQuery(options)
+	q := st.buildChatQueryFilters(options)
 
 	var count int64
 	err := q.Table(st.tableChat).Count(&count)
 	return count, err
 }
 
-// ChatCreate creates a new chat.
+// ChatCreate creates a new chat. Its status must be allowed by the chat
+// status machine, or ErrInvalidStatus is returned. Direct chats are created
+// by ChatFindOrCreateDirect, a direct key set by the caller returns
+// ErrDirectKey.
 func (st *storeImplementation) ChatCreate(chat ChatInterface) error {
 	if chat == nil {
 		return errors.New("chat is nil")
 	}
 
+	// Direct chats are created by ChatFindOrCreateDirect only
+	if chat.DirectKey() != "" {
+		return ErrDirectKey
+	}
+
+	return st.chatCreate(chat)
+}
+
+// chatCreate creates the chat, direct or not.
+func (st *storeImplementation) chatCreate(chat ChatInterface) error {
 	if chat.ID() == "" {
 		return errors.New("chat ID is required")
 	}
 
-	chat.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
-	chat.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	if err := st.chatNewAuthorize(chat, ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
 
-	row := map[string]any{
-		COLUMN_ID:              chat.ID(),
-		COLUMN_STATUS:          chat.Status(),
-		COLUMN_OWNER_ID:        chat.OwnerID(),
-		COLUMN_TITLE:           chat.Title(),
-		COLUMN_MEMO:            chat.Memo(),
-		COLUMN_METAS:           chat.(*chatImplementation).MetasField,
-		COLUMN_CREATED_AT:      chat.CreatedAtCarbon().StdTime(),
-		COLUMN_UPDATED_AT:      chat.UpdatedAtCarbon().StdTime(),
-		COLUMN_SOFT_DELETED_AT: chat.SoftDeletedAtCarbon().StdTime(),
+	if err := st.chatValidate(chat); err != nil {
+		return err
+	}
+
+	if err := st.chatStatusMachine.ValidateStatus(chat.Status()); err != nil {
+		return err
+	}
+
+	chat.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	chat.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+
+	if st.tenantID != "" {
+		chat.SetTenantID(st.tenantID)
 	}
 
+	row := chatInsertRow(chat)
+
 	if st.debugEnabled {
 		st.logger.Debug("Chat create", "id", chat.ID())
 	}
 
-	return st.db.Query().Table(st.tableChat).Create(row)
+	if err := st.db.Query().Table(st.tableChat).Create(row); err != nil {
+		return err
+	}
+
+	chat.MarkAsNotDirty()
+	return nil
 }
 
 // ChatDelete permanently deletes a chat.
@@ -247,11 +940,30 @@ func (st *storeImplementation) ChatDeleteByID(id string) error {
 		return errors.New("chat ID is required")
 	}
 
-	_, err := st.db.Query().
-		Table(st.tableChat).
-		Where(COLUMN_ID+" = ?", id).
-		Delete()
-	return err
+	if err := st.chatAuthorize(id, ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
+
+	// The chat and the settings of its users are deleted together
+	return st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		result, err := st.tenantScope(txQuery(tx).Table(st.tableChat)).
+			Where(COLUMN_ID+" = ?", id).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		// The settings of a chat of another tenant are left alone
+		if result.RowsAffected == 0 && st.tenantID != "" {
+			return nil
+		}
+
+		_, err = txQuery(tx).
+			Table(st.tableChatUserSettings).
+			Where(COLUMN_CHAT_ID+" = ?", id).
+			Delete()
+		return err
+	})
 }
 
 // ChatFindByID finds a chat by ID.
@@ -260,6 +972,13 @@ func (st *storeImplementation) ChatFindByID(chatID string) (ChatInterface, error
 		return nil, errors.New("chat ID is required")
 	}
 
+	if st.principal != nil {
+		if err := st.chatAuthorize(chatID, ACCESS_ACTION_READ); err != nil {
+			return nil, err
+		}
+		return st.accessUnchecked().ChatFindByID(chatID)
+	}
+
 	list, err := st.ChatList(ChatQuery().
 		SetID(chatID).
 		SetLimit(1))
@@ -274,64 +993,325 @@ func (st *storeImplementation) ChatFindByID(chatID string) (ChatInterface, error
 	return nil, nil
 }
 
+// ChatFindOrCreateDirect finds the one-to-one chat between the two users, in
+// either order, creating it (owned by the first user) when it does not yet exist.
+// The unique direct key makes concurrent callers converge on the same chat:
+// when the create loses the race, the chat created by the winner is returned.
+// A soft deleted direct chat is returned as found, for the caller to restore.
+func (st *storeImplementation) ChatFindOrCreateDirect(userA string, userB string) (ChatInterface, bool, error) {
+	if userA == "" || userB == "" {
+		return nil, false, errors.New("both user IDs are required")
+	}
+
+	if strings.ContainsAny(userA, directKeySeparators) || strings.ContainsAny(userB, directKeySeparators) {
+		return nil, false, errors.New("user IDs of a direct chat must not contain a colon or a slash")
+	}
+
+	directKey := st.tenantDirectKey(userA, userB)
+
+	// The users of the direct chat may find it, whoever of them created it
+	if st.principal != nil {
+		if err := st.chatNewAuthorize(NewChat().SetOwnerID(userA).SetDirectKey(directKey), ACCESS_ACTION_READ); err != nil {
+			return nil, false, err
+		}
+		return st.accessUnchecked().ChatFindOrCreateDirect(userA, userB)
+	}
+
+	chat, err := st.chatFindByDirectKey(directKey)
+	if err != nil || chat != nil {
+		return chat, false, err
+	}
+
+	chat = NewChat().
+		SetOwnerID(userA).
+		SetDirectKey(directKey)
+
+	createErr := st.chatCreate(chat)
+	if createErr == nil {
+		return chat, true, nil
+	}
+
+	// Most likely created concurrently, violating the unique direct key
+	existing, err := st.chatFindByDirectKey(directKey)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if existing == nil {
+		return nil, false, createErr
+	}
+
+	return existing, false, nil
+}
+
+// chatFindByDirectKey finds the chat with the direct key, soft deleted or not.
+func (st *storeImplementation) chatFindByDirectKey(directKey string) (ChatInterface, error) {
+	list, err := st.ChatList(ChatQuery().
+		SetDirectKey(directKey).
+		SetWithSoftDeleted(true).
+		SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
 // ChatList lists chats based on the query.
 func (st *storeImplementation) ChatList(query ChatQueryInterface) ([]ChatInterface, error) {
 	if query == nil {
 		return nil, errors.New("query is nil")
 	}
 
-	type chatRow struct {
-		ID            string    `db:"id"`
-		Status        string    `db:"status"`
-		OwnerID       string    `db:"owner_id"`
-		Title         string    `db:"title"`
-		Memo          string    `db:"memo"`
-		Metas         string    `db:"metas"`
-		CreatedAt     time.Time `db:"created_at"`
-		UpdatedAt     time.Time `db:"updated_at"`
-		SoftDeletedAt time.Time `db:"soft_deleted_at"`
-	}
-
 	q := st.buildChatQuery(query)
 
+	// Selected explicitly, as the columns neat derives from the model
+	// leave out the embedded timestamps
 	var rows []chatRow
-	if err := q.Table(st.tableChat).Get(&rows); err != nil {
+	if err := q.Table(st.tableChat).Select("*").Get(&rows); err != nil {
 		return []ChatInterface{}, err
 	}
 
 	list := make([]ChatInterface, 0, len(rows))
 	for _, r := range rows {
-		chat := &chatImplementation{}
-		chat.SetID(r.ID)
-		chat.StatusField = r.Status
-		chat.OwnerIDField = r.OwnerID
-		chat.TitleField = r.Title
-		chat.MemoField = r.Memo
-		chat.MetasField = r.Metas
-		chat.CreatedAtField.CreatedAt = r.CreatedAt
-		chat.UpdatedAtField.UpdatedAt = r.UpdatedAt
-		chat.SoftDeletesMaxDate.SoftDeletedAt = r.SoftDeletedAt
-		list = append(list, chat)
+		list = append(list, r.toChat())
+	}
+
+	return list, nil
+}
+
+// ChatListWithSummary lists the chats matching the query along with their last
+// message, message count and (optionally) unread count for a user. The
+// summaries are fetched with a fixed number of queries, whatever the number
+// of chats listed.
+func (st *storeImplementation) ChatListWithSummary(query ChatQueryInterface, options ChatSummaryOptions) ([]ChatSummary, error) {
+	if query == nil {
+		return nil, errors.New("query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	type chatSummaryRow struct {
+		chatRow
+		MessageCount int64 `db:"summary_message_count"`
+	}
+
+	visible, visibleArgs := st.messageVisibleSQL("")
+
+	// The summary columns are prefixed, so that the unqualified chat columns
+	// used by the filters stay unambiguous in the join
+	summary := "SELECT " + COLUMN_CHAT_ID + " AS summary_chat_id" +
+		", COUNT(*) AS summary_message_count" +
+		", MAX(" + COLUMN_CREATED_AT + ") AS summary_last_message_at" +
+		" FROM " + st.tableMessage +
+		" WHERE " + COLUMN_SOFT_DELETED_AT + " > ?" + visible +
+		" GROUP BY " + COLUMN_CHAT_ID
+
+	q := st.buildChatQueryFilters(query).
+		Table(st.tableChat).
+		Select(st.tableChat+".*, summary.summary_message_count"+
+			", COALESCE(summary.summary_last_message_at, "+st.tableChat+"."+COLUMN_CREATED_AT+") AS summary_last_activity_at").
+		LeftJoin("("+summary+") summary ON summary.summary_chat_id = "+st.tableChat+"."+COLUMN_ID, append([]any{time.Now().UTC()}, visibleArgs...)...)
+
+	direction := lo.CoalesceOrEmpty(query.GetOrderDirection(), "DESC")
+	if options.OrderByLastActivity {
+		q = q.OrderBy("summary_last_activity_at", direction)
+	} else if query.IsOrderBySet() && query.GetOrderBy() != "" {
+		q = q.OrderBy(query.GetOrderBy(), direction)
+	}
+
+	if query.IsLimitSet() && query.GetLimit() > 0 {
+		q = q.Limit(query.GetLimit())
+	}
+
+	if query.IsOffsetSet() && query.GetOffset() > 0 {
+		q = q.Offset(query.GetOffset())
+	}
+
+	var rows []chatSummaryRow
+	if err := q.Get(&rows); err != nil {
+		return []ChatSummary{}, err
+	}
+
+	if len(rows) == 0 {
+		return []ChatSummary{}, nil
+	}
+
+	chatIDs := make([]string, 0, len(rows))
+	for _, r := range rows {
+		chatIDs = append(chatIDs, r.ID)
+	}
+
+	lastMessages, err := st.chatLastMessages(chatIDs)
+	if err != nil {
+		return []ChatSummary{}, err
+	}
+
+	unreadCounts := map[string]int64{}
+	if options.UnreadForUserID != "" {
+		unreadCounts, err = st.chatUnreadCounts(NewMessageQuery().SetChatIDIn(chatIDs), options.UnreadForUserID)
+		if err != nil {
+			return []ChatSummary{}, err
+		}
+	}
+
+	list := make([]ChatSummary, 0, len(rows))
+	for _, r := range rows {
+		chat := r.toChat()
+
+		lastActivityAt := r.CreatedAt
+		if lastMessage, ok := lastMessages[r.ID]; ok {
+			lastActivityAt = lastMessage.CreatedAtCarbon().StdTime()
+		}
+
+		list = append(list, ChatSummary{
+			Chat:           chat,
+			LastMessage:    lastMessages[r.ID],
+			LastActivityAt: lastActivityAt,
+			MessageCount:   r.MessageCount,
+			UnreadCount:    unreadCounts[r.ID],
+		})
 	}
 
 	return list, nil
 }
 
+// ChatMetaDelete removes the meta key from the chat directly in the database,
+// so that concurrent meta changes to other keys are not lost.
+func (st *storeImplementation) ChatMetaDelete(chatID string, key string) error {
+	if chatID == "" {
+		return errors.New("chat ID is required")
+	}
+
+	if key == "" {
+		return errors.New("meta key is required")
+	}
+
+	if err := st.chatAuthorize(chatID, ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
+
+	metas, err := st.metaDeleteExpr(key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := st.metasUpdate(st.tableChat, chatID, metas)
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ChatMetaSet sets the meta key of the chat directly in the database,
+// so that concurrent meta changes to other keys are not lost.
+func (st *storeImplementation) ChatMetaSet(chatID string, key string, value string) error {
+	if chatID == "" {
+		return errors.New("chat ID is required")
+	}
+
+	if key == "" {
+		return errors.New("meta key is required")
+	}
+
+	if err := st.chatAuthorize(chatID, ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
+
+	metas, err := st.metaSetExpr(key, value)
+	if err != nil {
+		return err
+	}
+
+	affected, err := st.metasUpdate(st.tableChat, chatID, metas)
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// ChatQuery executes the query and returns the requested page of chats together
+// with the total number of matching chats, ignoring limit and offset.
+// When count only is set on the query, only the total is calculated.
+func (st *storeImplementation) ChatQuery(options ChatQueryInterface) (ChatQueryResult, error) {
+	if options == nil {
+		return ChatQueryResult{}, errors.New("query is nil")
+	}
+
+	if err := options.Validate(); err != nil {
+		return ChatQueryResult{}, err
+	}
+
+	total, err := st.ChatCount(options)
+	if err != nil {
+		return ChatQueryResult{}, err
+	}
+
+	result := ChatQueryResult{
+		Items: []ChatInterface{},
+		Total: total,
+	}
+
+	if options.GetCountOnly() || total == 0 {
+		return result, nil
+	}
+
+	items, err := st.ChatList(options)
+	if err != nil {
+		return ChatQueryResult{}, err
+	}
+
+	result.Items = items
+	return result, nil
+}
+
 // ChatSoftDelete soft deletes a chat.
 func (st *storeImplementation) ChatSoftDelete(chat ChatInterface) error {
 	if chat == nil {
 		return errors.New("chat is nil")
 	}
 
-	chat.SetSoftDeletedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	if err := st.chatAuthorize(chat.ID(), ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
+
+	// The chat is only marked as deleted once the row is
+	softDeletedAt := carbon.Now(carbon.UTC)
 
 	row := map[string]any{
-		COLUMN_SOFT_DELETED_AT: chat.SoftDeletedAtCarbon().StdTime(),
-		COLUMN_UPDATED_AT:      carbon.Now(carbon.UTC).StdTime(),
+		COLUMN_SOFT_DELETED_AT: softDeletedAt.StdTime(),
+		COLUMN_UPDATED_AT:      softDeletedAt.StdTime(),
+		COLUMN_VERSION:         neatquery.RawExpr(COLUMN_VERSION + " + 1"),
 	}
 
-	_, err := st.db.Query().Table(st.tableChat).Where(COLUMN_ID+" = ?", chat.ID()).Update(row)
-	return err
+	result, err := st.tenantScope(st.db.Query().Table(st.tableChat)).Where(COLUMN_ID+" = ?", chat.ID()).Update(row)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+
+	chat.SetSoftDeletedAt(softDeletedAt.ToDateTimeString())
+	chat.SetVersion(chat.Version() + 1)
+	return nil
 }
 
 // ChatSoftDeleteByID soft deletes a chat by ID.
@@ -341,12 +1321,16 @@ func (st *storeImplementation) ChatSoftDeleteByID(id string) error {
 		return err
 	}
 	if chat == nil {
-		return errors.New("chat not found")
+		return ErrNotFound
 	}
 	return st.ChatSoftDelete(chat)
 }
 
-// ChatUpdate updates a chat.
+// ChatUpdate updates the changed fields of a chat. It returns ErrNotFound
+// when the chat does not exist and ErrStaleEntity when it was modified since loaded.
+// A changed status must be allowed by the chat status machine, or
+// ErrInvalidStatus or ErrInvalidStatusTransition is returned. The direct key
+// may not be changed, or ErrDirectKey is returned.
 func (st *storeImplementation) ChatUpdate(chat ChatInterface) error {
 	if chat == nil {
 		return errors.New("chat is nil")
@@ -356,222 +1340,1228 @@ func (st *storeImplementation) ChatUpdate(chat ChatInterface) error {
 		return errors.New("chat ID is required")
 	}
 
-	chat.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	if err := st.chatAuthorize(chat.ID(), ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
 
-	row := map[string]any{
+	if err := st.chatValidate(chat); err != nil {
+		return err
+	}
+
+	if slices.Contains(chat.DirtyFields(), COLUMN_DIRECT_KEY) {
+		return ErrDirectKey
+	}
+
+	// Only the changed columns are written, nothing at all if none changed
+	row := dirtyRow(chat.DirtyFields(), map[string]any{
 		COLUMN_STATUS:          chat.Status(),
 		COLUMN_OWNER_ID:        chat.OwnerID(),
 		COLUMN_TITLE:           chat.Title(),
 		COLUMN_MEMO:            chat.Memo(),
 		COLUMN_METAS:           chat.(*chatImplementation).MetasField,
-		COLUMN_UPDATED_AT:      chat.UpdatedAtCarbon().StdTime(),
 		COLUMN_SOFT_DELETED_AT: chat.SoftDeletedAtCarbon().StdTime(),
+	})
+
+	if len(row) == 0 {
+		return nil
 	}
 
-	_, err := st.db.Query().Table(st.tableChat).Where(COLUMN_ID+" = ?", chat.ID()).Update(row)
-	return err
+	chat.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	row[COLUMN_UPDATED_AT] = chat.UpdatedAtCarbon().StdTime()
+	row[COLUMN_VERSION] = chat.Version() + 1
+
+	// The status transition is checked against the status the update is
+	// written over
+	err := st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		if _, ok := row[COLUMN_STATUS]; ok {
+			err := st.statusTransitionCheck(txQuery(tx), st.tableChat, st.chatStatusMachine, chat.ID(), chat.Version(), chat.Status())
+			if err != nil {
+				return err
+			}
+		}
+
+		// The version precondition rejects the update when the chat
+		// was modified by someone else since it was loaded
+		result, err := st.tenantScope(txQuery(tx).Table(st.tableChat)).
+			Where(COLUMN_ID+" = ?", chat.ID()).
+			Where(COLUMN_VERSION+" = ?", chat.Version()).
+			Update(row)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			var count int64
+			err := st.tenantScope(txQuery(tx).Table(st.tableChat)).Where(COLUMN_ID+" = ?", chat.ID()).Count(&count)
+			if err != nil {
+				return err
+			}
+
+			if count > 0 {
+				return ErrStaleEntity
+			}
+
+			return ErrNotFound
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	chat.SetVersion(chat.Version() + 1)
+	chat.MarkAsNotDirty()
+	return nil
 }
 
-// == MESSAGE METHODS =========================================================
+// ChatUpdateWithRetry loads the chat, applies the mutation and updates it.
+// When the update fails with ErrStaleEntity, the chat is reloaded and the
+// mutation is applied again, up to a limited number of attempts.
+func (st *storeImplementation) ChatUpdateWithRetry(id string, mutate func(chat ChatInterface) error) error {
+	if mutate == nil {
+		return errors.New("mutate function is nil")
+	}
+
+	for attempt := 0; attempt < updateRetryAttempts; attempt++ {
+		chat, err := st.ChatFindByID(id)
+		if err != nil {
+			return err
+		}
+
+		if chat == nil {
+			return ErrNotFound
+		}
+
+		if err := mutate(chat); err != nil {
+			return err
+		}
+
+		err = st.ChatUpdate(chat)
+		if !errors.Is(err, ErrStaleEntity) {
+			return err
+		}
+	}
+
+	return ErrStaleEntity
+}
+
+// ChatUpsert inserts the chat, or updates all of its fields when a chat with
+// the same ID already exists, in a single dialect native statement. An updated
+// chat keeps its creation time and its version is incremented. Its status must
+// be allowed by the chat status machine, as must the transition to it from the
+// stored status of an updated chat. Its direct key must be the stored one,
+// none for a new chat, or ErrDirectKey is returned.
+func (st *storeImplementation) ChatUpsert(chat ChatInterface) error {
+	if chat == nil {
+		return errors.New("chat is nil")
+	}
+
+	if chat.ID() == "" {
+		return errors.New("chat ID is required")
+	}
+
+	if err := st.chatAuthorize(chat.ID(), ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
+
+	if err := st.chatNewAuthorize(chat, ACCESS_ACTION_MANAGE); err != nil {
+		return err
+	}
+
+	if err := st.chatValidate(chat); err != nil {
+		return err
+	}
+
+	if err := st.chatStatusMachine.ValidateStatus(chat.Status()); err != nil {
+		return err
+	}
+
+	if err := st.tenantIDConflict(st.tableChat, chat.ID()); err != nil {
+		return err
+	}
+
+	if st.tenantID != "" {
+		chat.SetTenantID(st.tenantID)
+	}
+
+	chat.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+
+	columns := []string{
+		COLUMN_STATUS,
+		COLUMN_OWNER_ID,
+		COLUMN_TITLE,
+		COLUMN_MEMO,
+		COLUMN_METAS,
+		COLUMN_UPDATED_AT,
+		COLUMN_SOFT_DELETED_AT,
+	}
+
+	if st.debugEnabled {
+		st.logger.Debug("Chat upsert", "id", chat.ID())
+	}
+
+	err := st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		// The direct key of the chat stays as stored, none for a new chat
+		stored, exists, err := st.chatStored(tx, chat.ID())
+		if err != nil {
+			return err
+		}
+
+		if chat.DirectKey() != stored.DirectKey {
+			return ErrDirectKey
+		}
+
+		if exists {
+			if err := st.chatStatusMachine.ValidateTransition(stored.Status, chat.Status()); err != nil {
+				return err
+			}
+		}
+
+		return st.upsert(tx, st.tableChat, chatInsertRow(chat), columns)
+	})
+	if err != nil {
+		return err
+	}
+
+	// The stored version and creation time depend on whether the chat existed
+	stored, err := st.ChatList(ChatQuery().SetID(chat.ID()).SetWithSoftDeleted(true).SetLimit(1))
+	if err != nil {
+		return err
+	}
+
+	if len(stored) > 0 {
+		chat.SetVersion(stored[0].Version())
+		chat.SetCreatedAt(stored[0].CreatedAt())
+	}
+
+	chat.MarkAsNotDirty()
+	return nil
+}
+
+// == MESSAGE METHODS =========================================================
+
+// MessageCount counts the number of messages that match the query.
+func (st *storeImplementation) MessageCount(options MessageQueryInterface) (int64, error) {
+	if options == nil {
+		return 0, errors.New("query is nil")
+	}
+
+	if err := st.messageQueryEncryptionCheck(options); err != nil {
+		return 0, err
+	}
+
+	q := st.buildMessageQueryFilters(options)
+
+	var count int64
+	err := q.Table(st.tableMessage).Count(&count)
+	return count, err
+}
+
+// MessageCreate creates a new message. A message scheduled in the future is
+// stored with the scheduled status and published by MessagePublishDue.
+// Its status must be allowed by the message status machine, or
+// ErrInvalidStatus is returned. The moderator, when set, screens the
+// message first.
+func (st *storeImplementation) MessageCreate(message MessageInterface) error {
+	if message == nil {
+		return errors.New("message is nil")
+	}
+
+	if message.ID() == "" {
+		return errors.New("message ID is required")
+	}
+
+	if err := st.messageChatAuthorize(message.ChatID(), message.SenderID(), ACCESS_ACTION_SEND); err != nil {
+		return err
+	}
+
+	// The moderation state comes from the moderator, and the delivery
+	// status from the deliveries, not from the caller
+	message.SetModerationState("")
+	message.SetDeliveryStatus("")
+
+	decision, err := st.messageModerate(message)
+	if err != nil {
+		return err
+	}
+
+	message.SetModerationState(moderationDecisionState(decision))
+
+	if err := st.messageValidate(message); err != nil {
+		return err
+	}
+
+	message.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	message.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+
+	// A message scheduled in the future waits for the scheduler to publish
+	// it, and takes its place in the chat at the scheduled time
+	if message.ScheduledAt() != "" && message.ScheduledAtCarbon().StdTime().After(time.Now()) {
+		message.SetStatus(MESSAGE_STATUS_SCHEDULED)
+		message.SetCreatedAt(message.ScheduledAt())
+	}
+
+	if err := st.messageStatusMachine.ValidateStatus(message.Status()); err != nil {
+		return err
+	}
+
+	if st.tenantID != "" {
+		message.SetTenantID(st.tenantID)
+	}
+
+	row := messageInsertRow(message)
+	if err := st.messageEncryptRow(row); err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		st.logger.Debug("Message create", "id", message.ID())
+	}
+
+	// A published message is sent to its recipient right away
+	sent := message.RecipientID() != "" && message.Status() != MESSAGE_STATUS_SCHEDULED
+
+	// The message, its mentions, moderation and delivery, and the activity
+	// of its chat are written together
+	err = st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		// In a tenant view the chat of the message is one of the tenant
+		if err := st.tenantChatCheck(tx, message.ChatID()); err != nil {
+			return err
+		}
+
+		if err := txQuery(tx).Table(st.tableMessage).Create(row); err != nil {
+			return err
+		}
+
+		if err := st.mentionsReplace(tx, message); err != nil {
+			return err
+		}
+
+		if moderationLogged(decision) {
+			if err := st.moderationLog(tx, message.ID(), decision.Action, "", decision.Reason); err != nil {
+				return err
+			}
+		}
+
+		if sent {
+			if err := st.deliveryStatusSet(tx, message.ID(), message.RecipientID(), DELIVERY_STATUS_SENT, ""); err != nil {
+				return err
+			}
+
+			if err := st.messageDeliveryStatusUpdate(tx, message.ID()); err != nil {
+				return err
+			}
+		}
+
+		return st.chatStatsUpdate(tx, []string{message.ChatID()})
+	})
+	if err != nil {
+		return err
+	}
+
+	if sent {
+		message.SetDeliveryStatus(DELIVERY_STATUS_SENT)
+	}
+
+	message.MarkAsNotDirty()
+	return nil
+}
+
+// MessageCreateIdempotent creates the message unless a message with the same
+// client message ID already exists in the chat, in which case the existing
+// message is returned with created set to false. This makes the resends of a
+// client safe, also when they race each other. A message without a client
+// message ID is always created.
+func (st *storeImplementation) MessageCreateIdempotent(message MessageInterface) (MessageInterface, bool, error) {
+	if message == nil {
+		return nil, false, errors.New("message is nil")
+	}
+
+	if err := st.messageChatAuthorize(message.ChatID(), message.SenderID(), ACCESS_ACTION_SEND); err != nil {
+		return nil, false, err
+	}
+
+	if message.ClientMessageID() == "" {
+		if err := st.MessageCreate(message); err != nil {
+			return nil, false, err
+		}
+		return message, true, nil
+	}
+
+	existing, err := st.messageFindByClientMessageID(message.ChatID(), message.ClientMessageID())
+	if err != nil || existing != nil {
+		return existing, false, err
+	}
+
+	createErr := st.MessageCreate(message)
+	if createErr == nil {
+		return message, true, nil
+	}
+
+	// Most likely resent concurrently, violating the unique client message ID
+	existing, err = st.messageFindByClientMessageID(message.ChatID(), message.ClientMessageID())
+	if err != nil {
+		return nil, false, err
+	}
+
+	if existing == nil {
+		return nil, false, createErr
+	}
+
+	return existing, false, nil
+}
+
+// messageFindByClientMessageID finds the message of the chat with the client
+// message ID, soft deleted or not.
+func (st *storeImplementation) messageFindByClientMessageID(chatID string, clientMessageID string) (MessageInterface, error) {
+	list, err := st.MessageList(MessageQuery().
+		SetChatID(chatID).
+		SetClientMessageID(clientMessageID).
+		SetWithSoftDeleted(true).
+		SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// MessageDelete permanently deletes a message.
+func (st *storeImplementation) MessageDelete(message MessageInterface) error {
+	if message == nil {
+		return errors.New("message is nil")
+	}
+	return st.MessageDeleteByID(message.ID())
+}
+
+// MessageDeleteByID permanently deletes a message by ID.
+func (st *storeImplementation) MessageDeleteByID(id string) error {
+	if id == "" {
+		return errors.New("message ID is required")
+	}
+
+	if err := st.messageAuthorize(id, ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	type chatIDRow struct {
+		ChatID string `db:"chat_id"`
+	}
+
+	return st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		var rows []chatIDRow
+		err := st.tenantScope(txQuery(tx).Table(st.tableMessage)).
+			Select(COLUMN_CHAT_ID).
+			Where(COLUMN_ID+" = ?", id).
+			Get(&rows)
+		if err != nil {
+			return err
+		}
+
+		// The related rows of a message of another tenant are left alone
+		if len(rows) == 0 && st.tenantID != "" {
+			return nil
+		}
+
+		_, err = st.tenantScope(txQuery(tx).Table(st.tableMessage)).
+			Where(COLUMN_ID+" = ?", id).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		_, err = txQuery(tx).Table(st.tableDelivery).
+			Where(COLUMN_MESSAGE_ID+" = ?", id).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		_, err = txQuery(tx).Table(st.tableStar).
+			Where(COLUMN_MESSAGE_ID+" = ?", id).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		_, err = txQuery(tx).Table(st.tableMention).
+			Where(COLUMN_MESSAGE_ID+" = ?", id).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			return nil
+		}
+
+		return st.chatStatsUpdate(tx, []string{rows[0].ChatID})
+	})
+}
+
+// MessageFindByID finds a message by ID.
+func (st *storeImplementation) MessageFindByID(messageID string) (MessageInterface, error) {
+	if messageID == "" {
+		return nil, errors.New("message ID is required")
+	}
+
+	if st.principal != nil {
+		if err := st.messageAuthorize(messageID, ACCESS_ACTION_READ); err != nil {
+			return nil, err
+		}
+		return st.accessUnchecked().MessageFindByID(messageID)
+	}
+
+	list, err := st.MessageList(MessageQuery().
+		SetID(messageID).
+		SetLimit(1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(list) > 0 {
+		return list[0], nil
+	}
+
+	return nil, nil
+}
+
+// MessageList lists messages based on the query.
+func (st *storeImplementation) MessageList(query MessageQueryInterface) ([]MessageInterface, error) {
+	if query == nil {
+		return nil, errors.New("query is nil")
+	}
+
+	if err := st.messageQueryEncryptionCheck(query); err != nil {
+		return []MessageInterface{}, err
+	}
+
+	q := st.buildMessageQuery(query)
+
+	// Selected explicitly, as the columns neat derives from the model
+	// leave out the embedded timestamps
+	var rows []messageRow
+	if err := q.Table(st.tableMessage).Select("*").Get(&rows); err != nil {
+		return []MessageInterface{}, err
+	}
+
+	list := make([]MessageInterface, 0, len(rows))
+	for _, r := range rows {
+		message, err := st.messageFromRow(r)
+		if err != nil {
+			return []MessageInterface{}, err
+		}
+		list = append(list, message)
+	}
+
+	return list, nil
+}
+
+// MessageMetaDelete removes the meta key from the message directly in the database,
+// so that concurrent meta changes to other keys are not lost.
+func (st *storeImplementation) MessageMetaDelete(messageID string, key string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if key == "" {
+		return errors.New("meta key is required")
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	// The encrypted metas can only be changed by rewriting them
+	if st.encryptor != nil {
+		return st.MessageUpdateWithRetry(messageID, func(message MessageInterface) error {
+			metas, err := message.Metas()
+			if err != nil {
+				return err
+			}
+
+			delete(metas, key)
+			return message.SetMetas(metas)
+		})
+	}
+
+	metas, err := st.metaDeleteExpr(key)
+	if err != nil {
+		return err
+	}
+
+	affected, err := st.metasUpdate(st.tableMessage, messageID, metas)
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MessageMetaSet sets the meta key of the message directly in the database,
+// so that concurrent meta changes to other keys are not lost.
+func (st *storeImplementation) MessageMetaSet(messageID string, key string, value string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if key == "" {
+		return errors.New("meta key is required")
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	// The encrypted metas can only be changed by rewriting them
+	if st.encryptor != nil {
+		return st.MessageUpdateWithRetry(messageID, func(message MessageInterface) error {
+			return message.SetMeta(key, value)
+		})
+	}
+
+	metas, err := st.metaSetExpr(key, value)
+	if err != nil {
+		return err
+	}
+
+	affected, err := st.metasUpdate(st.tableMessage, messageID, metas)
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// MessageQuery executes the query and returns the requested page of messages
+// together with the total number of matching messages, ignoring limit and offset.
+// When count only is set on the query, only the total is calculated.
+func (st *storeImplementation) MessageQuery(options MessageQueryInterface) (MessageQueryResult, error) {
+	if options == nil {
+		return MessageQueryResult{}, errors.New("query is nil")
+	}
+
+	if err := options.Validate(); err != nil {
+		return MessageQueryResult{}, err
+	}
+
+	total, err := st.MessageCount(options)
+	if err != nil {
+		return MessageQueryResult{}, err
+	}
+
+	result := MessageQueryResult{
+		Items: []MessageInterface{},
+		Total: total,
+	}
+
+	if options.GetCountOnly() || total == 0 {
+		return result, nil
+	}
+
+	items, err := st.MessageList(options)
+	if err != nil {
+		return MessageQueryResult{}, err
+	}
+
+	result.Items = items
+	return result, nil
+}
+
+// MessageSoftDelete soft deletes a message. It returns ErrNotFound when
+// the message does not exist.
+func (st *storeImplementation) MessageSoftDelete(message MessageInterface) error {
+	if message == nil {
+		return errors.New("message is nil")
+	}
+
+	if err := st.messageAuthorize(message.ID(), ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	// The message is only marked as deleted once the row is
+	softDeletedAt := carbon.Now(carbon.UTC)
+
+	row := map[string]any{
+		COLUMN_SOFT_DELETED_AT: softDeletedAt.StdTime(),
+		COLUMN_UPDATED_AT:      softDeletedAt.StdTime(),
+		COLUMN_VERSION:         neatquery.RawExpr(COLUMN_VERSION + " + 1"),
+	}
+
+	err := st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		// The stats are recomputed for the stored chat of the message,
+		// whatever chat the caller holds
+		stored, found, err := st.messageStored(tx, message.ID())
+		if err != nil {
+			return err
+		}
+
+		if !found {
+			return ErrNotFound
+		}
+
+		result, err := st.tenantScope(txQuery(tx).Table(st.tableMessage)).Where(COLUMN_ID+" = ?", message.ID()).Update(row)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+
+		return st.chatStatsUpdate(tx, []string{stored.ChatID})
+	})
+	if err != nil {
+		return err
+	}
+
+	message.SetSoftDeletedAt(softDeletedAt.ToDateTimeString())
+	message.SetVersion(message.Version() + 1)
+	return nil
+}
+
+// MessageSoftDeleteByID soft deletes a message by ID.
+func (st *storeImplementation) MessageSoftDeleteByID(id string) error {
+	message, err := st.MessageFindByID(id)
+	if err != nil {
+		return err
+	}
+	if message == nil {
+		return ErrNotFound
+	}
+	return st.MessageSoftDelete(message)
+}
+
+// MessageUpdate updates the changed fields of a message. It returns ErrNotFound
+// when the message does not exist and ErrStaleEntity when it was modified since loaded.
+// A changed status must be allowed by the message status machine, or
+// ErrInvalidStatus or ErrInvalidStatusTransition is returned. A changed
+// text is screened by the moderator, when set.
+func (st *storeImplementation) MessageUpdate(message MessageInterface) error {
+	if message == nil {
+		return errors.New("message is nil")
+	}
+
+	if message.ID() == "" {
+		return errors.New("message ID is required")
+	}
+
+	if err := st.messageAuthorize(message.ID(), ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	// A message moved to another chat or sender is sent again
+	if slices.Contains(message.DirtyFields(), COLUMN_CHAT_ID) || slices.Contains(message.DirtyFields(), COLUMN_SENDER_ID) {
+		if err := st.messageChatAuthorize(message.ChatID(), message.SenderID(), ACCESS_ACTION_SEND); err != nil {
+			return err
+		}
+	}
+
+	// A changed text is screened again by the moderator
+	decision := ModerationDecision{Action: MODERATION_ACTION_ALLOW}
+	if slices.Contains(message.DirtyFields(), COLUMN_TEXT) {
+		var err error
+		if decision, err = st.messageModerate(message); err != nil {
+			return err
+		}
+	}
+
+	if err := st.messageValidate(message); err != nil {
+		return err
+	}
+
+	// Only the changed columns are written, nothing at all if none changed
+	row := dirtyRow(message.DirtyFields(), map[string]any{
+		COLUMN_CHAT_ID:           message.ChatID(),
+		COLUMN_STATUS:            message.Status(),
+		COLUMN_SENDER_ID:         message.SenderID(),
+		COLUMN_RECIPIENT_ID:      message.RecipientID(),
+		COLUMN_TEXT:              message.Text(),
+		COLUMN_MEMO:              message.Memo(),
+		COLUMN_CLIENT_MESSAGE_ID: nullIfEmpty(message.ClientMessageID()),
+		COLUMN_SCHEDULED_AT:      nullIfEmptyTime(message.ScheduledAt()),
+		COLUMN_EXPIRES_AT:        nullIfEmptyTime(message.ExpiresAt()),
+		COLUMN_METAS:             message.(*messageImplementation).MetasField,
+		COLUMN_SOFT_DELETED_AT:   message.SoftDeletedAtCarbon().StdTime(),
+	})
+
+	if len(row) == 0 {
+		return nil
+	}
+
+	// The moderation state is decided in the transaction, from the stored one
+	if moderationLogged(decision) {
+		row[COLUMN_MODERATION_STATE] = nil
+	}
+
+	if err := st.messageEncryptRow(row); err != nil {
+		return err
+	}
+
+	message.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	row[COLUMN_UPDATED_AT] = message.UpdatedAtCarbon().StdTime()
+	row[COLUMN_VERSION] = message.Version() + 1
+
+	// The message, its moderation and the mentions of a changed text are
+	// written together
+	err := st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		if _, ok := row[COLUMN_STATUS]; ok {
+			err := st.statusTransitionCheck(txQuery(tx), st.tableMessage, st.messageStatusMachine, message.ID(), message.Version(), message.Status())
+			if err != nil {
+				return err
+			}
+		}
+
+		// In a tenant view the message may only move to a chat of the tenant
+		if _, ok := row[COLUMN_CHAT_ID]; ok {
+			if err := st.tenantChatCheck(tx, message.ChatID()); err != nil {
+				return err
+			}
+		}
+
+		// A message moved, deleted or hidden changes the activity of the
+		// chat it was in, and of the chat it is moved to
+		statsChanged := false
+		for _, column := range []string{COLUMN_CHAT_ID, COLUMN_SOFT_DELETED_AT, COLUMN_STATUS, COLUMN_MODERATION_STATE} {
+			if _, ok := row[column]; ok {
+				statsChanged = true
+			}
+		}
+
+		stored := messageStoredRow{}
+		if statsChanged {
+			var err error
+			if stored, _, err = st.messageStored(tx, message.ID()); err != nil {
+				return err
+			}
+		}
+
+		// A reviewer decision stays until a reviewer changes it
+		if _, ok := row[COLUMN_MODERATION_STATE]; ok {
+			message.SetModerationState(moderationStateAfter(stored.ModerationState, decision))
+			row[COLUMN_MODERATION_STATE] = nullIfEmpty(message.ModerationState())
+		}
+
+		// The version precondition rejects the update when the message
+		// was modified by someone else since it was loaded
+		result, err := st.tenantScope(txQuery(tx).Table(st.tableMessage)).
+			Where(COLUMN_ID+" = ?", message.ID()).
+			Where(COLUMN_VERSION+" = ?", message.Version()).
+			Update(row)
+		if err != nil {
+			return err
+		}
+
+		if result.RowsAffected == 0 {
+			var count int64
+			err := st.tenantScope(txQuery(tx).Table(st.tableMessage)).Where(COLUMN_ID+" = ?", message.ID()).Count(&count)
+			if err != nil {
+				return err
+			}
+
+			if count > 0 {
+				return ErrStaleEntity
+			}
+
+			return ErrNotFound
+		}
+
+		if moderationLogged(decision) {
+			if err := st.moderationLog(tx, message.ID(), decision.Action, "", decision.Reason); err != nil {
+				return err
+			}
+		}
+
+		if _, ok := row[COLUMN_TEXT]; ok {
+			if err := st.mentionsReplace(tx, message); err != nil {
+				return err
+			}
+		}
+
+		if statsChanged {
+			return st.chatStatsUpdate(tx, messageStatsChatIDs(stored.ChatID, message.ChatID()))
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	message.SetVersion(message.Version() + 1)
+	message.MarkAsNotDirty()
+	return nil
+}
+
+// MessageUpdateWithRetry loads the message, applies the mutation and updates it.
+// When the update fails with ErrStaleEntity, the message is reloaded and the
+// mutation is applied again, up to a limited number of attempts.
+func (st *storeImplementation) MessageUpdateWithRetry(id string, mutate func(message MessageInterface) error) error {
+	if mutate == nil {
+		return errors.New("mutate function is nil")
+	}
+
+	for attempt := 0; attempt < updateRetryAttempts; attempt++ {
+		message, err := st.MessageFindByID(id)
+		if err != nil {
+			return err
+		}
+
+		if message == nil {
+			return ErrNotFound
+		}
+
+		if err := mutate(message); err != nil {
+			return err
+		}
+
+		err = st.MessageUpdate(message)
+		if !errors.Is(err, ErrStaleEntity) {
+			return err
+		}
+	}
+
+	return ErrStaleEntity
+}
+
+// MessageUpsert inserts the message, or updates all of its fields when a
+// message with the same ID already exists, in a single dialect native statement.
+// An updated message keeps its creation time and its version is incremented.
+// Its status must be allowed by the message status machine, as must the
+// transition to it from the stored status of an updated message, and the
+// moderator, when set, screens the message first.
+func (st *storeImplementation) MessageUpsert(message MessageInterface) error {
+	if message == nil {
+		return errors.New("message is nil")
+	}
+
+	if message.ID() == "" {
+		return errors.New("message ID is required")
+	}
+
+	if err := st.messageAuthorize(message.ID(), ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	if err := st.messageChatAuthorize(message.ChatID(), message.SenderID(), ACCESS_ACTION_SEND); err != nil {
+		return err
+	}
+
+	decision, err := st.messageModerate(message)
+	if err != nil {
+		return err
+	}
+
+	if err := st.messageValidate(message); err != nil {
+		return err
+	}
+
+	if err := st.messageStatusMachine.ValidateStatus(message.Status()); err != nil {
+		return err
+	}
+
+	message.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+
+	columns := []string{
+		COLUMN_CHAT_ID,
+		COLUMN_STATUS,
+		COLUMN_SENDER_ID,
+		COLUMN_RECIPIENT_ID,
+		COLUMN_TEXT,
+		COLUMN_MEMO,
+		COLUMN_CLIENT_MESSAGE_ID,
+		COLUMN_SCHEDULED_AT,
+		COLUMN_EXPIRES_AT,
+		COLUMN_METAS,
+		COLUMN_UPDATED_AT,
+		COLUMN_SOFT_DELETED_AT,
+		COLUMN_MODERATION_STATE,
+	}
+
+	if err := st.tenantIDConflict(st.tableMessage, message.ID()); err != nil {
+		return err
+	}
+
+	if st.tenantID != "" {
+		message.SetTenantID(st.tenantID)
+	}
+
+	row := messageInsertRow(message)
+	if err := st.messageEncryptRow(row); err != nil {
+		return err
+	}
+
+	if st.debugEnabled {
+		st.logger.Debug("Message upsert", "id", message.ID())
+	}
+
+	// The message, its mentions and moderation, and the activity of its chat
+	// are written together
+	err = st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		if err := st.tenantChatCheck(tx, message.ChatID()); err != nil {
+			return err
+		}
+
+		// An existing message may move out of another chat
+		stored, exists, err := st.messageStored(tx, message.ID())
+		if err != nil {
+			return err
+		}
+
+		if exists {
+			if err := st.messageStatusMachine.ValidateTransition(stored.Status, message.Status()); err != nil {
+				return err
+			}
+		}
+
+		// The moderation state comes from the moderator and the stored
+		// reviewer decision, and the delivery status of a new message from
+		// its deliveries, not from the caller
+		message.SetModerationState(moderationStateAfter(stored.ModerationState, decision))
+		row[COLUMN_MODERATION_STATE] = nullIfEmpty(message.ModerationState())
+
+		if !exists {
+			message.SetDeliveryStatus("")
+			row[COLUMN_DELIVERY_STATUS] = nil
+		}
+
+		if err := st.upsert(tx, st.tableMessage, row, columns); err != nil {
+			return err
+		}
+
+		if err := st.mentionsReplace(tx, message); err != nil {
+			return err
+		}
+
+		if moderationLogged(decision) {
+			if err := st.moderationLog(tx, message.ID(), decision.Action, "", decision.Reason); err != nil {
+				return err
+			}
+		}
+
+		return st.chatStatsUpdate(tx, messageStatsChatIDs(stored.ChatID, message.ChatID()))
+	})
+	if err != nil {
+		return err
+	}
 
-// MessageCount counts the number of messages that match the query.
-func (st *storeImplementation) MessageCount(options MessageQueryInterface) (int64, error) {
-	if options == nil {
-		return 0, errors.New("query is nil")
+	// The stored version and creation time depend on whether the message existed
+	stored, err := st.MessageList(MessageQuery().SetID(message.ID()).SetWithSoftDeleted(true).SetLimit(1))
+	if err != nil {
+		return err
 	}
 
-	q := st.buildMessageQuery(options)
+	if len(stored) > 0 {
+		message.SetVersion(stored[0].Version())
+		message.SetCreatedAt(stored[0].CreatedAt())
+	}
 
-	var count int64
-	err := q.Table(st.tableMessage).Count(&count)
-	return count, err
+	message.MarkAsNotDirty()
+	return nil
 }
 
-// MessageCreate creates a new message.
-func (st *storeImplementation) MessageCreate(message MessageInterface) error {
-	if message == nil {
-		return errors.New("message is nil")
+// metasUpdate writes the metas expression to the record, bumping its version,
+// and returns the number of affected rows.
+func (st *storeImplementation) metasUpdate(tableName string, id string, metas neatquery.RawExpression) (int64, error) {
+	row := map[string]any{
+		COLUMN_METAS:      metas,
+		COLUMN_UPDATED_AT: carbon.Now(carbon.UTC).StdTime(),
+		COLUMN_VERSION:    neatquery.RawExpr(COLUMN_VERSION + " + 1"),
 	}
 
-	if message.ID() == "" {
-		return errors.New("message ID is required")
+	result, err := st.tenantScope(st.db.Query().Table(tableName)).Where(COLUMN_ID+" = ?", id).Update(row)
+	if err != nil {
+		return 0, err
 	}
 
-	message.SetCreatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
-	message.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	return result.RowsAffected, nil
+}
 
-	row := map[string]any{
-		COLUMN_ID:              message.ID(),
-		COLUMN_CHAT_ID:         message.ChatID(),
-		COLUMN_STATUS:          message.Status(),
-		COLUMN_SENDER_ID:       message.SenderID(),
-		COLUMN_RECIPIENT_ID:    message.RecipientID(),
-		COLUMN_TEXT:            message.Text(),
-		COLUMN_MEMO:            message.Memo(),
-		COLUMN_METAS:           message.(*messageImplementation).MetasField,
-		COLUMN_CREATED_AT:      message.CreatedAtCarbon().StdTime(),
-		COLUMN_UPDATED_AT:      message.UpdatedAtCarbon().StdTime(),
-		COLUMN_SOFT_DELETED_AT: message.SoftDeletedAtCarbon().StdTime(),
+// nullIfEmpty returns nil (stored as NULL) for an empty value, for optional
+// columns with a unique constraint.
+func nullIfEmpty(value string) any {
+	if value == "" {
+		return nil
 	}
+	return value
+}
 
-	if st.debugEnabled {
-		st.logger.Debug("Message create", "id", message.ID())
+// nullIfEmptyTime returns the datetime string as a time to store,
+// or nil (NULL) when empty.
+func nullIfEmptyTime(value string) any {
+	if value == "" {
+		return nil
 	}
-
-	return st.db.Query().Table(st.tableMessage).Create(row)
+	return carbon.Parse(value, carbon.UTC).StdTime()
 }
 
-// MessageDelete permanently deletes a message.
-func (st *storeImplementation) MessageDelete(message MessageInterface) error {
-	if message == nil {
-		return errors.New("message is nil")
+// dirtyRow returns the update row holding only the values of the dirty columns.
+func dirtyRow(dirtyColumns []string, values map[string]any) map[string]any {
+	row := map[string]any{}
+	for _, column := range dirtyColumns {
+		if value, ok := values[column]; ok {
+			row[column] = value
+		}
 	}
-	return st.MessageDeleteByID(message.ID())
+	return row
 }
 
-// MessageDeleteByID permanently deletes a message by ID.
-func (st *storeImplementation) MessageDeleteByID(id string) error {
-	if id == "" {
-		return errors.New("message ID is required")
+// == CHAT ACTIVITY ===========================================================
+
+// RecomputeChatStats recomputes the last message time and message count of the
+// chats from their (not soft deleted) messages, repairing chats whose messages
+// were changed outside of the store. All chats are recomputed when no IDs are given.
+func (st *storeImplementation) RecomputeChatStats(chatIDs ...string) error {
+	if err := st.storeAuthorize(ACCESS_ACTION_ADMINISTER); err != nil {
+		return err
 	}
 
-	_, err := st.db.Query().
-		Table(st.tableMessage).
-		Where(COLUMN_ID+" = ?", id).
-		Delete()
-	return err
+	return st.chatStatsUpdate(st.db.Query(), chatIDs)
 }
 
-// MessageFindByID finds a message by ID.
-func (st *storeImplementation) MessageFindByID(messageID string) (MessageInterface, error) {
-	if messageID == "" {
-		return nil, errors.New("message ID is required")
+// txQuery returns a query with an empty builder state within the transaction
+// of tx, as neat queries keep accumulating their clauses when reused.
+func txQuery(tx contractsorm.Query) contractsorm.Query {
+	if cloner, ok := tx.(interface{ Clone() contractsorm.Query }); ok {
+		return cloner.Clone()
 	}
+	return tx
+}
 
-	list, err := st.MessageList(MessageQuery().
-		SetID(messageID).
-		SetLimit(1))
-	if err != nil {
-		return nil, err
+// chatStatsUpdate recomputes the activity columns of the chats within the
+// given query (e.g. a transaction), all chats when no IDs are given.
+// The chat version is left as is, as the columns are not set by the user.
+func (st *storeImplementation) chatStatsUpdate(q contractsorm.Query, chatIDs []string) error {
+	visible, visibleArgs := st.messageVisibleSQL(st.tableMessage)
+	messages := " FROM " + st.tableMessage +
+		" WHERE " + st.tableMessage + "." + COLUMN_CHAT_ID + " = " + st.tableChat + "." + COLUMN_ID +
+		" AND " + st.tableMessage + "." + COLUMN_SOFT_DELETED_AT + " > ?" + visible
+	// The soft delete time is written by the driver, which is given the
+	// current time the same way, in UTC
+	args := append([]any{time.Now().UTC()}, visibleArgs...)
+
+	row := map[string]any{
+		COLUMN_MESSAGE_COUNT:   neatquery.RawExpr("(SELECT COUNT(*)"+messages+")", args...),
+		COLUMN_LAST_MESSAGE_AT: neatquery.RawExpr("(SELECT MAX("+st.tableMessage+"."+COLUMN_CREATED_AT+")"+messages+")", args...),
 	}
 
-	if len(list) > 0 {
-		return list[0], nil
+	q = st.tenantScope(txQuery(q).Table(st.tableChat))
+	if len(chatIDs) > 0 {
+		q = q.Where(COLUMN_ID+" IN ?", chatIDs)
 	}
 
-	return nil, nil
+	_, err := q.Update(row)
+	return err
 }
 
-// MessageList lists messages based on the query.
-func (st *storeImplementation) MessageList(query MessageQueryInterface) ([]MessageInterface, error) {
-	if query == nil {
-		return nil, errors.New("query is nil")
-	}
+// chatStoredRow holds the stored fields of a chat the store decides on when
+// writing it.
+type chatStoredRow struct {
+	Status    string `db:"status"`
+	DirectKey string `db:"direct_key"`
+}
 
-	type messageRow struct {
-		ID            string    `db:"id"`
-		ChatID        string    `db:"chat_id"`
-		Status        string    `db:"status"`
-		SenderID      string    `db:"sender_id"`
-		RecipientID   string    `db:"recipient_id"`
-		Text          string    `db:"text"`
-		Memo          string    `db:"memo"`
-		Metas         string    `db:"metas"`
-		CreatedAt     time.Time `db:"created_at"`
-		UpdatedAt     time.Time `db:"updated_at"`
-		SoftDeletedAt time.Time `db:"soft_deleted_at"`
+// chatStored returns the stored fields of the chat, soft deleted or not, and
+// false when the chat does not exist.
+func (st *storeImplementation) chatStored(q contractsorm.Query, chatID string) (chatStoredRow, bool, error) {
+	var rows []chatStoredRow
+	err := txQuery(q).Table(st.tableChat).
+		Select(COLUMN_STATUS, "COALESCE("+COLUMN_DIRECT_KEY+", '') AS "+COLUMN_DIRECT_KEY).
+		Where(COLUMN_ID+" = ?", chatID).
+		Get(&rows)
+	if err != nil {
+		return chatStoredRow{}, false, err
 	}
 
-	q := st.buildMessageQuery(query)
-
-	var rows []messageRow
-	if err := q.Table(st.tableMessage).Get(&rows); err != nil {
-		return []MessageInterface{}, err
+	if len(rows) == 0 {
+		return chatStoredRow{}, false, nil
 	}
 
-	list := make([]MessageInterface, 0, len(rows))
-	for _, r := range rows {
-		msg := &messageImplementation{}
-		msg.SetID(r.ID)
-		msg.ChatIDField = r.ChatID
-		msg.StatusField = r.Status
-		msg.SenderIDField = r.SenderID
-		msg.RecipientIDField = r.RecipientID
-		msg.TextField = r.Text
-		msg.MemoField = r.Memo
-		msg.MetasField = r.Metas
-		msg.CreatedAtField.CreatedAt = r.CreatedAt
-		msg.UpdatedAtField.UpdatedAt = r.UpdatedAt
-		msg.SoftDeletesMaxDate.SoftDeletedAt = r.SoftDeletedAt
-		list = append(list, msg)
-	}
+	return rows[0], true, nil
+}
 
-	return list, nil
+// messageStoredRow holds the stored fields of a message the store decides on
+// when writing it.
+type messageStoredRow struct {
+	ChatID          string `db:"chat_id"`
+	Status          string `db:"status"`
+	ModerationState string `db:"moderation_state"`
 }
 
-// MessageSoftDelete soft deletes a message.
-func (st *storeImplementation) MessageSoftDelete(message MessageInterface) error {
-	if message == nil {
-		return errors.New("message is nil")
+// messageStored returns the stored fields of the message, and false when the
+// message does not exist.
+func (st *storeImplementation) messageStored(q contractsorm.Query, messageID string) (messageStoredRow, bool, error) {
+	var rows []messageStoredRow
+	err := st.tenantScope(txQuery(q).Table(st.tableMessage)).
+		Select(COLUMN_CHAT_ID, COLUMN_STATUS, "COALESCE("+COLUMN_MODERATION_STATE+", '') AS "+COLUMN_MODERATION_STATE).
+		Where(COLUMN_ID+" = ?", messageID).
+		Get(&rows)
+	if err != nil {
+		return messageStoredRow{}, false, err
 	}
 
-	message.SetSoftDeletedAt(carbon.Now(carbon.UTC).ToDateTimeString())
-
-	row := map[string]any{
-		COLUMN_SOFT_DELETED_AT: message.SoftDeletedAtCarbon().StdTime(),
-		COLUMN_UPDATED_AT:      carbon.Now(carbon.UTC).StdTime(),
+	if len(rows) == 0 {
+		return messageStoredRow{}, false, nil
 	}
 
-	_, err := st.db.Query().Table(st.tableMessage).Where(COLUMN_ID+" = ?", message.ID()).Update(row)
-	return err
+	return rows[0], true, nil
 }
 
-// MessageSoftDeleteByID soft deletes a message by ID.
-func (st *storeImplementation) MessageSoftDeleteByID(id string) error {
-	message, err := st.MessageFindByID(id)
-	if err != nil {
-		return err
-	}
-	if message == nil {
-		return errors.New("message not found")
+// messageStatsChatIDs returns the chats whose stats change with a message,
+// the chat it was in and the chat it is in, when they differ.
+func messageStatsChatIDs(previousChatID string, chatID string) []string {
+	if previousChatID == "" || previousChatID == chatID {
+		return []string{chatID}
 	}
-	return st.MessageSoftDelete(message)
+	return []string{previousChatID, chatID}
 }
 
-// MessageUpdate updates a message.
-func (st *storeImplementation) MessageUpdate(message MessageInterface) error {
-	if message == nil {
-		return errors.New("message is nil")
+// == QUERY BUILDERS ==========================================================
+
+// buildChatQuery builds a neat query from the chat query interface,
+// including pagination and ordering.
+func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contractsorm.Query {
+	q := st.buildChatQueryFilters(query)
+
+	if query == nil {
+		return q
 	}
 
-	if message.ID() == "" {
-		return errors.New("message ID is required")
+	if query.IsLimitSet() && query.GetLimit() > 0 {
+		q = q.Limit(query.GetLimit())
 	}
 
-	message.SetUpdatedAt(carbon.Now(carbon.UTC).ToDateTimeString())
+	if query.IsOffsetSet() && query.GetOffset() > 0 {
+		q = q.Offset(query.GetOffset())
+	}
 
-	row := map[string]any{
-		COLUMN_CHAT_ID:         message.ChatID(),
-		COLUMN_STATUS:          message.Status(),
-		COLUMN_SENDER_ID:       message.SenderID(),
-		COLUMN_RECIPIENT_ID:    message.RecipientID(),
-		COLUMN_TEXT:            message.Text(),
-		COLUMN_MEMO:            message.Memo(),
-		COLUMN_METAS:           message.(*messageImplementation).MetasField,
-		COLUMN_UPDATED_AT:      message.UpdatedAtCarbon().StdTime(),
-		COLUMN_SOFT_DELETED_AT: message.SoftDeletedAtCarbon().StdTime(),
-	}
-
-	_, err := st.db.Query().Table(st.tableMessage).Where(COLUMN_ID+" = ?", message.ID()).Update(row)
-	return err
-}
+	if query.IsOrderBySet() && query.GetOrderBy() != "" {
+		direction := lo.CoalesceOrEmpty(query.GetOrderDirection(), "DESC")
+		q = q.OrderBy(query.GetOrderBy(), direction)
+	}
 
-// == QUERY BUILDERS ==========================================================
+	return q
+}
 
-// buildChatQuery builds a neat query from the chat query interface.
-func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contractsorm.Query {
+// buildChatQueryFilters builds a neat query holding only the filters of the
+// chat query interface, without pagination and ordering (e.g. for counting).
+func (st *storeImplementation) buildChatQueryFilters(query ChatQueryInterface) contractsorm.Query {
 	// Use Model() to enable neat's automatic soft delete handling via SoftDeletesMaxDate
-	q := st.db.Query().Model(&chatImplementation{})
+	q := st.tenantScope(st.db.Query().Model(&chatImplementation{}))
+	q = st.accessScope(q, st.tableChat+"."+COLUMN_ID)
 
 	if query == nil {
 		return q
@@ -581,6 +2571,24 @@ func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contract
 		q = q.Where(COLUMN_OWNER_ID+" = ?", query.GetOwnerID())
 	}
 
+	if query.IsOwnerIDInSet() && len(query.GetOwnerIDIn()) > 0 {
+		q = q.Where(COLUMN_OWNER_ID+" IN ?", query.GetOwnerIDIn())
+	}
+
+	if query.IsDirectKeySet() && query.GetDirectKey() != "" {
+		q = q.Where(COLUMN_DIRECT_KEY+" = ?", query.GetDirectKey())
+	}
+
+	if query.IsSettingsUserIDSet() && query.GetSettingsUserID() != "" {
+		if query.IsArchivedSet() {
+			q = q.Where(st.chatUserSettingsSQL(COLUMN_ARCHIVED, query.GetArchived()), query.GetSettingsUserID(), true)
+		}
+
+		if query.IsHiddenSet() {
+			q = q.Where(st.chatUserSettingsSQL(COLUMN_HIDDEN, query.GetHidden()), query.GetSettingsUserID(), true)
+		}
+	}
+
 	if query.IsStatusSet() && query.GetStatus() != "" {
 		q = q.Where(COLUMN_STATUS+" = ?", query.GetStatus())
 	}
@@ -589,6 +2597,10 @@ func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contract
 		q = q.Where(COLUMN_STATUS+" IN ?", query.GetStatusIn())
 	}
 
+	if query.IsStatusNotInSet() && len(query.GetStatusNotIn()) > 0 {
+		q = q.Where(COLUMN_STATUS+" NOT IN ?", query.GetStatusNotIn())
+	}
+
 	if query.IsIDSet() && query.GetID() != "" {
 		q = q.Where(COLUMN_ID+" = ?", query.GetID())
 	}
@@ -597,6 +2609,20 @@ func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contract
 		q = q.Where(COLUMN_ID+" IN ?", query.GetIDIn())
 	}
 
+	if query.IsIDNotInSet() && len(query.GetIDNotIn()) > 0 {
+		q = q.Where(COLUMN_ID+" NOT IN ?", query.GetIDNotIn())
+	}
+
+	if query.IsTitleLikeSet() && query.GetTitleLike() != "" {
+		q = q.Where(COLUMN_TITLE+" LIKE ?", query.GetTitleLike())
+	}
+
+	// Case insensitive search of the term anywhere in the title or memo
+	if query.IsSearchSet() && query.GetSearch() != "" {
+		term := "%" + likeEscape(strings.ToLower(query.GetSearch())) + "%"
+		q = q.Where("(LOWER("+COLUMN_TITLE+") LIKE ? ESCAPE '!' OR LOWER("+COLUMN_MEMO+") LIKE ? ESCAPE '!')", term, term)
+	}
+
 	if query.IsCreatedAtGteSet() && query.GetCreatedAtGte() != "" {
 		q = q.Where(COLUMN_CREATED_AT+" >= ?", query.GetCreatedAtGte())
 	}
@@ -613,18 +2639,15 @@ func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contract
 		q = q.Where(COLUMN_UPDATED_AT+" <= ?", query.GetUpdatedAtLte())
 	}
 
-	if query.IsLimitSet() && query.GetLimit() > 0 {
-		q = q.Limit(query.GetLimit())
+	if query.IsSoftDeletedAtGteSet() && query.GetSoftDeletedAtGte() != "" {
+		q = q.Where(COLUMN_SOFT_DELETED_AT+" >= ?", query.GetSoftDeletedAtGte())
 	}
 
-	if query.IsOffsetSet() && query.GetOffset() > 0 {
-		q = q.Offset(query.GetOffset())
+	if query.IsSoftDeletedAtLteSet() && query.GetSoftDeletedAtLte() != "" {
+		q = q.Where(COLUMN_SOFT_DELETED_AT+" <= ?", query.GetSoftDeletedAtLte())
 	}
 
-	if query.IsOrderBySet() && query.GetOrderBy() != "" {
-		direction := lo.CoalesceOrEmpty(query.GetOrderDirection(), "DESC")
-		q = q.OrderBy(query.GetOrderBy() + " " + direction)
-	}
+	q = st.applyMetaFilters(q, st.chatIndexedMetaKeys, query.GetMetaEquals(), query.GetMetaExists(), query.GetMetaIn())
 
 	// Handle soft delete filtering via neat's automatic handling (SoftDeletesMaxDate)
 	if query.IsWithSoftDeletedSet() && query.GetWithSoftDeleted() {
@@ -636,15 +2659,57 @@ func (st *storeImplementation) buildChatQuery(query ChatQueryInterface) contract
 	return q
 }
 
-// buildMessageQuery builds a neat query from the message query interface.
+// chatUserSettingsSQL returns the condition matching the chats with the flag
+// column of the user's settings set, or the chats without it when not set.
+// The condition takes the user ID and true as arguments.
+func (st *storeImplementation) chatUserSettingsSQL(column string, set bool) string {
+	settings := "SELECT 1 FROM " + st.tableChatUserSettings + " settings" +
+		" WHERE settings." + COLUMN_CHAT_ID + " = " + st.tableChat + "." + COLUMN_ID +
+		" AND settings." + COLUMN_USER_ID + " = ?" +
+		" AND settings." + column + " = ?"
+
+	if set {
+		return "EXISTS (" + settings + ")"
+	}
+	return "NOT EXISTS (" + settings + ")"
+}
+
+// buildMessageQuery builds a neat query from the message query interface,
+// including pagination and ordering.
 func (st *storeImplementation) buildMessageQuery(query MessageQueryInterface) contractsorm.Query {
-	// Use Model() to enable neat's automatic soft delete handling via SoftDeletesMaxDate
-	q := st.db.Query().Model(&messageImplementation{})
+	q := st.buildMessageQueryFilters(query)
 
 	if query == nil {
 		return q
 	}
 
+	if query.IsLimitSet() && query.GetLimit() > 0 {
+		q = q.Limit(query.GetLimit())
+	}
+
+	if query.IsOffsetSet() && query.GetOffset() > 0 {
+		q = q.Offset(query.GetOffset())
+	}
+
+	if query.IsOrderBySet() && query.GetOrderBy() != "" {
+		direction := lo.CoalesceOrEmpty(query.GetOrderDirection(), "DESC")
+		q = q.OrderBy(query.GetOrderBy(), direction)
+	}
+
+	return q
+}
+
+// buildMessageQueryFilters builds a neat query holding only the filters of the
+// message query interface, without pagination and ordering (e.g. for counting).
+func (st *storeImplementation) buildMessageQueryFilters(query MessageQueryInterface) contractsorm.Query {
+	// Use Model() to enable neat's automatic soft delete handling via SoftDeletesMaxDate
+	q := st.tenantScope(st.db.Query().Model(&messageImplementation{}))
+	q = st.accessScope(q, st.tableMessage+"."+COLUMN_CHAT_ID)
+
+	if query == nil {
+		return st.messageVisibilityFilters(q, false, false, false)
+	}
+
 	if query.IsChatIDSet() && query.GetChatID() != "" {
 		q = q.Where(COLUMN_CHAT_ID+" = ?", query.GetChatID())
 	}
@@ -653,6 +2718,10 @@ func (st *storeImplementation) buildMessageQuery(query MessageQueryInterface) co
 		q = q.Where(COLUMN_CHAT_ID+" IN ?", query.GetChatIDIn())
 	}
 
+	if query.IsClientMessageIDSet() && query.GetClientMessageID() != "" {
+		q = q.Where(COLUMN_CLIENT_MESSAGE_ID+" = ?", query.GetClientMessageID())
+	}
+
 	if query.IsStatusSet() && query.GetStatus() != "" {
 		q = q.Where(COLUMN_STATUS+" = ?", query.GetStatus())
 	}
@@ -661,6 +2730,44 @@ func (st *storeImplementation) buildMessageQuery(query MessageQueryInterface) co
 		q = q.Where(COLUMN_STATUS+" IN ?", query.GetStatusIn())
 	}
 
+	if query.IsDeliveryStatusSet() && query.GetDeliveryStatus() != "" {
+		q = q.Where(COLUMN_DELIVERY_STATUS+" = ?", query.GetDeliveryStatus())
+	}
+
+	if query.IsModerationStateSet() && query.GetModerationState() != "" {
+		q = q.Where(COLUMN_MODERATION_STATE+" = ?", query.GetModerationState())
+	}
+
+	if query.IsPinnedSet() {
+		if query.GetPinned() {
+			q = q.WhereNotNull(COLUMN_PINNED_AT)
+		} else {
+			q = q.WhereNull(COLUMN_PINNED_AT)
+		}
+	}
+
+	if query.IsMentionedUserIDSet() && query.GetMentionedUserID() != "" {
+		mentioned := "SELECT 1 FROM " + st.tableMention + " mentioned" +
+			" WHERE mentioned." + COLUMN_MESSAGE_ID + " = " + st.tableMessage + "." + COLUMN_ID +
+			" AND mentioned." + COLUMN_USER_ID + " = ?"
+		q = q.Where("EXISTS ("+mentioned+")", query.GetMentionedUserID())
+	}
+
+	if query.IsStarredByUserIDSet() && query.GetStarredByUserID() != "" {
+		starred := "SELECT 1 FROM " + st.tableStar + " starred" +
+			" WHERE starred." + COLUMN_MESSAGE_ID + " = " + st.tableMessage + "." + COLUMN_ID +
+			" AND starred." + COLUMN_USER_ID + " = ?"
+		q = q.Where("EXISTS ("+starred+")", query.GetStarredByUserID())
+	}
+
+	if query.IsUndeliveredForUserIDSet() && query.GetUndeliveredForUserID() != "" {
+		undelivered := "SELECT 1 FROM " + st.tableDelivery + " undelivered" +
+			" WHERE undelivered." + COLUMN_MESSAGE_ID + " = " + st.tableMessage + "." + COLUMN_ID +
+			" AND undelivered." + COLUMN_RECIPIENT_ID + " = ?" +
+			" AND undelivered." + COLUMN_STATUS + " IN (?, ?)"
+		q = q.Where("EXISTS ("+undelivered+")", query.GetUndeliveredForUserID(), DELIVERY_STATUS_SENT, DELIVERY_STATUS_FAILED)
+	}
+
 	if query.IsIDSet() && query.GetID() != "" {
 		q = q.Where(COLUMN_ID+" = ?", query.GetID())
 	}
@@ -677,10 +2784,28 @@ func (st *storeImplementation) buildMessageQuery(query MessageQueryInterface) co
 		q = q.Where(COLUMN_SENDER_ID+" = ?", query.GetSenderID())
 	}
 
+	if query.IsSenderIDInSet() && len(query.GetSenderIDIn()) > 0 {
+		q = q.Where(COLUMN_SENDER_ID+" IN ?", query.GetSenderIDIn())
+	}
+
+	if query.IsSenderIDNotInSet() && len(query.GetSenderIDNotIn()) > 0 {
+		q = q.Where(COLUMN_SENDER_ID+" NOT IN ?", query.GetSenderIDNotIn())
+	}
+
 	if query.IsRecipientIDSet() && query.GetRecipientID() != "" {
 		q = q.Where(COLUMN_RECIPIENT_ID+" = ?", query.GetRecipientID())
 	}
 
+	if query.IsRecipientIDInSet() && len(query.GetRecipientIDIn()) > 0 {
+		q = q.Where(COLUMN_RECIPIENT_ID+" IN ?", query.GetRecipientIDIn())
+	}
+
+	if query.IsConversationBetweenSet() && len(query.GetConversationBetween()) == 2 {
+		users := query.GetConversationBetween()
+		q = q.Where("(("+COLUMN_SENDER_ID+" = ? AND "+COLUMN_RECIPIENT_ID+" = ?) OR ("+COLUMN_SENDER_ID+" = ? AND "+COLUMN_RECIPIENT_ID+" = ?))",
+			users[0], users[1], users[1], users[0])
+	}
+
 	if query.IsCreatedAtGteSet() && query.GetCreatedAtGte() != "" {
 		q = q.Where(COLUMN_CREATED_AT+" >= ?", query.GetCreatedAtGte())
 	}
@@ -689,18 +2814,15 @@ func (st *storeImplementation) buildMessageQuery(query MessageQueryInterface) co
 		q = q.Where(COLUMN_CREATED_AT+" <= ?", query.GetCreatedAtLte())
 	}
 
-	if query.IsLimitSet() && query.GetLimit() > 0 {
-		q = q.Limit(query.GetLimit())
+	if query.IsUpdatedAtGteSet() && query.GetUpdatedAtGte() != "" {
+		q = q.Where(COLUMN_UPDATED_AT+" >= ?", query.GetUpdatedAtGte())
 	}
 
-	if query.IsOffsetSet() && query.GetOffset() > 0 {
-		q = q.Offset(query.GetOffset())
+	if query.IsUpdatedAtLteSet() && query.GetUpdatedAtLte() != "" {
+		q = q.Where(COLUMN_UPDATED_AT+" <= ?", query.GetUpdatedAtLte())
 	}
 
-	if query.IsOrderBySet() && query.GetOrderBy() != "" {
-		direction := lo.CoalesceOrEmpty(query.GetOrderDirection(), "DESC")
-		q = q.OrderBy(query.GetOrderBy() + " " + direction)
-	}
+	q = st.applyMetaFilters(q, st.messageIndexedMetaKeys, query.GetMetaEquals(), query.GetMetaExists(), query.GetMetaIn())
 
 	// Handle soft delete filtering via neat's automatic handling (SoftDeletesMaxDate)
 	if query.IsWithSoftDeletedSet() && query.GetWithSoftDeleted() {
@@ -709,5 +2831,149 @@ func (st *storeImplementation) buildMessageQuery(query MessageQueryInterface) co
 		q = q.OnlySoftDeleted()
 	}
 
+	// Filtering by the scheduled status asks for the scheduled messages
+	withScheduled := query.GetWithScheduled() ||
+		query.GetStatus() == MESSAGE_STATUS_SCHEDULED ||
+		slices.Contains(query.GetStatusIn(), MESSAGE_STATUS_SCHEDULED)
+
+	// Filtering by the rejected moderation state asks for the rejected messages
+	withRejected := query.GetWithRejected() ||
+		query.GetModerationState() == MODERATION_STATE_REJECTED
+
+	return st.messageVisibilityFilters(q, withScheduled, query.GetWithExpired(), withRejected)
+}
+
+// messageVisibilityFilters excludes the messages waiting to be published,
+// the expired messages and the messages rejected by moderation, unless requested.
+func (st *storeImplementation) messageVisibilityFilters(q contractsorm.Query, withScheduled bool, withExpired bool, withRejected bool) contractsorm.Query {
+	if !withScheduled {
+		q = q.Where(COLUMN_STATUS+" <> ?", MESSAGE_STATUS_SCHEDULED)
+	}
+
+	if !withRejected {
+		q = q.Where("("+COLUMN_MODERATION_STATE+" IS NULL OR "+COLUMN_MODERATION_STATE+" <> ?)", MODERATION_STATE_REJECTED)
+	}
+
+	if !withExpired {
+		q = q.Where("("+COLUMN_EXPIRES_AT+" IS NULL OR "+COLUMN_EXPIRES_AT+" > ?)", st.sqlValue(time.Now().UTC()))
+	}
+
+	return q
+}
+
+// messageVisibleSQL returns the raw condition (and its arguments) matching
+// the published, unexpired and unrejected messages of the aliased message table, for use
+// in subqueries. The condition starts with AND.
+func (st *storeImplementation) messageVisibleSQL(alias string) (string, []any) {
+	prefix := ""
+	if alias != "" {
+		prefix = alias + "."
+	}
+
+	sql := " AND " + prefix + COLUMN_STATUS + " <> ?" +
+		" AND (" + prefix + COLUMN_EXPIRES_AT + " IS NULL OR " + prefix + COLUMN_EXPIRES_AT + " > ?)" +
+		" AND (" + prefix + COLUMN_MODERATION_STATE + " IS NULL OR " + prefix + COLUMN_MODERATION_STATE + " <> ?)"
+
+	return sql, []any{MESSAGE_STATUS_SCHEDULED, st.sqlValue(time.Now().UTC()), MODERATION_STATE_REJECTED}
+}
+
+// chatLastMessages returns the latest (not soft deleted) message of each of
+// the chats, keyed by chat ID. Chats without messages are left out. Of the
+// messages created within the same second, the one with the greatest ID is
+// taken, as the creation times have no finer precision.
+func (st *storeImplementation) chatLastMessages(chatIDs []string) (map[string]MessageInterface, error) {
+	visible, visibleArgs := st.messageVisibleSQL("latest")
+	latest := "SELECT MAX(latest." + COLUMN_CREATED_AT + ") FROM " + st.tableMessage + " latest" +
+		" WHERE latest." + COLUMN_CHAT_ID + " = " + st.tableMessage + "." + COLUMN_CHAT_ID +
+		" AND latest." + COLUMN_SOFT_DELETED_AT + " > ?" + visible
+
+	var rows []messageRow
+	err := st.buildMessageQueryFilters(NewMessageQuery().SetChatIDIn(chatIDs)).
+		Table(st.tableMessage).
+		Select("*").
+		Where(COLUMN_CREATED_AT+" = ("+latest+")", append([]any{time.Now().UTC()}, visibleArgs...)...).
+		OrderBy(COLUMN_ID, "desc").
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	// The message with the greatest ID, ordered first, wins a tie
+	lastMessages := make(map[string]MessageInterface, len(rows))
+	for _, r := range rows {
+		if _, ok := lastMessages[r.ChatID]; ok {
+			continue
+		}
+
+		message, err := st.messageFromRow(r)
+		if err != nil {
+			return nil, err
+		}
+		lastMessages[r.ChatID] = message
+	}
+
+	return lastMessages, nil
+}
+
+// chatUnreadCounts returns the number of messages matching the query in each
+// chat sent by others and not marked read by the user (see MessageMarkRead),
+// keyed by chat ID.
+func (st *storeImplementation) chatUnreadCounts(query MessageQueryInterface, userID string) (map[string]int64, error) {
+	type unreadRow struct {
+		ChatID      string `db:"chat_id"`
+		UnreadCount int64  `db:"unread_count"`
+	}
+
+	var rows []unreadRow
+	err := st.buildMessageQueryFilters(query.SetSenderIDNotIn([]string{userID})).
+		Table(st.tableMessage).
+		Select(COLUMN_CHAT_ID+", COUNT(*) AS unread_count").
+		Where("NOT EXISTS ("+st.messageReadSQL()+")", userID, DELIVERY_STATUS_READ).
+		Group(COLUMN_CHAT_ID).
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	unreadCounts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		unreadCounts[r.ChatID] = r.UnreadCount
+	}
+
+	return unreadCounts, nil
+}
+
+// messageReadSQL returns the raw subquery selecting the read receipt of the
+// message of the message table by the recipient, for use in NOT EXISTS. It
+// takes the recipient ID and the read status as arguments.
+func (st *storeImplementation) messageReadSQL() string {
+	return "SELECT 1 FROM " + st.tableDelivery + " receipt" +
+		" WHERE receipt." + COLUMN_MESSAGE_ID + " = " + st.tableMessage + "." + COLUMN_ID +
+		" AND receipt." + COLUMN_RECIPIENT_ID + " = ?" +
+		" AND receipt." + COLUMN_STATUS + " = ?"
+}
+
+// applyMetaFilters adds the meta key filters of a query to the neat query.
+func (st *storeImplementation) applyMetaFilters(q contractsorm.Query, indexedKeys []string, metaEquals map[string]string, metaExists []string, metaIn map[string][]string) contractsorm.Query {
+	for _, key := range slices.Sorted(maps.Keys(metaEquals)) {
+		expr, args := st.metaValueSQL(indexedKeys, key)
+		q = q.Where(expr+" = ?", append(args, metaEquals[key])...)
+	}
+
+	for _, key := range metaExists {
+		// Written as a comparison, as neat rewrites a clause with a single
+		// argument and no comparison operator to "clause = ?"
+		expr, args := st.metaValueSQL(indexedKeys, key)
+		q = q.Where("CASE WHEN "+expr+" IS NULL THEN 0 ELSE 1 END = 1", args...)
+	}
+
+	for _, key := range slices.Sorted(maps.Keys(metaIn)) {
+		expr, args := st.metaValueSQL(indexedKeys, key)
+		for _, value := range metaIn[key] {
+			args = append(args, value)
+		}
+		q = q.Where(expr+" IN ("+sqlPlaceholders(len(metaIn[key]))+")", args...)
+	}
+
 	return q
 }
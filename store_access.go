@@ -0,0 +1,275 @@
+package chatstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+)
+
+// == ACCESS ==================================================================
+
+// AsUser returns a view of the store acting for the principal. Every
+// operation of the view is checked against the policy of the store: the
+// lists, counts and stats only cover the chats the principal may read, and
+// the operations which are not allowed return ErrForbidden. A user view
+// cannot act for another principal.
+func (st *storeImplementation) AsUser(principal Principal) (StoreInterface, error) {
+	if principal.UserID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	if st.principal != nil && *st.principal != principal {
+		return nil, errors.New("chat store: the store acts for another user")
+	}
+
+	view := *st
+	view.principal = &principal
+	return &view, nil
+}
+
+// Principal returns the principal the store acts for, and false when the
+// store is not a user view.
+func (st *storeImplementation) Principal() (Principal, bool) {
+	if st.principal == nil {
+		return Principal{}, false
+	}
+	return *st.principal, true
+}
+
+// accessUnchecked returns the store without the principal, for the
+// operations already authorized.
+func (st *storeImplementation) accessUnchecked() *storeImplementation {
+	view := *st
+	view.principal = nil
+	return &view
+}
+
+// accessScope narrows the query to the rows whose column, a chat ID,
+// is one of the chats the principal may read.
+func (st *storeImplementation) accessScope(q contractsorm.Query, column string) contractsorm.Query {
+	if st.principal == nil {
+		return q
+	}
+
+	if st.principal.Admin && st.policy.Allowed(*st.principal, ACCESS_ACTION_READ, []string{ACCESS_ROLE_ADMIN}) {
+		return q
+	}
+
+	conditions := []string{}
+	args := []any{}
+
+	if st.policy.Allowed(*st.principal, ACCESS_ACTION_READ, []string{ACCESS_ROLE_OWNER}) {
+		conditions = append(conditions, st.tableChat+"."+COLUMN_OWNER_ID+" = ?")
+		args = append(args, st.principal.UserID)
+	}
+
+	if st.policy.Allowed(*st.principal, ACCESS_ACTION_READ, []string{ACCESS_ROLE_PARTICIPANT}) {
+		userID := st.principal.UserID
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM "+st.tableMessage+" participant"+
+				" WHERE participant."+COLUMN_CHAT_ID+" = "+st.tableChat+"."+COLUMN_ID+
+				" AND (participant."+COLUMN_SENDER_ID+" = ? OR participant."+COLUMN_RECIPIENT_ID+" = ?))",
+			st.tableChat+"."+COLUMN_DIRECT_KEY+" LIKE ? ESCAPE '!'",
+			st.tableChat+"."+COLUMN_DIRECT_KEY+" LIKE ? ESCAPE '!'",
+			st.tableChat+"."+COLUMN_DIRECT_KEY+" LIKE ? ESCAPE '!'")
+		args = append(args, userID, userID,
+			likeEscape(userID)+":%",
+			"%/"+likeEscape(userID)+":%",
+			"%:"+likeEscape(userID))
+	}
+
+	if len(conditions) == 0 {
+		return q.Where("1 = 0")
+	}
+
+	return q.Where(column+" IN (SELECT "+st.tableChat+"."+COLUMN_ID+" FROM "+st.tableChat+
+		" WHERE "+strings.Join(conditions, " OR ")+")", args...)
+}
+
+// accessRoles returns the roles of the principal in the chat with the
+// owner and direct key.
+func (st *storeImplementation) accessRoles(chatID string, ownerID string, directKey string) ([]string, error) {
+	roles := []string{}
+
+	if st.principal.Admin {
+		roles = append(roles, ACCESS_ROLE_ADMIN)
+	}
+
+	if ownerID == st.principal.UserID {
+		roles = append(roles, ACCESS_ROLE_OWNER)
+	}
+
+	if directKeyHasUser(directKey, st.principal.UserID) {
+		return append(roles, ACCESS_ROLE_PARTICIPANT), nil
+	}
+
+	if chatID == "" {
+		return roles, nil
+	}
+
+	var count int64
+	err := st.db.Query().Table(st.tableMessage).
+		Where(COLUMN_CHAT_ID+" = ?", chatID).
+		Where("("+COLUMN_SENDER_ID+" = ? OR "+COLUMN_RECIPIENT_ID+" = ?)", st.principal.UserID, st.principal.UserID).
+		Count(&count)
+	if err != nil {
+		return nil, err
+	}
+
+	if count > 0 {
+		roles = append(roles, ACCESS_ROLE_PARTICIPANT)
+	}
+
+	return roles, nil
+}
+
+// accessAllowed returns ErrForbidden when the policy does not allow the
+// principal with the roles to perform the action.
+func (st *storeImplementation) accessAllowed(action string, roles []string) error {
+	if !st.policy.Allowed(*st.principal, action, roles) {
+		return fmt.Errorf("%w: %s", ErrForbidden, action)
+	}
+	return nil
+}
+
+// chatAuthorize returns ErrForbidden when the principal may not perform
+// the action on the chat. A chat which does not exist is left to the
+// operation to report.
+func (st *storeImplementation) chatAuthorize(chatID string, action string) error {
+	if st.principal == nil {
+		return nil
+	}
+
+	roles, found, err := st.chatRoles(chatID)
+	if err != nil || !found {
+		return err
+	}
+
+	return st.accessAllowed(action, roles)
+}
+
+// chatRoles returns the roles of the principal in the chat, soft deleted
+// or not, and false when the chat does not exist.
+func (st *storeImplementation) chatRoles(chatID string) ([]string, bool, error) {
+	type accessRow struct {
+		OwnerID   string `db:"owner_id"`
+		DirectKey string `db:"direct_key"`
+	}
+
+	var rows []accessRow
+	err := st.tenantScope(st.db.Query().Table(st.tableChat)).
+		Select(COLUMN_OWNER_ID+", "+COLUMN_DIRECT_KEY).
+		Where(COLUMN_ID+" = ?", chatID).
+		Limit(1).
+		Get(&rows)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(rows) == 0 {
+		roles, err := st.accessRoles(chatID, "", "")
+		return roles, false, err
+	}
+
+	roles, err := st.accessRoles(chatID, rows[0].OwnerID, rows[0].DirectKey)
+	return roles, true, err
+}
+
+// chatNewAuthorize returns ErrForbidden when the principal may not perform
+// the action on the chat about to be created.
+func (st *storeImplementation) chatNewAuthorize(chat ChatInterface, action string) error {
+	if st.principal == nil {
+		return nil
+	}
+
+	roles, err := st.accessRoles("", chat.OwnerID(), chat.DirectKey())
+	if err != nil {
+		return err
+	}
+
+	return st.accessAllowed(action, roles)
+}
+
+// messageAuthorize returns ErrForbidden when the principal may not perform
+// the action on the message. A message which does not exist is left to
+// the operation to report.
+func (st *storeImplementation) messageAuthorize(messageID string, action string) error {
+	if st.principal == nil {
+		return nil
+	}
+
+	type accessRow struct {
+		ChatID   string `db:"chat_id"`
+		SenderID string `db:"sender_id"`
+	}
+
+	var rows []accessRow
+	err := st.tenantScope(st.db.Query().Table(st.tableMessage)).
+		Select(COLUMN_CHAT_ID+", "+COLUMN_SENDER_ID).
+		Where(COLUMN_ID+" = ?", messageID).
+		Limit(1).
+		Get(&rows)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return nil
+	}
+
+	return st.messageChatAuthorize(rows[0].ChatID, rows[0].SenderID, action)
+}
+
+// messageChatAuthorize returns ErrForbidden when the principal may not
+// perform the action on a message of the sender in the chat.
+func (st *storeImplementation) messageChatAuthorize(chatID string, senderID string, action string) error {
+	if st.principal == nil {
+		return nil
+	}
+
+	roles, _, err := st.chatRoles(chatID)
+	if err != nil {
+		return err
+	}
+
+	if senderID == st.principal.UserID {
+		roles = append(roles, ACCESS_ROLE_SENDER)
+	}
+
+	return st.accessAllowed(action, roles)
+}
+
+// storeAuthorize returns ErrForbidden when the principal may not perform
+// the store wide action, e.g. moderating or purging messages.
+func (st *storeImplementation) storeAuthorize(action string) error {
+	if st.principal == nil {
+		return nil
+	}
+
+	roles := []string{}
+	if st.principal.Admin {
+		roles = append(roles, ACCESS_ROLE_ADMIN)
+	}
+
+	return st.accessAllowed(action, roles)
+}
+
+// userAuthorize returns ErrForbidden when the principal acts for another
+// user, e.g. starring a message for them, without being allowed to
+// administer the store.
+func (st *storeImplementation) userAuthorize(userID string) error {
+	if st.principal == nil || userID == st.principal.UserID {
+		return nil
+	}
+	return st.storeAuthorize(ACCESS_ACTION_ADMINISTER)
+}
+
+// directKeyHasUser returns whether the user is one of the users of the
+// direct chat with the direct key, which may be prefixed with a tenant.
+func directKeyHasUser(directKey string, userID string) bool {
+	users, ok := directKeyUsers(directKey)
+	return ok && slices.Contains(users, userID)
+}
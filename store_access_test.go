@@ -0,0 +1,302 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_AsUser(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := store.AsUser(chatstore.Principal{}); err == nil {
+		t.Fatal("Expected an error for an empty user ID")
+	}
+
+	if _, ok := store.Principal(); ok {
+		t.Fatal("Expected the root store not to act for a user")
+	}
+
+	owner, err := store.AsUser(chatstore.Principal{UserID: testUser_O1})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	principal, ok := owner.Principal()
+	if !ok || principal.UserID != testUser_O1 {
+		t.Fatal("Expected the view to act for the owner, got", principal.UserID)
+	}
+
+	if _, err := owner.AsUser(chatstore.Principal{UserID: testUser_O2}); err == nil {
+		t.Fatal("Expected an error acting for another user")
+	}
+}
+
+func TestStore_AccessPolicy(t *testing.T) {
+	const testUser_O3 = "00000000000000000000000000000003"
+
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	owner, err := store.AsUser(chatstore.Principal{UserID: testUser_O1})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	participant, err := store.AsUser(chatstore.Principal{UserID: testUser_O2})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	stranger, err := store.AsUser(chatstore.Principal{UserID: testUser_O3})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	admin, err := store.AsUser(chatstore.Principal{UserID: "admin", Admin: true})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A chat may only be created for its owner
+	if err := stranger.ChatCreate(chatstore.NewChat().SetOwnerID(testUser_O1)); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle("Team")
+	if err := owner.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Messages may not be sent as someone else
+	forged := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O2).SetText("Forged")
+	if err := owner.MessageCreate(forged); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetRecipientID(testUser_O2).SetText("Hello")
+	if err := owner.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// The recipient is now a participant, who may read and reply
+	found, err := participant.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("Expected the participant to find the chat")
+	}
+
+	reply := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O2).SetText("Hi")
+	if err := participant.MessageCreate(reply); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A participant may not edit the messages of others, nor manage the chat
+	message.SetText("Edited")
+	if err := participant.MessageUpdate(message); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	found.SetTitle("Renamed")
+	if err := participant.ChatUpdate(found); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	if err := participant.ChatDeleteByID(chat.ID()); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	// The sender may edit their own message
+	reply.SetText("Hi there")
+	if err := participant.MessageUpdate(reply); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A stranger may not read the chat
+	if _, err := stranger.ChatFindByID(chat.ID()); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	if _, err := stranger.MessageFindByID(message.ID()); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	if err := stranger.MessageStar(message.ID(), testUser_O3); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	if err := participant.MessageStar(message.ID(), testUser_O1); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden starring for another user, got", err)
+	}
+
+	// The lists only cover the chats the user may read
+	chats, err := stranger.ChatList(chatstore.ChatQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(chats) != 0 {
+		t.Fatal("Expected no chats for the stranger, got", len(chats))
+	}
+
+	messages, err := stranger.MessageList(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(messages) != 0 {
+		t.Fatal("Expected no messages for the stranger, got", len(messages))
+	}
+
+	messages, err = participant.MessageList(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatal("Expected 2 messages for the participant, got", len(messages))
+	}
+
+	if _, err := stranger.StatsMedianResponseTime(chatstore.MessageQuery()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Store wide operations are for admins
+	if _, err := owner.MessagePurgeExpired(time.Now()); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	count, err := admin.MessageCount(chatstore.MessageQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatal("Expected 2 messages for the admin, got", count)
+	}
+
+	if err := owner.ChatDeleteByID(chat.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
+
+func TestStore_AccessDirectChat(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	owner, err := store.AsUser(chatstore.Principal{UserID: testUser_O1})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	other, err := store.AsUser(chatstore.Principal{UserID: testUser_O2})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat, _, err := owner.ChatFindOrCreateDirect(testUser_O1, testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// The other user of an empty direct chat may read it and write to it
+	chats, err := other.ChatList(chatstore.ChatQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(chats) != 1 || chats[0].ID() != chat.ID() {
+		t.Fatal("Expected the direct chat to be listed for the other user")
+	}
+
+	message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O2).SetText("Hello")
+	if err := other.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, _, err := other.ChatFindOrCreateDirect(testUser_O1, "00000000000000000000000000000003"); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	// A user may not plant a chat as the direct chat of others
+	mallory, err := store.AsUser(chatstore.Principal{UserID: "00000000000000000000000000000003"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	planted := chatstore.NewChat().SetOwnerID("00000000000000000000000000000003").
+		SetDirectKey(chatstore.DirectChatKey("alice", "bob"))
+	if err := mallory.ChatCreate(planted); !errors.Is(err, chatstore.ErrDirectKey) {
+		t.Fatal("Expected ErrDirectKey, got", err)
+	}
+
+	if err := mallory.ChatUpsert(planted); !errors.Is(err, chatstore.ErrDirectKey) {
+		t.Fatal("Expected ErrDirectKey, got", err)
+	}
+}
+
+func TestStore_AccessCustomPolicy(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Only the owners may read their chats
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+		Policy: chatstore.PolicyFunc(func(principal chatstore.Principal, action string, roles []string) bool {
+			for _, role := range roles {
+				if role == chatstore.ACCESS_ROLE_OWNER {
+					return true
+				}
+			}
+			return false
+		}),
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetRecipientID(testUser_O2).SetText("Hello")
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	participant, err := store.AsUser(chatstore.Principal{UserID: testUser_O2})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := participant.ChatFindByID(chat.ID()); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	count, err := participant.ChatCount(chatstore.ChatQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 0 {
+		t.Fatal("Expected no chats for the participant, got", count)
+	}
+}
@@ -1,7 +1,10 @@
 package chatstore_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/dracory/chatstore"
 	// _ "modernc.org/sqlite"
@@ -386,6 +389,83 @@ func TestStore_ChatList(t *testing.T) {
 	}
 }
 
+func TestChatQuery_Clone(t *testing.T) {
+	query := chatstore.ChatQuery().
+		SetMetaEquals("topic", "billing").
+		SetMetaExists("priority").
+		SetMetaIn("region", []string{"eu"})
+
+	// Changing the copy leaves the query unchanged
+	clone := query.Clone().
+		SetMetaEquals("topic", "sales").
+		SetMetaExists("owner").
+		SetMetaIn("region", []string{"us"})
+
+	if query.GetMetaEquals()["topic"] != "billing" || len(query.GetMetaExists()) != 1 || query.GetMetaIn()["region"][0] != "eu" {
+		t.Fatal("Expected the query to be unchanged, got", query.GetMetaEquals(), query.GetMetaExists(), query.GetMetaIn())
+	}
+
+	if clone.GetMetaEquals()["topic"] != "sales" || len(clone.GetMetaExists()) != 2 || clone.GetMetaIn()["region"][0] != "us" {
+		t.Fatal("Expected the copy to be changed, got", clone.GetMetaEquals(), clone.GetMetaExists(), clone.GetMetaIn())
+	}
+}
+
+func TestStore_ChatQuery(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = store.ChatCreate(chatstore.NewChat().
+			SetOwnerID(testUser_O1).
+			SetStatus(chatstore.CHAT_STATUS_ACTIVE))
+		if err != nil {
+			t.Fatal("unexpected error creating chat:", err)
+		}
+	}
+
+	// Test page data and total in one call
+	result, err := store.ChatQuery(chatstore.ChatQuery().
+		SetOwnerID(testUser_O1).
+		SetOffset(2).
+		SetLimit(2))
+	if err != nil {
+		t.Fatal("unexpected error querying chats:", err)
+	}
+
+	if len(result.Items) != 1 {
+		t.Fatalf("Expected 1 chat on the page, got %d", len(result.Items))
+	}
+
+	if result.Total != 3 {
+		t.Fatalf("Expected total of 3 chats, got %d", result.Total)
+	}
+
+	// Test count only
+	countResult, err := store.ChatQuery(chatstore.ChatQuery().
+		SetCountOnly(true).
+		SetLimit(1))
+	if err != nil {
+		t.Fatal("unexpected error counting chats:", err)
+	}
+
+	if len(countResult.Items) != 0 {
+		t.Fatalf("Expected no chats in count only mode, got %d", len(countResult.Items))
+	}
+
+	if countResult.Total != 3 {
+		t.Fatalf("Expected total of 3 chats, got %d", countResult.Total)
+	}
+
+	// Test invalid query
+	_, err = store.ChatQuery(chatstore.ChatQuery().SetLimit(-1))
+	if err == nil {
+		t.Fatal("expected error for negative limit, but got nil")
+	}
+}
+
 func TestStore_ChatSoftDelete(t *testing.T) {
 	store, err := initStore(":memory:")
 
@@ -442,6 +522,47 @@ func TestStore_ChatSoftDelete(t *testing.T) {
 	}
 }
 
+func TestStore_ChatSoftDeleteMissing(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A chat of another tenant is not found
+	other, err := store.ForTenant("other")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := other.ChatSoftDelete(chat); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+
+	missing := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatSoftDelete(missing); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+
+	// The chats are left as they were
+	if chat.Version() != 0 || chat.IsSoftDeleted() || missing.Version() != 0 || missing.IsSoftDeleted() {
+		t.Fatal("expected the chats to be left unchanged")
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("expected the chat not to be soft deleted")
+	}
+}
+
 func TestStore_ChatSoftDeleteByID(t *testing.T) {
 	store, err := initStore(":memory:")
 
@@ -537,3 +658,992 @@ func TestStore_ChatUpdate(t *testing.T) {
 		t.Fatalf("Memo not updated. Expected 'Resolved by ops team', got '%s'", updatedChat.Memo())
 	}
 }
+
+func TestStore_ChatUpdateStale(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	err = store.ChatCreate(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Two admins load the same chat
+	first, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	second, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatUpdate(first.SetTitle("First title"))
+	if err != nil {
+		t.Fatal("unexpected error on first update:", err)
+	}
+
+	if first.Version() != 1 {
+		t.Fatalf("Expected version 1 after update, got %d", first.Version())
+	}
+
+	err = store.ChatUpdate(second.SetTitle("Second title"))
+	if !errors.Is(err, chatstore.ErrStaleEntity) {
+		t.Fatalf("Expected ErrStaleEntity, got %v", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Title() != "First title" {
+		t.Fatalf("Expected title 'First title', got '%s'", found.Title())
+	}
+}
+
+func TestStore_ChatUpdateWithRetry(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	err = store.ChatCreate(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	attempts := 0
+	err = store.ChatUpdateWithRetry(chat.ID(), func(c chatstore.ChatInterface) error {
+		attempts++
+
+		// Simulate a concurrent update on the first attempt
+		if attempts == 1 {
+			if err := store.ChatUpdate(chat.SetMemo("Concurrent memo")); err != nil {
+				return err
+			}
+		}
+
+		return c.SetMeta("team", "backend")
+	})
+	if err != nil {
+		t.Fatal("unexpected error on update with retry:", err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", attempts)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Memo() != "Concurrent memo" {
+		t.Fatalf("Expected memo 'Concurrent memo', got '%s'", found.Memo())
+	}
+
+	team, err := found.Meta("team")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if team != "backend" {
+		t.Fatalf("Expected meta team 'backend', got '%s'", team)
+	}
+
+	err = store.ChatUpdateWithRetry("missing", func(c chatstore.ChatInterface) error {
+		return nil
+	})
+	if err == nil {
+		t.Fatal("expected error for missing chat, but got nil")
+	}
+}
+
+func TestStore_ChatUpdateOnlyDirtyFields(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	err = store.ChatCreate(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if chat.IsDirty() {
+		t.Fatalf("Expected chat not to be dirty after create, got %v", chat.DirtyFields())
+	}
+
+	// Updating without changes is a no-op
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	updatedAt := found.UpdatedAt()
+
+	err = store.ChatUpdate(found)
+	if err != nil {
+		t.Fatal("unexpected error on no-op update:", err)
+	}
+
+	if found.Version() != 0 || found.UpdatedAt() != updatedAt {
+		t.Fatalf("Expected no-op update to keep version and updated at, got %d and %s", found.Version(), found.UpdatedAt())
+	}
+
+	// Only the changed title is written, keeping the memo set elsewhere
+	err = store.ChatUpdate(found.SetTitle("New title"))
+	if err != nil {
+		t.Fatal("unexpected error on update:", err)
+	}
+
+	if found.IsDirty() {
+		t.Fatalf("Expected chat not to be dirty after update, got %v", found.DirtyFields())
+	}
+
+	if found.Version() != 1 {
+		t.Fatalf("Expected version 1 after update, got %d", found.Version())
+	}
+
+	updated, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if updated.Title() != "New title" {
+		t.Fatalf("Expected title 'New title', got '%s'", updated.Title())
+	}
+
+	if updated.OwnerID() != testUser_O1 {
+		t.Fatalf("Expected owner ID %s, got '%s'", testUser_O1, updated.OwnerID())
+	}
+}
+
+func TestStore_ChatMetaSet(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	err = chat.SetMetas(map[string]string{"severity": "high"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatCreate(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Two services set different keys without reading the chat first
+	err = store.ChatMetaSet(chat.ID(), "team", "backend")
+	if err != nil {
+		t.Fatal("unexpected error setting meta team:", err)
+	}
+
+	err = store.ChatMetaSet(chat.ID(), "service", "web")
+	if err != nil {
+		t.Fatal("unexpected error setting meta service:", err)
+	}
+
+	err = store.ChatMetaSet(chat.ID(), "severity", "low")
+	if err != nil {
+		t.Fatal("unexpected error overwriting meta severity:", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	metas, err := found.Metas()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(metas) != 3 || metas["severity"] != "low" || metas["team"] != "backend" || metas["service"] != "web" {
+		t.Fatalf("Unexpected metas: %v", metas)
+	}
+
+	if found.Version() != 3 {
+		t.Fatalf("Expected version 3, got %d", found.Version())
+	}
+
+	err = store.ChatMetaSet("missing", "team", "backend")
+	if err == nil {
+		t.Fatal("expected error for missing chat, but got nil")
+	}
+}
+
+func TestStore_ChatMetaDelete(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	err = chat.SetMetas(map[string]string{"severity": "high", "team": "backend"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatCreate(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatMetaDelete(chat.ID(), "severity")
+	if err != nil {
+		t.Fatal("unexpected error deleting meta:", err)
+	}
+
+	// Deleting a missing key is not an error
+	err = store.ChatMetaDelete(chat.ID(), "unknown")
+	if err != nil {
+		t.Fatal("unexpected error deleting missing meta:", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	metas, err := found.Metas()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(metas) != 1 || metas["team"] != "backend" {
+		t.Fatalf("Unexpected metas: %v", metas)
+	}
+}
+
+func TestStore_ChatListMetaFilters(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                  db,
+		TableChatName:       "chat_table",
+		TableMessageName:    "message_table",
+		AutomigrateEnabled:  true,
+		ChatIndexedMetaKeys: []string{"team"},
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Running the migration again must keep the indexed meta columns
+	err = store.MigrateUp(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error on repeated migration:", err)
+	}
+
+	metasList := []map[string]string{
+		{"team": "backend", "severity": "high"},
+		{"team": "frontend", "severity": "low"},
+		{"team": "ops"},
+		{},
+	}
+
+	for _, metas := range metasList {
+		chat := chatstore.NewChat().
+			SetOwnerID(testUser_O1).
+			SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+		if err := chat.SetMetas(metas); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if err := store.ChatCreate(chat); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	// The indexed "team" key reads the generated column, "severity" the metas JSON
+	testCases := []struct {
+		name     string
+		query    chatstore.ChatQueryInterface
+		expected int
+	}{
+		{"equals indexed", chatstore.ChatQuery().SetMetaEquals("team", "backend"), 1},
+		{"equals", chatstore.ChatQuery().SetMetaEquals("severity", "low"), 1},
+		{"equals multiple", chatstore.ChatQuery().SetMetaEquals("team", "backend").SetMetaEquals("severity", "low"), 0},
+		{"exists indexed", chatstore.ChatQuery().SetMetaExists("team"), 3},
+		{"exists", chatstore.ChatQuery().SetMetaExists("severity"), 2},
+		{"in indexed", chatstore.ChatQuery().SetMetaIn("team", []string{"backend", "ops"}), 2},
+		{"in", chatstore.ChatQuery().SetMetaIn("severity", []string{"high", "medium"}), 1},
+	}
+
+	for _, tc := range testCases {
+		list, err := store.ChatList(tc.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		if len(list) != tc.expected {
+			t.Fatalf("%s: expected %d chats, got %d", tc.name, tc.expected, len(list))
+		}
+	}
+}
+
+func TestStore_ChatListFilters(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chats := []chatstore.ChatInterface{
+		chatstore.NewChat().SetOwnerID(testUser_O1).SetStatus(chatstore.CHAT_STATUS_ACTIVE).SetTitle("Project Alpha").SetMemo("kickoff notes"),
+		chatstore.NewChat().SetOwnerID(testUser_O1).SetStatus(chatstore.CHAT_STATUS_INACTIVE).SetTitle("Project Beta").SetMemo("100% done"),
+		chatstore.NewChat().SetOwnerID(testUser_O2).SetStatus(chatstore.CHAT_STATUS_ACTIVE).SetTitle("Lunch").SetMemo("alpha team"),
+	}
+
+	for _, chat := range chats {
+		if err := store.ChatCreate(chat); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	testCases := []struct {
+		name     string
+		query    chatstore.ChatQueryInterface
+		expected int
+	}{
+		{"title like", chatstore.ChatQuery().SetTitleLike("Project%"), 2},
+		{"search title and memo", chatstore.ChatQuery().SetSearch("ALPHA"), 2},
+		{"search escapes wildcards", chatstore.ChatQuery().SetSearch("100%"), 1},
+		{"search no match", chatstore.ChatQuery().SetSearch("_"), 0},
+		{"owner id in", chatstore.ChatQuery().SetOwnerIDIn([]string{testUser_O1, testUser_O2}), 3},
+		{"id not in", chatstore.ChatQuery().SetIDNotIn([]string{chats[0].ID()}), 2},
+		{"status not in", chatstore.ChatQuery().SetStatusNotIn([]string{chatstore.CHAT_STATUS_INACTIVE}), 2},
+	}
+
+	for _, tc := range testCases {
+		list, err := store.ChatList(tc.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		if len(list) != tc.expected {
+			t.Fatalf("%s: expected %d chats, got %d", tc.name, tc.expected, len(list))
+		}
+	}
+
+	if err := store.ChatSoftDelete(chats[2]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	list, err := store.ChatList(chatstore.ChatQuery().
+		SetWithSoftDeleted(true).
+		SetSoftDeletedAtLte(time.Now().UTC().Add(time.Hour).Format(time.DateTime)))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].ID() != chats[2].ID() {
+		t.Fatalf("expected only the soft deleted chat, got %d chats", len(list))
+	}
+
+	err = chatstore.ChatQuery().SetSearch("").Validate()
+	if err == nil {
+		t.Fatal("expected error for empty search")
+	}
+}
+
+func TestStore_ChatListWithSummary(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat_table",
+		TableMessageName:   "message_table",
+		AutomigrateEnabled: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Create stamps the current time, so the creation times are backdated after
+	backdate := func(table string, id string, createdAt string) {
+		_, err := db.Exec("UPDATE "+table+" SET created_at = ? WHERE id = ?", createdAt, id)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	createChat := func(createdAt string) chatstore.ChatInterface {
+		chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+		if err := store.ChatCreate(chat); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		backdate("chat_table", chat.ID(), createdAt)
+		return chat
+	}
+
+	createMessage := func(chatID string, senderID string, text string, createdAt string) chatstore.MessageInterface {
+		message := chatstore.NewMessage().SetChatID(chatID).SetSenderID(senderID).SetText(text)
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		backdate("message_table", message.ID(), createdAt)
+		return message
+	}
+
+	chatBusy := createChat("2025-01-01 00:00:00")
+	chatQuiet := createChat("2025-01-02 00:00:00")
+	chatEmpty := createChat("2025-01-03 00:00:00")
+
+	hi := createMessage(chatBusy.ID(), testUser_O2, "Hi", "2025-02-01 00:00:00")
+	createMessage(chatBusy.ID(), testUser_O1, "Hello", "2025-02-02 00:00:00")
+	createMessage(chatBusy.ID(), testUser_O2, "How are you?", "2025-02-03 00:00:00")
+	createMessage(chatBusy.ID(), testUser_O2, "Still there?", "2025-02-04 00:00:00")
+	createMessage(chatQuiet.ID(), testUser_O2, "Ping", "2025-01-15 00:00:00")
+
+	// The messages read by the user are not unread
+	if err := store.MessageMarkRead(hi.ID(), testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Soft deleted messages are left out of the summary
+	deleted := createMessage(chatQuiet.ID(), testUser_O2, "Gone", "2025-03-01 00:00:00")
+	if err := store.MessageSoftDelete(deleted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	summaries, err := store.ChatListWithSummary(chatstore.ChatQuery().SetOwnerID(testUser_O1), chatstore.ChatSummaryOptions{
+		OrderByLastActivity: true,
+		UnreadForUserID:     testUser_O1,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(summaries) != 3 {
+		t.Fatal("expected 3 summaries, got", len(summaries))
+	}
+
+	expectedOrder := []string{chatBusy.ID(), chatQuiet.ID(), chatEmpty.ID()}
+	for i, summary := range summaries {
+		if summary.Chat.ID() != expectedOrder[i] {
+			t.Fatalf("summary %d: expected chat %s, got %s", i, expectedOrder[i], summary.Chat.ID())
+		}
+	}
+
+	busy := summaries[0]
+	if busy.MessageCount != 4 {
+		t.Fatal("expected 4 messages, got", busy.MessageCount)
+	}
+	if busy.LastMessage == nil || busy.LastMessage.Text() != "Still there?" {
+		t.Fatal("expected last message 'Still there?', got", busy.LastMessage)
+	}
+	if busy.UnreadCount != 2 {
+		t.Fatal("expected 2 unread messages, got", busy.UnreadCount)
+	}
+	if busy.LastActivityAt.Format(time.DateTime) != "2025-02-04 00:00:00" {
+		t.Fatal("unexpected last activity:", busy.LastActivityAt)
+	}
+
+	quiet := summaries[1]
+	if quiet.MessageCount != 1 || quiet.UnreadCount != 1 {
+		t.Fatalf("expected 1 message and 1 unread, got %d and %d", quiet.MessageCount, quiet.UnreadCount)
+	}
+	if quiet.LastMessage == nil || quiet.LastMessage.Text() != "Ping" {
+		t.Fatal("expected last message 'Ping', got", quiet.LastMessage)
+	}
+
+	empty := summaries[2]
+	if empty.MessageCount != 0 || empty.UnreadCount != 0 || empty.LastMessage != nil {
+		t.Fatal("expected an empty summary, got", empty)
+	}
+	if empty.LastActivityAt.Format(time.DateTime) != "2025-01-03 00:00:00" {
+		t.Fatal("unexpected last activity:", empty.LastActivityAt)
+	}
+
+	// Without the last activity order, the query order and limit apply
+	summaries, err = store.ChatListWithSummary(chatstore.ChatQuery().
+		SetOrderBy(chatstore.COLUMN_CREATED_AT).
+		SetOrderDirection("asc").
+		SetLimit(1), chatstore.ChatSummaryOptions{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(summaries) != 1 || summaries[0].Chat.ID() != chatBusy.ID() {
+		t.Fatal("expected the oldest chat only")
+	}
+
+	// Of the messages created within the same second, the greatest ID is the last
+	first := createMessage(chatEmpty.ID(), testUser_O2, "First", "2025-04-01 00:00:00")
+	second := createMessage(chatEmpty.ID(), testUser_O2, "Second", "2025-04-01 00:00:00")
+
+	summaries, err = store.ChatListWithSummary(chatstore.ChatQuery().SetID(chatEmpty.ID()), chatstore.ChatSummaryOptions{})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	last := max(first.ID(), second.ID())
+	if len(summaries) != 1 || summaries[0].LastMessage == nil || summaries[0].LastMessage.ID() != last {
+		t.Fatal("expected the last message to be", last)
+	}
+}
+
+func TestStore_ChatListWithSummaryLocalTime(t *testing.T) {
+	// The soft delete times are compared in UTC, whatever the local time zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	kept := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O2).SetText("Kept")
+	if err := store.MessageCreate(kept); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	deleted := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O2).SetText("Gone")
+	if err := store.MessageCreate(deleted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageSoftDelete(deleted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	summaries, err := store.ChatListWithSummary(chatstore.ChatQuery(), chatstore.ChatSummaryOptions{UnreadForUserID: testUser_O1})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(summaries) != 1 {
+		t.Fatal("expected 1 summary, got", len(summaries))
+	}
+
+	if summaries[0].MessageCount != 1 || summaries[0].UnreadCount != 1 {
+		t.Fatalf("expected 1 message and 1 unread, got %d and %d", summaries[0].MessageCount, summaries[0].UnreadCount)
+	}
+
+	if summaries[0].LastMessage == nil || summaries[0].LastMessage.ID() != kept.ID() {
+		t.Fatal("expected the last message not to be soft deleted")
+	}
+
+	if err := store.ChatSoftDelete(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("expected the soft deleted chat not to be found")
+	}
+}
+
+func TestStore_ChatActivityStats(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat_table",
+		TableMessageName:   "message_table",
+		AutomigrateEnabled: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	quietChat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(quietChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	messages := []chatstore.MessageInterface{}
+	for i := 0; i < 3; i++ {
+		message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("Message")
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		messages = append(messages, message)
+	}
+
+	assertStats := func(step string, expectedCount int64, expectLastMessageAt bool) {
+		found, err := store.ChatFindByID(chat.ID())
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step, err)
+		}
+
+		if found.MessageCount() != expectedCount {
+			t.Fatalf("%s: expected %d messages, got %d", step, expectedCount, found.MessageCount())
+		}
+
+		if (found.LastMessageAt() != "") != expectLastMessageAt {
+			t.Fatalf("%s: unexpected last message at %q", step, found.LastMessageAt())
+		}
+	}
+
+	assertStats("create", 3, true)
+
+	if err := store.MessageSoftDelete(messages[0]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertStats("soft delete", 2, true)
+
+	if err := store.MessageDelete(messages[1]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertStats("delete", 1, true)
+
+	// The chat with the latest message comes first
+	list, err := store.ChatList(chatstore.ChatQuery().SetOrderBy(chatstore.COLUMN_LAST_MESSAGE_AT).SetOrderDirection("desc"))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	if len(list) != 2 || list[0].ID() != chat.ID() {
+		t.Fatal("expected the active chat first")
+	}
+
+	// Changes made outside of the store are repaired by recomputing
+	_, err = db.Exec("DELETE FROM message_table WHERE id = ?", messages[2].ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertStats("external delete", 1, true)
+
+	if err := store.RecomputeChatStats(); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertStats("recompute", 0, false)
+}
+
+func TestStore_ChatActivityStatsLocalTime(t *testing.T) {
+	// The soft delete times are compared in UTC, whatever the local time zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC-5", -5*60*60)
+	defer func() { time.Local = local }()
+
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	messages := []chatstore.MessageInterface{}
+	for i := 0; i < 2; i++ {
+		message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("Message")
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		messages = append(messages, message)
+	}
+
+	if err := store.MessageSoftDelete(messages[0]); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.MessageCount() != 1 {
+		t.Fatal("expected the soft deleted message not to be counted, got", found.MessageCount())
+	}
+}
+
+func TestStore_ChatActivityStatsOnMessageMove(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	from := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(from); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	to := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(to); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(from.ID()).SetSenderID(testUser_O1).SetText("Message")
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assertCount := func(step string, chatID string, expected int64) {
+		found, err := store.ChatFindByID(chatID)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", step, err)
+		}
+
+		if found.MessageCount() != expected {
+			t.Fatalf("%s: expected %d messages, got %d", step, expected, found.MessageCount())
+		}
+
+		if (found.LastMessageAt() != "") != (expected > 0) {
+			t.Fatalf("%s: unexpected last message at %q", step, found.LastMessageAt())
+		}
+	}
+
+	message.SetChatID(to.ID())
+	if err := store.MessageUpdate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertCount("update from", from.ID(), 0)
+	assertCount("update to", to.ID(), 1)
+
+	message.SetSoftDeletedAt(time.Now().UTC().Format(time.DateTime))
+	if err := store.MessageUpdate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertCount("update soft deleted", to.ID(), 0)
+
+	message.SetSoftDeletedAt(chatstore.MAX_DATETIME)
+	if err := store.MessageUpdate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertCount("update restored", to.ID(), 1)
+
+	message.SetChatID(from.ID())
+	if err := store.MessageUpsert(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+	assertCount("upsert from", from.ID(), 1)
+	assertCount("upsert to", to.ID(), 0)
+}
+
+func TestStore_ChatFindOrCreateDirect(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat, created, err := store.ChatFindOrCreateDirect(testUser_O1, testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !created {
+		t.Fatal("expected the chat to be created")
+	}
+
+	if chat.OwnerID() != testUser_O1 || chat.DirectKey() != chatstore.DirectChatKey(testUser_O1, testUser_O2) {
+		t.Fatal("unexpected owner or direct key:", chat.OwnerID(), chat.DirectKey())
+	}
+
+	// The same chat is found whatever the order of the users
+	found, created, err := store.ChatFindOrCreateDirect(testUser_O2, testUser_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if created {
+		t.Fatal("expected the existing chat to be found")
+	}
+
+	if found.ID() != chat.ID() {
+		t.Fatal("expected chat", chat.ID(), "got", found.ID())
+	}
+
+	// The direct key is managed by the store, never set by the caller
+	duplicate := chatstore.NewChat().SetOwnerID(testUser_O2).SetDirectKey(chat.DirectKey())
+	if err := store.ChatCreate(duplicate); !errors.Is(err, chatstore.ErrDirectKey) {
+		t.Fatal("expected ErrDirectKey, got", err)
+	}
+
+	if err := store.ChatUpsert(duplicate); !errors.Is(err, chatstore.ErrDirectKey) {
+		t.Fatal("expected ErrDirectKey, got", err)
+	}
+
+	found.SetDirectKey("")
+	if err := store.ChatUpdate(found); !errors.Is(err, chatstore.ErrDirectKey) {
+		t.Fatal("expected ErrDirectKey, got", err)
+	}
+
+	found.SetDirectKey(chat.DirectKey()).SetTitle("Direct")
+	if err := store.ChatUpsert(found); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Chats without a direct key are not subject to the constraint
+	for i := 0; i < 2; i++ {
+		if err := store.ChatCreate(chatstore.NewChat().SetOwnerID(testUser_O1)); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	_, _, err = store.ChatFindOrCreateDirect(testUser_O1, "")
+	if err == nil {
+		t.Fatal("expected error for an empty user ID")
+	}
+
+	// The keys of ("a", "b:c") and ("a:b", "c") would collide
+	_, _, err = store.ChatFindOrCreateDirect("a", "b:c")
+	if err == nil {
+		t.Fatal("expected error for a user ID with a colon")
+	}
+
+	_, _, err = store.ChatFindOrCreateDirect("a/b", "c")
+	if err == nil {
+		t.Fatal("expected error for a user ID with a slash")
+	}
+}
+
+func TestStore_ChatUpdateNotFound(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	chat.SetTitle("Never stored")
+
+	err = store.ChatUpdate(chat)
+	if !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_ChatUpsert(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE).
+		SetTitle("First title")
+
+	// Inserts the chat
+	err = store.ChatUpsert(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	inserted, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if inserted == nil {
+		t.Fatal("Chat MUST be inserted")
+	}
+
+	if inserted.Title() != "First title" {
+		t.Fatalf("Expected title 'First title', got '%s'", inserted.Title())
+	}
+
+	// Updates the chat with the same ID
+	replacement := chatstore.NewChat().
+		SetID(chat.ID()).
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_INACTIVE).
+		SetTitle("Second title")
+
+	err = store.ChatUpsert(replacement)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	count, err := store.ChatCount(chatstore.ChatQuery().SetOwnerID(testUser_O1))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 chat, got %d", count)
+	}
+
+	updated, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if updated.Title() != "Second title" {
+		t.Fatalf("Expected title 'Second title', got '%s'", updated.Title())
+	}
+
+	if updated.Status() != chatstore.CHAT_STATUS_INACTIVE {
+		t.Fatalf("Expected status %s, got %s", chatstore.CHAT_STATUS_INACTIVE, updated.Status())
+	}
+
+	if updated.Version() != inserted.Version()+1 {
+		t.Fatalf("Expected version %d, got %d", inserted.Version()+1, updated.Version())
+	}
+
+	if updated.CreatedAt() != inserted.CreatedAt() {
+		t.Fatalf("Expected created at %s to be kept, got %s", inserted.CreatedAt(), updated.CreatedAt())
+	}
+
+	if replacement.Version() != updated.Version() {
+		t.Fatalf("Expected upserted chat version %d, got %d", updated.Version(), replacement.Version())
+	}
+
+	// The upserted chat can be updated further without being stale
+	replacement.SetMemo("Follow up")
+
+	err = store.ChatUpdate(replacement)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
@@ -0,0 +1,209 @@
+package chatstore
+
+import (
+	"errors"
+	"slices"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	neatquery "github.com/dracory/neat/database/query"
+	"github.com/dromara/carbon/v2"
+)
+
+// == MESSAGE DELIVERY ========================================================
+
+// MessageMarkSent records the message as sent to the recipients, e.g. to the
+// members of a group chat. A message created with a recipient is marked sent
+// to it by the store.
+func (st *storeImplementation) MessageMarkSent(messageID string, recipientIDs ...string) error {
+	if len(recipientIDs) == 0 {
+		return errors.New("recipient IDs are required")
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	return st.deliveryMark(messageID, recipientIDs, DELIVERY_STATUS_SENT, "")
+}
+
+// MessageMarkDelivered records the message as delivered to the recipient.
+// A message already read by the recipient stays read.
+func (st *storeImplementation) MessageMarkDelivered(messageID string, recipientID string) error {
+	if err := st.deliveryReceiptAuthorize(messageID, recipientID); err != nil {
+		return err
+	}
+
+	return st.deliveryMark(messageID, []string{recipientID}, DELIVERY_STATUS_DELIVERED, "")
+}
+
+// MessageMarkRead records the message as read by the recipient.
+func (st *storeImplementation) MessageMarkRead(messageID string, recipientID string) error {
+	if err := st.deliveryReceiptAuthorize(messageID, recipientID); err != nil {
+		return err
+	}
+
+	return st.deliveryMark(messageID, []string{recipientID}, DELIVERY_STATUS_READ, "")
+}
+
+// MessageMarkFailed records a failed attempt to deliver the message to the
+// recipient, with the reason of the failure. A message already delivered to
+// the recipient stays delivered.
+func (st *storeImplementation) MessageMarkFailed(messageID string, recipientID string, reason string) error {
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_EDIT); err != nil {
+		return err
+	}
+
+	return st.deliveryMark(messageID, []string{recipientID}, DELIVERY_STATUS_FAILED, reason)
+}
+
+// MessageDeliveryList returns the deliveries of the message, ordered by recipient.
+func (st *storeImplementation) MessageDeliveryList(messageID string) ([]MessageDelivery, error) {
+	if messageID == "" {
+		return nil, errors.New("message ID is required")
+	}
+
+	if err := st.tenantMessageCheck(messageID); err != nil {
+		return nil, err
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_READ); err != nil {
+		return nil, err
+	}
+
+	var rows []deliveryRow
+	err := st.db.Query().Table(st.tableDelivery).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		OrderBy(COLUMN_RECIPIENT_ID, "asc").
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	deliveries := make([]MessageDelivery, 0, len(rows))
+	for _, r := range rows {
+		deliveries = append(deliveries, r.toDelivery())
+	}
+
+	return deliveries, nil
+}
+
+// deliveryReceiptAuthorize returns ErrForbidden when the principal may not
+// read the message, or records a receipt on behalf of another recipient.
+func (st *storeImplementation) deliveryReceiptAuthorize(messageID string, recipientID string) error {
+	if err := st.userAuthorize(recipientID); err != nil {
+		return err
+	}
+	return st.messageAuthorize(messageID, ACCESS_ACTION_READ)
+}
+
+// deliveryMark moves the deliveries of the message to the recipients to the
+// status, and updates the delivery status of the message.
+func (st *storeImplementation) deliveryMark(messageID string, recipientIDs []string, status string, reason string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if slices.Contains(recipientIDs, "") {
+		return errors.New("recipient ID is required")
+	}
+
+	return st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		var count int64
+		err := st.tenantScope(txQuery(tx).Table(st.tableMessage)).Where(COLUMN_ID+" = ?", messageID).Count(&count)
+		if err != nil {
+			return err
+		}
+
+		if count == 0 {
+			return ErrNotFound
+		}
+
+		for _, recipientID := range recipientIDs {
+			if err := st.deliveryStatusSet(tx, messageID, recipientID, status, reason); err != nil {
+				return err
+			}
+		}
+
+		return st.messageDeliveryStatusUpdate(tx, messageID)
+	})
+}
+
+// deliveryStatusSet creates the delivery of the message to the recipient with
+// the status, or moves the existing delivery to it. A delivery never moves
+// backwards, so late or duplicate receipts are ignored.
+func (st *storeImplementation) deliveryStatusSet(tx contractsorm.Query, messageID string, recipientID string, status string, reason string) error {
+	now := carbon.Now(carbon.UTC).StdTime()
+
+	attempts := int64(0)
+	if status == DELIVERY_STATUS_FAILED {
+		attempts = 1
+	}
+
+	var count int64
+	err := txQuery(tx).Table(st.tableDelivery).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		Where(COLUMN_RECIPIENT_ID+" = ?", recipientID).
+		Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return txQuery(tx).Table(st.tableDelivery).Create(map[string]any{
+			COLUMN_MESSAGE_ID:     messageID,
+			COLUMN_RECIPIENT_ID:   recipientID,
+			COLUMN_STATUS:         status,
+			COLUMN_ATTEMPTS:       attempts,
+			COLUMN_FAILURE_REASON: nullIfEmpty(reason),
+			COLUMN_CREATED_AT:     now,
+			COLUMN_UPDATED_AT:     now,
+		})
+	}
+
+	row := map[string]any{
+		COLUMN_STATUS:     status,
+		COLUMN_UPDATED_AT: now,
+	}
+
+	if status == DELIVERY_STATUS_FAILED {
+		row[COLUMN_ATTEMPTS] = neatquery.RawExpr(COLUMN_ATTEMPTS + " + 1")
+		row[COLUMN_FAILURE_REASON] = nullIfEmpty(reason)
+	}
+
+	// The status precondition leaves a delivery which is further along as is
+	_, err = txQuery(tx).Table(st.tableDelivery).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		Where(COLUMN_RECIPIENT_ID+" = ?", recipientID).
+		Where(COLUMN_STATUS+" IN ?", deliveryStatusesFrom(status)).
+		Update(row)
+	return err
+}
+
+// messageDeliveryStatusUpdate stores the delivery status of the message
+// aggregated from its deliveries.
+func (st *storeImplementation) messageDeliveryStatusUpdate(tx contractsorm.Query, messageID string) error {
+	type statusRow struct {
+		Status string `db:"status"`
+	}
+
+	var rows []statusRow
+	err := txQuery(tx).Table(st.tableDelivery).
+		Select(COLUMN_STATUS).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		Get(&rows)
+	if err != nil {
+		return err
+	}
+
+	statuses := make([]string, 0, len(rows))
+	for _, r := range rows {
+		statuses = append(statuses, r.Status)
+	}
+
+	_, err = txQuery(tx).Table(st.tableMessage).
+		Where(COLUMN_ID+" = ?", messageID).
+		Update(map[string]any{
+			COLUMN_DELIVERY_STATUS: nullIfEmpty(deliveryStatusAggregate(statuses)),
+		})
+	return err
+}
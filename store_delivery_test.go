@@ -0,0 +1,160 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_MessageDelivery(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	const testUser_O3 = "00000000000000000000000000000003"
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Hello group")
+
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if message.DeliveryStatus() != chatstore.DELIVERY_STATUS_SENT {
+		t.Fatalf("Expected delivery status %s, got %s", chatstore.DELIVERY_STATUS_SENT, message.DeliveryStatus())
+	}
+
+	// Sent to another member of the group
+	if err := store.MessageMarkSent(message.ID(), testUser_O3); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assertDeliveryStatus := func(t *testing.T, expected string) {
+		t.Helper()
+
+		found, err := store.MessageFindByID(message.ID())
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if found.DeliveryStatus() != expected {
+			t.Fatalf("Expected delivery status %s, got %s", expected, found.DeliveryStatus())
+		}
+	}
+
+	assertUndelivered := func(t *testing.T, userID string, expected int64) {
+		t.Helper()
+
+		count, err := store.MessageCount(chatstore.MessageQuery().SetUndeliveredForUserID(userID))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if count != expected {
+			t.Fatalf("Expected %d undelivered messages for %s, got %d", expected, userID, count)
+		}
+	}
+
+	assertUndelivered(t, testUser_O2, 1)
+	assertUndelivered(t, testUser_O3, 1)
+
+	if err := store.MessageMarkDelivered(message.ID(), testUser_O2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assertUndelivered(t, testUser_O2, 0)
+	// Still sent to the other member
+	assertDeliveryStatus(t, chatstore.DELIVERY_STATUS_SENT)
+
+	if err := store.MessageMarkFailed(message.ID(), testUser_O3, "device offline"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageMarkFailed(message.ID(), testUser_O3, "push token expired"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assertDeliveryStatus(t, chatstore.DELIVERY_STATUS_FAILED)
+	assertUndelivered(t, testUser_O3, 1)
+
+	count, err := store.MessageCount(chatstore.MessageQuery().SetDeliveryStatus(chatstore.DELIVERY_STATUS_FAILED))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 failed message, got %d", count)
+	}
+
+	deliveries, err := store.MessageDeliveryList(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(deliveries) != 2 {
+		t.Fatalf("Expected 2 deliveries, got %d", len(deliveries))
+	}
+
+	for _, delivery := range deliveries {
+		if delivery.RecipientID == testUser_O3 && (delivery.Attempts != 2 || delivery.FailureReason != "push token expired") {
+			t.Fatalf("Unexpected failed delivery: %+v", delivery)
+		}
+	}
+
+	// Both members read the message
+	if err := store.MessageMarkRead(message.ID(), testUser_O2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageMarkRead(message.ID(), testUser_O3); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assertDeliveryStatus(t, chatstore.DELIVERY_STATUS_READ)
+
+	// A late delivery receipt does not move the delivery backwards
+	if err := store.MessageMarkDelivered(message.ID(), testUser_O2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageMarkFailed(message.ID(), testUser_O3, "late failure"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	assertDeliveryStatus(t, chatstore.DELIVERY_STATUS_READ)
+
+	// Deleting the message deletes its deliveries
+	if err := store.MessageDeleteByID(message.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	deliveries, err = store.MessageDeliveryList(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(deliveries) != 0 {
+		t.Fatalf("Expected no deliveries, got %d", len(deliveries))
+	}
+}
+
+func TestStore_MessageMarkDeliveredNotFound(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.MessageMarkDelivered("missing", testUser_O2)
+	if !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.MessageMarkSent("missing"); err == nil {
+		t.Fatal("Expected an error without recipients")
+	}
+}
@@ -0,0 +1,161 @@
+package chatstore
+
+import (
+	"errors"
+	"fmt"
+)
+
+// == ENCRYPTION ==============================================================
+
+// messageEncryptedColumns are the message columns encrypted at rest
+var messageEncryptedColumns = []string{COLUMN_TEXT, COLUMN_MEMO, COLUMN_METAS}
+
+// MessageReencrypt re-encrypts, in batches of the given size, the messages
+// (including the soft deleted ones) with fields encrypted with an older key
+// or stored before encryption was enabled, and returns the number of
+// messages re-encrypted. It is run after rotating to a new key, and can
+// be interrupted and run again.
+func (st *storeImplementation) MessageReencrypt(batchSize int) (int64, error) {
+	if st.encryptor == nil {
+		return 0, errors.New("encryption is not enabled")
+	}
+
+	if batchSize <= 0 {
+		return 0, errors.New("batch size must be positive")
+	}
+
+	if err := st.storeAuthorize(ACCESS_ACTION_ADMINISTER); err != nil {
+		return 0, err
+	}
+
+	type encryptedRow struct {
+		ID    string `db:"id"`
+		Text  string `db:"text"`
+		Memo  string `db:"memo"`
+		Metas string `db:"metas"`
+	}
+
+	var reencrypted int64
+	lastID := ""
+
+	for {
+		var rows []encryptedRow
+		err := st.tenantScope(st.db.Query().Table(st.tableMessage)).
+			Select(COLUMN_ID+", "+COLUMN_TEXT+", "+COLUMN_MEMO+", "+COLUMN_METAS).
+			Where(COLUMN_ID+" > ?", lastID).
+			OrderBy(COLUMN_ID, "asc").
+			Limit(batchSize).
+			Get(&rows)
+		if err != nil {
+			return reencrypted, err
+		}
+
+		for _, r := range rows {
+			lastID = r.ID
+
+			stored := map[string]string{COLUMN_TEXT: r.Text, COLUMN_MEMO: r.Memo, COLUMN_METAS: r.Metas}
+			row := map[string]any{}
+
+			for _, column := range messageEncryptedColumns {
+				value := stored[column]
+				if value == "" || st.encryptor.KeyID(value) == st.encryptor.CurrentKeyID() {
+					continue
+				}
+
+				plaintext, err := st.encryptor.Decrypt(value)
+				if err != nil {
+					return reencrypted, fmt.Errorf("message %s: %w", r.ID, err)
+				}
+
+				if row[column], err = st.encryptor.Encrypt(plaintext); err != nil {
+					return reencrypted, err
+				}
+			}
+
+			if len(row) == 0 {
+				continue
+			}
+
+			// The values preconditions skip a message changed meanwhile,
+			// which was written with the current key
+			q := st.tenantScope(st.db.Query().Table(st.tableMessage)).Where(COLUMN_ID+" = ?", r.ID)
+			for _, column := range messageEncryptedColumns {
+				if _, ok := row[column]; ok {
+					q = q.Where(column+" = ?", stored[column])
+				}
+			}
+
+			result, err := q.Update(row)
+			if err != nil {
+				return reencrypted, err
+			}
+
+			reencrypted += result.RowsAffected
+		}
+
+		if len(rows) < batchSize {
+			break
+		}
+	}
+
+	if st.debugEnabled {
+		st.logger.Debug("Messages re-encrypted", "count", reencrypted, "key_id", st.encryptor.CurrentKeyID())
+	}
+
+	return reencrypted, nil
+}
+
+// messageEncryptRow encrypts the encrypted columns present in the row
+// of a message about to be written, when encryption is enabled.
+func (st *storeImplementation) messageEncryptRow(row map[string]any) error {
+	if st.encryptor == nil {
+		return nil
+	}
+
+	for _, column := range messageEncryptedColumns {
+		value, ok := row[column].(string)
+		if !ok || value == "" {
+			continue
+		}
+
+		encrypted, err := st.encryptor.Encrypt(value)
+		if err != nil {
+			return err
+		}
+
+		row[column] = encrypted
+	}
+
+	return nil
+}
+
+// messageFromRow hydrates the message from the row, decrypting its
+// encrypted fields when encryption is enabled.
+func (st *storeImplementation) messageFromRow(r messageRow) (MessageInterface, error) {
+	if st.encryptor == nil {
+		return r.toMessage(), nil
+	}
+
+	var err error
+	for _, field := range []*string{&r.Text, &r.Memo, &r.Metas} {
+		if *field, err = st.encryptor.Decrypt(*field); err != nil {
+			return nil, fmt.Errorf("message %s: %w", r.ID, err)
+		}
+	}
+
+	return r.toMessage(), nil
+}
+
+// messageQueryEncryptionCheck returns ErrEncryptedField when the query
+// filters by the metas, which are encrypted when encryption is enabled.
+func (st *storeImplementation) messageQueryEncryptionCheck(query MessageQueryInterface) error {
+	if st.encryptor == nil || query == nil {
+		return nil
+	}
+
+	if len(query.GetMetaEquals()) > 0 || len(query.GetMetaExists()) > 0 || len(query.GetMetaIn()) > 0 {
+		return fmt.Errorf("%w: message meta filters", ErrEncryptedField)
+	}
+
+	return nil
+}
@@ -0,0 +1,193 @@
+package chatstore_test
+
+import (
+	"bytes"
+	"database/sql"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_Encryption(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	keys := map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)}
+
+	newStore := func(currentKeyID string) chatstore.StoreInterface {
+		encryptor, err := chatstore.NewAESGCMEncryptor(currentKeyID, keys)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+			DB:                 db,
+			TableChatName:      "chat",
+			TableMessageName:   "message",
+			AutomigrateEnabled: true,
+			Encryptor:          encryptor,
+		})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return store
+	}
+
+	storedText := func(id string) string {
+		var text string
+		if err := db.QueryRow("SELECT text FROM message WHERE id = ?", id).Scan(&text); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return text
+	}
+
+	store := newStore("k1")
+
+	message := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("Top secret")
+	if err := message.SetMeta("topic", "plans"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if strings.Contains(storedText(message.ID()), "secret") {
+		t.Fatal("expected the text to be encrypted at rest")
+	}
+
+	// The metas are rewritten rather than changed in the database
+	if err := store.MessageMetaSet(message.ID(), "priority", "high"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	priority, _ := found.Meta("priority")
+	topic, _ := found.Meta("topic")
+	if found.Text() != "Top secret" || priority != "high" || topic != "plans" {
+		t.Fatalf("unexpected decrypted message: %q %q %q", found.Text(), priority, topic)
+	}
+
+	_, err = store.MessageList(chatstore.MessageQuery().SetMetaEquals("topic", "plans"))
+	if !errors.Is(err, chatstore.ErrEncryptedField) {
+		t.Fatal("expected ErrEncryptedField, got", err)
+	}
+
+	// Rotating the key re-encrypts the messages with the new key
+	keys["k2"] = bytes.Repeat([]byte{2}, 32)
+	store = newStore("k2")
+
+	count, err := store.MessageReencrypt(10)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("expected 1 message re-encrypted, got", count)
+	}
+
+	if !strings.HasPrefix(storedText(message.ID()), "enc:k2:") {
+		t.Fatal("expected the text to be encrypted with the new key, got", storedText(message.ID()))
+	}
+
+	// The old key is no longer needed
+	delete(keys, "k1")
+	store = newStore("k2")
+
+	found, err = store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Text() != "Top secret" {
+		t.Fatal("expected the decrypted text, got", found.Text())
+	}
+
+	count, err = store.MessageReencrypt(10)
+	if err != nil || count != 0 {
+		t.Fatal("expected nothing left to re-encrypt, got", count, err)
+	}
+}
+
+func TestStore_EncryptionIndexedMetaKeys(t *testing.T) {
+	encryptor, err := chatstore.NewAESGCMEncryptor("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	_, err = chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                     &sql.DB{},
+		TableChatName:          "chat",
+		TableMessageName:       "message",
+		MessageIndexedMetaKeys: []string{"topic"},
+		Encryptor:              encryptor,
+	})
+	if err == nil {
+		t.Fatal("expected an error for indexed meta keys with encryption")
+	}
+}
+
+func TestStore_EncryptionLegacyPlaintext(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	newStore := func(encryptor chatstore.Encryptor) chatstore.StoreInterface {
+		store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+			DB:                 db,
+			TableChatName:      "chat",
+			TableMessageName:   "message",
+			AutomigrateEnabled: true,
+			Encryptor:          encryptor,
+		})
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		return store
+	}
+
+	// A message stored before encryption was enabled, looking encrypted
+	legacy := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("enc:k1:not encrypted")
+	if err := newStore(nil).MessageCreate(legacy); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	encryptor, err := chatstore.NewAESGCMEncryptor("k1", map[string][]byte{"k1": bytes.Repeat([]byte{1}, 32)})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store := newStore(encryptor)
+
+	message := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("Top secret")
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	messages, err := store.MessageList(chatstore.MessageQuery().SetChatID(testChat_O1))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(messages) != 2 {
+		t.Fatal("expected both messages, got", len(messages))
+	}
+
+	found, err := store.MessageFindByID(legacy.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Text() != "enc:k1:not encrypted" {
+		t.Fatal("expected the plain text, got", found.Text())
+	}
+}
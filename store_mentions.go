@@ -0,0 +1,149 @@
+package chatstore
+
+import (
+	"errors"
+	"unicode/utf8"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+)
+
+// == MENTIONS ================================================================
+
+// MessageListMentioning returns the messages matching the query (all messages
+// when nil) which mention the user. A copy of the query is narrowed to the
+// user's mentions, leaving the query unchanged.
+func (st *storeImplementation) MessageListMentioning(userID string, query MessageQueryInterface) ([]MessageInterface, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	if err := st.userAuthorize(userID); err != nil {
+		return nil, err
+	}
+
+	if query == nil {
+		query = MessageQuery().
+			SetOrderBy(COLUMN_CREATED_AT).
+			SetOrderDirection("desc")
+	}
+
+	return st.MessageList(query.Clone().SetMentionedUserID(userID))
+}
+
+// MessageMentionList returns the users mentioned in the message, in the
+// order they appear in its text.
+func (st *storeImplementation) MessageMentionList(messageID string) ([]Mention, error) {
+	if messageID == "" {
+		return nil, errors.New("message ID is required")
+	}
+
+	if err := st.tenantMessageCheck(messageID); err != nil {
+		return nil, err
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_READ); err != nil {
+		return nil, err
+	}
+
+	type mentionRow struct {
+		MessageID string `db:"message_id"`
+		UserID    string `db:"user_id"`
+		Offset    int    `db:"text_offset"`
+	}
+
+	var rows []mentionRow
+	err := st.db.Query().Table(st.tableMention).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		OrderBy(COLUMN_TEXT_OFFSET, "asc").
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	mentions := make([]Mention, 0, len(rows))
+	for _, r := range rows {
+		mentions = append(mentions, Mention{MessageID: r.MessageID, UserID: r.UserID, Offset: r.Offset})
+	}
+
+	return mentions, nil
+}
+
+// MessageUnreadMentionCounts returns the number of messages mentioning the
+// user in each chat which are unread, i.e. sent by others and not marked
+// read by the user (see MessageMarkRead), keyed by chat ID.
+func (st *storeImplementation) MessageUnreadMentionCounts(userID string) (map[string]int64, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	if err := st.userAuthorize(userID); err != nil {
+		return nil, err
+	}
+
+	type unreadRow struct {
+		ChatID      string `db:"chat_id"`
+		UnreadCount int64  `db:"unread_count"`
+	}
+
+	var rows []unreadRow
+	err := st.buildMessageQueryFilters(NewMessageQuery().
+		SetMentionedUserID(userID).
+		SetSenderIDNotIn([]string{userID})).
+		Table(st.tableMessage).
+		Select(COLUMN_CHAT_ID+", COUNT(*) AS unread_count").
+		Where("NOT EXISTS ("+st.messageReadSQL()+")", userID, DELIVERY_STATUS_READ).
+		Group(COLUMN_CHAT_ID).
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	unreadCounts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		unreadCounts[r.ChatID] = r.UnreadCount
+	}
+
+	return unreadCounts, nil
+}
+
+// mentionsReplace replaces the stored mentions of the message with the
+// mentions parsed from its text.
+func (st *storeImplementation) mentionsReplace(tx contractsorm.Query, message MessageInterface) error {
+	_, err := txQuery(tx).Table(st.tableMention).
+		Where(COLUMN_MESSAGE_ID+" = ?", message.ID()).
+		Delete()
+	if err != nil {
+		return err
+	}
+
+	type mentionKey struct {
+		userID string
+		offset int
+	}
+
+	seen := map[mentionKey]bool{}
+	for _, mention := range st.mentionParser.Parse(message.Text()) {
+		key := mentionKey{mention.UserID, mention.Offset}
+		if mention.UserID == "" || seen[key] {
+			continue
+		}
+
+		// A token longer than a user ID cannot mention a user
+		if utf8.RuneCountInString(mention.UserID) > MAX_LENGTH_USER_ID {
+			continue
+		}
+
+		seen[key] = true
+
+		err := txQuery(tx).Table(st.tableMention).Create(map[string]any{
+			COLUMN_MESSAGE_ID:  message.ID(),
+			COLUMN_USER_ID:     mention.UserID,
+			COLUMN_TEXT_OFFSET: mention.Offset,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
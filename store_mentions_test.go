@@ -0,0 +1,202 @@
+package chatstore_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_MessageMentions(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	const testChat_O2 = "00000000000000000000000000000020"
+
+	mentioning := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetText("@" + testUser_O2 + " can you review this?")
+
+	other := chatstore.NewMessage().
+		SetChatID(testChat_O2).
+		SetSenderID(testUser_O1).
+		SetText("Nothing to see")
+
+	for _, message := range []chatstore.MessageInterface{mentioning, other} {
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	mentions, err := store.MessageMentionList(mentioning.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(mentions) != 1 || mentions[0].UserID != testUser_O2 || mentions[0].Offset != 0 || mentions[0].MessageID != mentioning.ID() {
+		t.Fatalf("Unexpected mentions: %+v", mentions)
+	}
+
+	list, err := store.MessageListMentioning(testUser_O2, nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].ID() != mentioning.ID() {
+		t.Fatalf("Expected the mentioning message, got %d messages", len(list))
+	}
+
+	counts, err := store.MessageUnreadMentionCounts(testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if counts[testChat_O1] != 1 || len(counts) != 1 {
+		t.Fatalf("Expected 1 unread mention in the first chat, got %v", counts)
+	}
+
+	// Editing the text moves the mention to the other chat's message
+	mentioning.SetText("Never mind")
+	if err := store.MessageUpdate(mentioning); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	other.SetText("Ping @" + testUser_O2)
+	if err := store.MessageUpdate(other); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	list, err = store.MessageListMentioning(testUser_O2, chatstore.MessageQuery().SetChatID(testChat_O2))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 || list[0].ID() != other.ID() {
+		t.Fatalf("Expected the other message, got %d messages", len(list))
+	}
+
+	// Replying does not read the mention, the read receipt does
+	reply := chatstore.NewMessage().
+		SetChatID(testChat_O2).
+		SetSenderID(testUser_O2).
+		SetText("Pong")
+
+	if err := store.MessageCreate(reply); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	counts, err = store.MessageUnreadMentionCounts(testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if counts[testChat_O2] != 1 {
+		t.Fatalf("Expected 1 unread mention in the other chat, got %v", counts)
+	}
+
+	if err := store.MessageMarkRead(other.ID(), testUser_O2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	counts, err = store.MessageUnreadMentionCounts(testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(counts) != 0 {
+		t.Fatalf("Expected no unread mentions, got %v", counts)
+	}
+
+	// Deleting the message deletes its mentions
+	if err := store.MessageDeleteByID(other.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	mentions, err = store.MessageMentionList(other.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(mentions) != 0 {
+		t.Fatalf("Expected no mentions, got %+v", mentions)
+	}
+}
+
+func TestStore_MessageListMentioningQuery(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetText("@" + testUser_O2 + " and @" + strings.Repeat("x", chatstore.MAX_LENGTH_USER_ID+1))
+
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A token longer than a user ID is not a mention
+	mentions, err := store.MessageMentionList(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(mentions) != 1 || mentions[0].UserID != testUser_O2 {
+		t.Fatalf("Unexpected mentions: %+v", mentions)
+	}
+
+	// The query of the caller is left unchanged
+	query := chatstore.MessageQuery().SetChatID(testChat_O1)
+	list, err := store.MessageListMentioning(testUser_O2, query)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("Expected the mentioning message, got %d messages", len(list))
+	}
+
+	if query.IsMentionedUserIDSet() {
+		t.Fatal("Expected the query not to be narrowed to the mentions")
+	}
+
+	count, err := store.MessageCount(query)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("Expected the query to count the chat messages, got", count)
+	}
+}
+
+func TestStore_MentionsAccess(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	user, err := store.AsUser(chatstore.Principal{UserID: testUser_O1})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A user may not read the mentions of another user
+	if _, err := user.MessageListMentioning(testUser_O2, nil); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	if _, err := user.MessageUnreadMentionCounts(testUser_O2); !errors.Is(err, chatstore.ErrForbidden) {
+		t.Fatal("Expected ErrForbidden, got", err)
+	}
+
+	if _, err := user.MessageUnreadMentionCounts(testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+}
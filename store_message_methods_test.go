@@ -1,7 +1,10 @@
 package chatstore_test
 
 import (
+	"context"
+	"errors"
 	"testing"
+	"time"
 
 	"github.com/dracory/chatstore"
 	// _ "modernc.org/sqlite"
@@ -407,6 +410,85 @@ func TestStore_MessageList(t *testing.T) {
 	}
 }
 
+func TestMessageQuery_Clone(t *testing.T) {
+	query := chatstore.MessageQuery().
+		SetMetaEquals("topic", "billing").
+		SetMetaExists("priority").
+		SetMetaIn("region", []string{"eu"})
+
+	// Changing the copy leaves the query unchanged
+	clone := query.Clone().
+		SetMetaEquals("topic", "sales").
+		SetMetaExists("owner").
+		SetMetaIn("region", []string{"us"})
+
+	if query.GetMetaEquals()["topic"] != "billing" || len(query.GetMetaExists()) != 1 || query.GetMetaIn()["region"][0] != "eu" {
+		t.Fatal("Expected the query to be unchanged, got", query.GetMetaEquals(), query.GetMetaExists(), query.GetMetaIn())
+	}
+
+	if clone.GetMetaEquals()["topic"] != "sales" || len(clone.GetMetaExists()) != 2 || clone.GetMetaIn()["region"][0] != "us" {
+		t.Fatal("Expected the copy to be changed, got", clone.GetMetaEquals(), clone.GetMetaExists(), clone.GetMetaIn())
+	}
+}
+
+func TestStore_MessageQuery(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	for i := 0; i < 3; i++ {
+		err = store.MessageCreate(chatstore.NewMessage().
+			SetChatID(testChat_O1).
+			SetSenderID(testUser_O1).
+			SetRecipientID(testUser_O2).
+			SetText("Message"))
+		if err != nil {
+			t.Fatal("unexpected error creating message:", err)
+		}
+	}
+
+	// Test page data and total in one call
+	result, err := store.MessageQuery(chatstore.MessageQuery().
+		SetChatID(testChat_O1).
+		SetOffset(2).
+		SetLimit(2))
+	if err != nil {
+		t.Fatal("unexpected error querying messages:", err)
+	}
+
+	if len(result.Items) != 1 {
+		t.Fatalf("Expected 1 message on the page, got %d", len(result.Items))
+	}
+
+	if result.Total != 3 {
+		t.Fatalf("Expected total of 3 messages, got %d", result.Total)
+	}
+
+	// Test count only
+	countResult, err := store.MessageQuery(chatstore.MessageQuery().
+		SetChatID(testChat_O1).
+		SetCountOnly(true))
+	if err != nil {
+		t.Fatal("unexpected error counting messages:", err)
+	}
+
+	if len(countResult.Items) != 0 {
+		t.Fatalf("Expected no messages in count only mode, got %d", len(countResult.Items))
+	}
+
+	if countResult.Total != 3 {
+		t.Fatalf("Expected total of 3 messages, got %d", countResult.Total)
+	}
+
+	// Test invalid query
+	_, err = store.MessageQuery(chatstore.MessageQuery().SetChatID(""))
+	if err == nil {
+		t.Fatal("expected error for empty chat ID, but got nil")
+	}
+}
+
 func TestStore_MessageSoftDelete(t *testing.T) {
 	store, err := initStore(":memory:")
 
@@ -559,3 +641,584 @@ func TestStore_MessageUpdate(t *testing.T) {
 		t.Fatalf("Text not updated. Expected 'Message 2', got '%s'", updatedMessage.Text())
 	}
 }
+
+func TestStore_MessageUpdateStale(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Message 1")
+
+	err = store.MessageCreate(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Two workers load the same message
+	first, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	second, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.MessageUpdate(first.SetText("First text"))
+	if err != nil {
+		t.Fatal("unexpected error on first update:", err)
+	}
+
+	err = store.MessageUpdate(second.SetText("Second text"))
+	if !errors.Is(err, chatstore.ErrStaleEntity) {
+		t.Fatalf("Expected ErrStaleEntity, got %v", err)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Text() != "First text" {
+		t.Fatalf("Expected text 'First text', got '%s'", found.Text())
+	}
+}
+
+func TestStore_MessageUpdateWithRetry(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Message 1")
+
+	err = store.MessageCreate(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	attempts := 0
+	err = store.MessageUpdateWithRetry(message.ID(), func(m chatstore.MessageInterface) error {
+		attempts++
+
+		// Simulate a concurrent update on the first attempt
+		if attempts == 1 {
+			if err := store.MessageUpdate(message.SetMemo("Concurrent memo")); err != nil {
+				return err
+			}
+		}
+
+		return m.SetMeta("read", "yes")
+	})
+	if err != nil {
+		t.Fatal("unexpected error on update with retry:", err)
+	}
+
+	if attempts != 2 {
+		t.Fatalf("Expected 2 attempts, got %d", attempts)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Memo() != "Concurrent memo" {
+		t.Fatalf("Expected memo 'Concurrent memo', got '%s'", found.Memo())
+	}
+
+	read, err := found.Meta("read")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if read != "yes" {
+		t.Fatalf("Expected meta read 'yes', got '%s'", read)
+	}
+}
+
+func TestStore_MessageUpdateOnlyDirtyFields(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Message 1")
+
+	err = store.MessageCreate(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if message.IsDirty() {
+		t.Fatalf("Expected message not to be dirty after create, got %v", message.DirtyFields())
+	}
+
+	// Updating without changes is a no-op
+	err = store.MessageUpdate(message)
+	if err != nil {
+		t.Fatal("unexpected error on no-op update:", err)
+	}
+
+	if message.Version() != 0 {
+		t.Fatalf("Expected no-op update to keep version 0, got %d", message.Version())
+	}
+
+	err = store.MessageUpdate(message.SetText("Message 1 edited"))
+	if err != nil {
+		t.Fatal("unexpected error on update:", err)
+	}
+
+	if message.IsDirty() {
+		t.Fatalf("Expected message not to be dirty after update, got %v", message.DirtyFields())
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Text() != "Message 1 edited" {
+		t.Fatalf("Expected text 'Message 1 edited', got '%s'", found.Text())
+	}
+
+	if found.Version() != 1 {
+		t.Fatalf("Expected version 1 after update, got %d", found.Version())
+	}
+}
+
+func TestStore_MessageMetaSet(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Message 1")
+
+	err = message.SetMetas(map[string]string{"severity": "high"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.MessageCreate(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Two services set different keys without reading the message first
+	err = store.MessageMetaSet(message.ID(), "team", "backend")
+	if err != nil {
+		t.Fatal("unexpected error setting meta team:", err)
+	}
+
+	err = store.MessageMetaSet(message.ID(), "service", "web")
+	if err != nil {
+		t.Fatal("unexpected error setting meta service:", err)
+	}
+
+	err = store.MessageMetaSet(message.ID(), "severity", "low")
+	if err != nil {
+		t.Fatal("unexpected error overwriting meta severity:", err)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	metas, err := found.Metas()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(metas) != 3 || metas["severity"] != "low" || metas["team"] != "backend" || metas["service"] != "web" {
+		t.Fatalf("Unexpected metas: %v", metas)
+	}
+
+	if found.Version() != 3 {
+		t.Fatalf("Expected version 3, got %d", found.Version())
+	}
+
+	err = store.MessageMetaSet("missing", "team", "backend")
+	if err == nil {
+		t.Fatal("expected error for missing message, but got nil")
+	}
+}
+
+func TestStore_MessageMetaDelete(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Message 1")
+
+	err = message.SetMetas(map[string]string{"severity": "high", "team": "backend"})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.MessageCreate(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.MessageMetaDelete(message.ID(), "severity")
+	if err != nil {
+		t.Fatal("unexpected error deleting meta:", err)
+	}
+
+	// Deleting a missing key is not an error
+	err = store.MessageMetaDelete(message.ID(), "unknown")
+	if err != nil {
+		t.Fatal("unexpected error deleting missing meta:", err)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	metas, err := found.Metas()
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(metas) != 1 || metas["team"] != "backend" {
+		t.Fatalf("Unexpected metas: %v", metas)
+	}
+}
+
+func TestStore_MessageListMetaFilters(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                     db,
+		TableChatName:          "chat_table",
+		TableMessageName:       "message_table",
+		AutomigrateEnabled:     true,
+		MessageIndexedMetaKeys: []string{"team"},
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Running the migration again must keep the indexed meta columns
+	err = store.MigrateUp(context.Background())
+	if err != nil {
+		t.Fatal("unexpected error on repeated migration:", err)
+	}
+
+	metasList := []map[string]string{
+		{"team": "backend", "severity": "high"},
+		{"team": "frontend", "severity": "low"},
+		{"team": "ops"},
+		{},
+	}
+
+	for _, metas := range metasList {
+		message := chatstore.NewMessage().
+			SetChatID(testChat_O1).
+			SetSenderID(testUser_O1).
+			SetRecipientID(testUser_O2).
+			SetText("Message")
+		if err := message.SetMetas(metas); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	// The indexed "team" key reads the generated column, "severity" the metas JSON
+	testCases := []struct {
+		name     string
+		query    chatstore.MessageQueryInterface
+		expected int
+	}{
+		{"equals indexed", chatstore.MessageQuery().SetMetaEquals("team", "backend"), 1},
+		{"equals", chatstore.MessageQuery().SetMetaEquals("severity", "low"), 1},
+		{"equals multiple", chatstore.MessageQuery().SetMetaEquals("team", "backend").SetMetaEquals("severity", "low"), 0},
+		{"exists indexed", chatstore.MessageQuery().SetMetaExists("team"), 3},
+		{"exists", chatstore.MessageQuery().SetMetaExists("severity"), 2},
+		{"in indexed", chatstore.MessageQuery().SetMetaIn("team", []string{"backend", "ops"}), 2},
+		{"in", chatstore.MessageQuery().SetMetaIn("severity", []string{"high", "medium"}), 1},
+	}
+
+	for _, tc := range testCases {
+		list, err := store.MessageList(tc.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		if len(list) != tc.expected {
+			t.Fatalf("%s: expected %d messages, got %d", tc.name, tc.expected, len(list))
+		}
+	}
+}
+
+func TestStore_MessageListParticipantFilters(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	const testUser_O3 = "00000000000000000000000000000050"
+
+	pairs := [][2]string{
+		{testUser_O1, testUser_O2},
+		{testUser_O2, testUser_O1},
+		{testUser_O1, testUser_O3},
+		{testUser_O3, testUser_O2},
+	}
+
+	for _, pair := range pairs {
+		message := chatstore.NewMessage().
+			SetChatID(testChat_O1).
+			SetSenderID(pair[0]).
+			SetRecipientID(pair[1]).
+			SetText("Message")
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	future := time.Now().UTC().Add(time.Hour).Format(time.DateTime)
+
+	testCases := []struct {
+		name     string
+		query    chatstore.MessageQueryInterface
+		expected int
+	}{
+		{"conversation between", chatstore.MessageQuery().SetConversationBetween(testUser_O2, testUser_O1), 2},
+		{"sender id in", chatstore.MessageQuery().SetSenderIDIn([]string{testUser_O2, testUser_O3}), 2},
+		{"sender id not in", chatstore.MessageQuery().SetSenderIDNotIn([]string{testUser_O1}), 2},
+		{"recipient id in", chatstore.MessageQuery().SetRecipientIDIn([]string{testUser_O2}), 2},
+		{"updated at lte", chatstore.MessageQuery().SetUpdatedAtLte(future), 4},
+		{"updated at gte", chatstore.MessageQuery().SetUpdatedAtGte(future), 0},
+	}
+
+	for _, tc := range testCases {
+		list, err := store.MessageList(tc.query)
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		if len(list) != tc.expected {
+			t.Fatalf("%s: expected %d messages, got %d", tc.name, tc.expected, len(list))
+		}
+	}
+
+	err = chatstore.MessageQuery().SetConversationBetween(testUser_O1, "").Validate()
+	if err == nil {
+		t.Fatal("expected error for empty conversation user")
+	}
+}
+
+func TestStore_MessageCreateIdempotent(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetClientMessageID("client-1").
+		SetText("Hello")
+
+	created, isCreated, err := store.MessageCreateIdempotent(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !isCreated || created.ID() != message.ID() {
+		t.Fatal("expected the message to be created")
+	}
+
+	// The resend (a new message with the same client message ID) returns the original
+	resent := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetClientMessageID("client-1").
+		SetText("Hello")
+
+	existing, isCreated, err := store.MessageCreateIdempotent(resent)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if isCreated || existing.ID() != message.ID() {
+		t.Fatal("expected the existing message to be returned")
+	}
+
+	count, err := store.MessageCount(chatstore.MessageQuery().SetChatID(testChat_O1))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("expected 1 message, got", count)
+	}
+
+	// The same client message ID is allowed in another chat
+	other := chatstore.NewMessage().
+		SetChatID("other_chat").
+		SetSenderID(testUser_O1).
+		SetClientMessageID("client-1")
+
+	_, isCreated, err = store.MessageCreateIdempotent(other)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !isCreated {
+		t.Fatal("expected the message in another chat to be created")
+	}
+
+	// The unique constraint also guards the plain create
+	err = store.MessageCreate(chatstore.NewMessage().SetChatID(testChat_O1).SetClientMessageID("client-1"))
+	if err == nil {
+		t.Fatal("expected error for a duplicate client message ID")
+	}
+
+	// Messages without a client message ID are always created
+	for i := 0; i < 2; i++ {
+		_, isCreated, err := store.MessageCreateIdempotent(chatstore.NewMessage().SetChatID(testChat_O1))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if !isCreated {
+			t.Fatal("expected the message to be created")
+		}
+	}
+}
+
+func TestStore_MessageUpdateNotFound(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2)
+
+	message.SetText("Never stored")
+
+	err = store.MessageUpdate(message)
+	if !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_MessageUpsert(t *testing.T) {
+	store, err := initStore(":memory:")
+
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	err = store.ChatCreate(chat)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("First text")
+
+	// Inserts the message
+	err = store.MessageUpsert(message)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	inserted, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if inserted == nil {
+		t.Fatal("Message MUST be inserted")
+	}
+
+	// Updates the message with the same ID
+	replacement := chatstore.NewMessage().
+		SetID(message.ID()).
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Second text")
+
+	err = store.MessageUpsert(replacement)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	updated, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if updated.Text() != "Second text" {
+		t.Fatalf("Expected text 'Second text', got '%s'", updated.Text())
+	}
+
+	if updated.Version() != inserted.Version()+1 {
+		t.Fatalf("Expected version %d, got %d", inserted.Version()+1, updated.Version())
+	}
+
+	if updated.CreatedAt() != inserted.CreatedAt() {
+		t.Fatalf("Expected created at %s to be kept, got %s", inserted.CreatedAt(), updated.CreatedAt())
+	}
+
+	// The chat activity counts the message once
+	storedChat, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if storedChat.MessageCount() != 1 {
+		t.Fatalf("Expected message count 1, got %d", storedChat.MessageCount())
+	}
+}
@@ -0,0 +1,204 @@
+package chatstore
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	neatquery "github.com/dracory/neat/database/query"
+	neatuid "github.com/dracory/neat/support/uid"
+	"github.com/dromara/carbon/v2"
+)
+
+// == MODERATION ==============================================================
+
+// MessageModerationQueue returns the flagged messages matching the query
+// (all messages, oldest first, when nil) waiting for a reviewer to approve
+// or reject them. A copy of the query is narrowed to the flagged messages,
+// leaving the query unchanged.
+func (st *storeImplementation) MessageModerationQueue(query MessageQueryInterface) ([]MessageInterface, error) {
+	if query == nil {
+		query = MessageQuery().
+			SetOrderBy(COLUMN_CREATED_AT).
+			SetOrderDirection("asc")
+	}
+
+	if err := st.storeAuthorize(ACCESS_ACTION_MODERATE); err != nil {
+		return nil, err
+	}
+
+	return st.MessageList(query.Clone().SetModerationState(MODERATION_STATE_FLAGGED))
+}
+
+// MessageApprove approves the message on behalf of the reviewer, taking it
+// out of the review queue, or restoring it when it was rejected.
+func (st *storeImplementation) MessageApprove(messageID string, reviewerID string, note string) error {
+	return st.messageReview(messageID, reviewerID, MODERATION_ACTION_APPROVE, MODERATION_STATE_APPROVED, note)
+}
+
+// MessageReject rejects the message on behalf of the reviewer, hiding it
+// from its chat.
+func (st *storeImplementation) MessageReject(messageID string, reviewerID string, reason string) error {
+	return st.messageReview(messageID, reviewerID, MODERATION_ACTION_REJECT, MODERATION_STATE_REJECTED, reason)
+}
+
+// MessageModerationLog returns the moderation decisions taken on the
+// message, oldest first. The log is kept when the message is deleted.
+func (st *storeImplementation) MessageModerationLog(messageID string) ([]ModerationEntry, error) {
+	if messageID == "" {
+		return nil, errors.New("message ID is required")
+	}
+
+	if err := st.tenantMessageCheck(messageID); err != nil {
+		return nil, err
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_MODERATE); err != nil {
+		return nil, err
+	}
+
+	var rows []moderationRow
+	err := st.db.Query().Table(st.tableModeration).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		OrderBy(COLUMN_CREATED_AT, "asc").
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := make([]ModerationEntry, 0, len(rows))
+	for _, r := range rows {
+		entries = append(entries, r.toEntry())
+	}
+
+	return entries, nil
+}
+
+// messageReview moves the message to the moderation state decided by the
+// reviewer, and records the decision in the moderation log.
+func (st *storeImplementation) messageReview(messageID string, reviewerID string, action string, state string, reason string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if reviewerID == "" {
+		return errors.New("reviewer ID is required")
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_MODERATE); err != nil {
+		return err
+	}
+
+	// The message, the log and the activity of its chat, which a rejected
+	// message no longer counts in, are written together
+	return st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		type chatRow struct {
+			ChatID string `db:"chat_id"`
+		}
+
+		var rows []chatRow
+		err := st.tenantScope(txQuery(tx).Table(st.tableMessage)).
+			Select(COLUMN_CHAT_ID).
+			Where(COLUMN_ID+" = ?", messageID).
+			Get(&rows)
+		if err != nil {
+			return err
+		}
+
+		if len(rows) == 0 {
+			return ErrNotFound
+		}
+
+		_, err = st.tenantScope(txQuery(tx).Table(st.tableMessage)).
+			Where(COLUMN_ID+" = ?", messageID).
+			Update(map[string]any{
+				COLUMN_MODERATION_STATE: state,
+				COLUMN_UPDATED_AT:       carbon.Now(carbon.UTC).StdTime(),
+				COLUMN_VERSION:          neatquery.RawExpr(COLUMN_VERSION + " + 1"),
+			})
+		if err != nil {
+			return err
+		}
+
+		if err := st.moderationLog(tx, messageID, action, reviewerID, reason); err != nil {
+			return err
+		}
+
+		return st.chatStatsUpdate(tx, []string{rows[0].ChatID})
+	})
+}
+
+// messageModerate asks the moderator for its decision on the message,
+// redacting the message as decided. It returns an error wrapping
+// ErrMessageRejected when the message is rejected. The moderation state is
+// left to the caller, which knows the stored one.
+func (st *storeImplementation) messageModerate(message MessageInterface) (ModerationDecision, error) {
+	if st.moderator == nil {
+		return ModerationDecision{Action: MODERATION_ACTION_ALLOW}, nil
+	}
+
+	decision, err := st.moderator.Moderate(message)
+	if err != nil {
+		return decision, err
+	}
+
+	switch decision.Action {
+	case "", MODERATION_ACTION_ALLOW:
+		decision.Action = MODERATION_ACTION_ALLOW
+		return decision, nil
+	case MODERATION_ACTION_REJECT:
+		if decision.Reason == "" {
+			return decision, ErrMessageRejected
+		}
+		return decision, fmt.Errorf("%w: %s", ErrMessageRejected, decision.Reason)
+	case MODERATION_ACTION_REDACT:
+		message.SetText(decision.Text)
+	case MODERATION_ACTION_FLAG:
+	default:
+		return decision, fmt.Errorf("moderator returned an unknown action %q", decision.Action)
+	}
+
+	return decision, nil
+}
+
+// moderationLog records the moderation decision on the message.
+func (st *storeImplementation) moderationLog(tx contractsorm.Query, messageID string, action string, reviewerID string, reason string) error {
+	return txQuery(tx).Table(st.tableModeration).Create(map[string]any{
+		COLUMN_ID:          neatuid.GenerateShortID(),
+		COLUMN_MESSAGE_ID:  messageID,
+		COLUMN_ACTION:      action,
+		COLUMN_REVIEWER_ID: nullIfEmpty(reviewerID),
+		COLUMN_REASON:      nullIfEmpty(reason),
+		COLUMN_CREATED_AT:  carbon.Now(carbon.UTC).StdTime(),
+	})
+}
+
+// moderationDecisionState returns the moderation state the moderator
+// decision gives a message, empty for an allowed message.
+func moderationDecisionState(decision ModerationDecision) string {
+	switch decision.Action {
+	case MODERATION_ACTION_REDACT:
+		return MODERATION_STATE_REDACTED
+	case MODERATION_ACTION_FLAG:
+		return MODERATION_STATE_FLAGGED
+	}
+	return ""
+}
+
+// moderationStateAfter returns the moderation state of a message stored in
+// the given state, empty for a new message, once screened by the moderator.
+// A reviewer decision stays until a reviewer changes it, and an allowed
+// message keeps its state.
+func moderationStateAfter(stored string, decision ModerationDecision) string {
+	if stored == MODERATION_STATE_APPROVED || stored == MODERATION_STATE_REJECTED || !moderationLogged(decision) {
+		return stored
+	}
+	return moderationDecisionState(decision)
+}
+
+// moderationLogged returns whether the moderator decision is recorded in
+// the moderation log, which keeps the messages redacted or flagged.
+func moderationLogged(decision ModerationDecision) bool {
+	return slices.Contains([]string{MODERATION_ACTION_REDACT, MODERATION_ACTION_FLAG}, decision.Action)
+}
@@ -0,0 +1,383 @@
+package chatstore_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dracory/chatstore"
+	"github.com/dromara/carbon/v2"
+)
+
+// testModerator rejects spam, redacts swearing and flags suspicious links
+var testModerator = chatstore.ModeratorFunc(func(message chatstore.MessageInterface) (chatstore.ModerationDecision, error) {
+	switch {
+	case strings.Contains(message.Text(), "spam"):
+		return chatstore.ModerationDecision{Action: chatstore.MODERATION_ACTION_REJECT, Reason: "spam"}, nil
+	case strings.Contains(message.Text(), "darn"):
+		return chatstore.ModerationDecision{
+			Action: chatstore.MODERATION_ACTION_REDACT,
+			Reason: "swearing",
+			Text:   strings.ReplaceAll(message.Text(), "darn", "****"),
+		}, nil
+	case strings.Contains(message.Text(), "http://"):
+		return chatstore.ModerationDecision{Action: chatstore.MODERATION_ACTION_FLAG, Reason: "link"}, nil
+	}
+	return chatstore.ModerationDecision{Action: chatstore.MODERATION_ACTION_ALLOW}, nil
+})
+
+func TestStore_Moderation(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+		Moderator:          testModerator,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	rejected := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("buy spam")
+	if err := store.MessageCreate(rejected); !errors.Is(err, chatstore.ErrMessageRejected) {
+		t.Fatal("expected ErrMessageRejected, got", err)
+	}
+
+	redacted := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("oh darn")
+	if err := store.MessageCreate(redacted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.MessageFindByID(redacted.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Text() != "oh ****" || found.ModerationState() != chatstore.MODERATION_STATE_REDACTED {
+		t.Fatalf("expected the redacted text, got %q (%s)", found.Text(), found.ModerationState())
+	}
+
+	flagged := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O2).SetText("see http://example.com")
+	if err := store.MessageCreate(flagged); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	queue, err := store.MessageModerationQueue(nil)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(queue) != 1 || queue[0].ID() != flagged.ID() {
+		t.Fatal("expected the flagged message in the review queue, got", len(queue))
+	}
+
+	// The query of the caller is left unchanged
+	query := chatstore.MessageQuery().SetChatID(chat.ID())
+	if _, err := store.MessageModerationQueue(query); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if query.IsModerationStateSet() {
+		t.Fatal("expected the query not to be narrowed to the flagged messages")
+	}
+
+	// A rejected message is hidden from its chat
+	if err := store.MessageReject(flagged.ID(), testUser_O1, "phishing"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	messages, err := store.MessageList(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(messages) != 1 || messages[0].ID() != redacted.ID() {
+		t.Fatal("expected the rejected message to be hidden, got", len(messages))
+	}
+
+	chat, err = store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if chat.MessageCount() != 1 {
+		t.Fatal("expected the rejected message not to be counted, got", chat.MessageCount())
+	}
+
+	rejectedList, err := store.MessageList(chatstore.MessageQuery().SetModerationState(chatstore.MODERATION_STATE_REJECTED))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(rejectedList) != 1 {
+		t.Fatal("expected the rejected message when asked for, got", len(rejectedList))
+	}
+
+	// Approving restores it
+	if err := store.MessageApprove(flagged.ID(), testUser_O2, "false positive"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	count, err := store.MessageCount(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatal("expected the approved message to be visible, got", count)
+	}
+
+	entries, err := store.MessageModerationLog(flagged.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	actions := []string{}
+	for _, entry := range entries {
+		actions = append(actions, entry.Action+":"+entry.ReviewerID+":"+entry.Reason)
+	}
+
+	expected := []string{
+		chatstore.MODERATION_ACTION_FLAG + "::link",
+		chatstore.MODERATION_ACTION_REJECT + ":" + testUser_O1 + ":phishing",
+		chatstore.MODERATION_ACTION_APPROVE + ":" + testUser_O2 + ":false positive",
+	}
+
+	if strings.Join(actions, ",") != strings.Join(expected, ",") {
+		t.Fatal("unexpected moderation log:", actions)
+	}
+
+	// A changed text is screened again
+	redacted.SetText("now spam")
+	if err := store.MessageUpdate(redacted); !errors.Is(err, chatstore.ErrMessageRejected) {
+		t.Fatal("expected ErrMessageRejected, got", err)
+	}
+
+	if err := store.MessageApprove("missing", testUser_O1, ""); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("expected ErrNotFound, got", err)
+	}
+}
+
+func TestStore_MessagePurgeExpiredRejected(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+		Moderator:          testModerator,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	flagged := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O2).
+		SetText("see http://example.com").
+		SetExpiresAt(carbon.Now(carbon.UTC).AddHour().ToDateTimeString())
+	if err := store.MessageCreate(flagged); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageReject(flagged.ID(), testUser_O1, "phishing"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	count, err := store.MessageCount(chatstore.MessageQuery().SetChatID(chat.ID()).SetWithRejected(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatal("expected the rejected message when asked for, got", count)
+	}
+
+	// The rejected message is purged once expired
+	purged, err := store.MessagePurgeExpired(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if purged != 1 {
+		t.Fatal("expected the rejected message to be purged, got", purged)
+	}
+
+	count, err = store.MessageCount(chatstore.MessageQuery().
+		SetChatID(chat.ID()).
+		SetWithRejected(true).
+		SetWithExpired(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 0 {
+		t.Fatal("expected no messages after the purge, got", count)
+	}
+}
+
+func TestStore_MessageInsertIgnoresCallerStates(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+		Moderator:          testModerator,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A message cannot approve itself, nor claim to be read
+	created := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("see http://example.com").
+		SetModerationState(chatstore.MODERATION_STATE_APPROVED).
+		SetDeliveryStatus(chatstore.DELIVERY_STATUS_READ)
+	if err := store.MessageCreate(created); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	upserted := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Hello").
+		SetModerationState(chatstore.MODERATION_STATE_REJECTED).
+		SetDeliveryStatus(chatstore.DELIVERY_STATUS_READ)
+	if err := store.MessageUpsert(upserted); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.MessageFindByID(created.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.ModerationState() != chatstore.MODERATION_STATE_FLAGGED || found.DeliveryStatus() != "" {
+		t.Fatalf("expected the created message flagged and not delivered, got %q (%q)", found.ModerationState(), found.DeliveryStatus())
+	}
+
+	found, err = store.MessageFindByID(upserted.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("expected the upserted message not to be rejected")
+	}
+
+	if found.ModerationState() != "" || found.DeliveryStatus() != "" {
+		t.Fatalf("expected the upserted message allowed and not delivered, got %q (%q)", found.ModerationState(), found.DeliveryStatus())
+	}
+}
+
+func TestStore_MessageUpsertKeepsReviewerDecision(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+		Moderator:          testModerator,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("see http://example.com")
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageReject(message.ID(), testUser_O2, "phishing"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A fresh copy of the message does not undo the rejection
+	fresh := chatstore.NewMessage().
+		SetID(message.ID()).
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("see http://example.org")
+	if err := store.MessageUpsert(fresh); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("expected the rejected message to stay hidden")
+	}
+
+	rejected, err := store.MessageList(chatstore.MessageQuery().SetID(message.ID()).SetWithRejected(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(rejected) != 1 || rejected[0].ModerationState() != chatstore.MODERATION_STATE_REJECTED {
+		t.Fatal("expected the message to stay rejected")
+	}
+
+	// Nor does a message approve itself when flagged again
+	flagged := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("see http://example.com")
+	if err := store.MessageCreate(flagged); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	flagged.SetModerationState(chatstore.MODERATION_STATE_APPROVED).SetText("see http://example.org")
+	if err := store.MessageUpsert(flagged); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.MessageFindByID(flagged.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.ModerationState() != chatstore.MODERATION_STATE_FLAGGED {
+		t.Fatal("expected the message to stay flagged")
+	}
+}
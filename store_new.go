@@ -4,8 +4,11 @@ import (
 	"context"
 	"database/sql"
 	"errors"
+	"fmt"
 	"log/slog"
 	"os"
+	"regexp"
+	"slices"
 
 	"github.com/dracory/neat"
 )
@@ -18,8 +21,66 @@ type NewStoreOptions struct {
 	AutomigrateEnabled bool
 	DebugEnabled       bool
 	Logger             *slog.Logger
+
+	// ChatIndexedMetaKeys lists the hot chat meta keys which get an indexed
+	// generated column, speeding up the meta filters of chat queries
+	ChatIndexedMetaKeys []string
+	// MessageIndexedMetaKeys lists the hot message meta keys which get an indexed
+	// generated column, speeding up the meta filters of message queries
+	MessageIndexedMetaKeys []string
+
+	// TableDeliveryName is the message delivery table name,
+	// the message table name suffixed with _delivery when empty
+	TableDeliveryName string
+	// TableStarName is the message star table name,
+	// the message table name suffixed with _star when empty
+	TableStarName string
+	// TableMentionName is the message mention table name,
+	// the message table name suffixed with _mention when empty
+	TableMentionName string
+	// TableChatUserSettingsName is the chat user settings table name,
+	// the chat table name suffixed with _user_settings when empty
+	TableChatUserSettingsName string
+	// TableModerationName is the message moderation log table name,
+	// the message table name suffixed with _moderation when empty
+	TableModerationName string
+
+	// MentionParser finds the users mentioned in the message texts,
+	// the @ mention parser of NewMentionParser when nil
+	MentionParser MentionParser
+
+	// ChatStatusMachine defines the allowed chat statuses and transitions,
+	// the machine of NewChatStatusMachine when nil
+	ChatStatusMachine *StatusMachine
+	// MessageStatusMachine defines the allowed message statuses and transitions,
+	// the machine of NewMessageStatusMachine when nil
+	MessageStatusMachine *StatusMachine
+
+	// ChatValidators run after the chats validate themselves on create,
+	// update and upsert, their field errors returned together
+	ChatValidators []ChatValidator
+	// MessageValidators run after the messages validate themselves on create,
+	// update and upsert, their field errors returned together
+	MessageValidators []MessageValidator
+
+	// Moderator screens the message texts on create, update and upsert,
+	// no moderation when nil
+	Moderator Moderator
+
+	// Encryptor encrypts the text, memo and metas of the messages at rest,
+	// no encryption when nil. The message metas can then not be filtered
+	// by nor indexed
+	Encryptor Encryptor
+
+	// Policy decides what the user views of the store, see AsUser, may do,
+	// the policy of NewDefaultPolicy when nil
+	Policy Policy
 }
 
+// indexedMetaKeyRegexp matches the meta keys allowed to be indexed,
+// as they become part of a column name.
+var indexedMetaKeyRegexp = regexp.MustCompile(`^[A-Za-z0-9_]+$`)
+
 // NewStore creates a new chat store.
 func NewStore(opts NewStoreOptions) (StoreInterface, error) {
 	if opts.TableChatName == "" {
@@ -30,10 +91,56 @@ func NewStore(opts NewStoreOptions) (StoreInterface, error) {
 		return nil, errors.New("chat store: TableMessageName is required")
 	}
 
+	if opts.TableDeliveryName == "" {
+		opts.TableDeliveryName = opts.TableMessageName + "_delivery"
+	}
+
+	if opts.TableStarName == "" {
+		opts.TableStarName = opts.TableMessageName + "_star"
+	}
+
+	if opts.TableMentionName == "" {
+		opts.TableMentionName = opts.TableMessageName + "_mention"
+	}
+
+	if opts.TableChatUserSettingsName == "" {
+		opts.TableChatUserSettingsName = opts.TableChatName + "_user_settings"
+	}
+
+	if opts.TableModerationName == "" {
+		opts.TableModerationName = opts.TableMessageName + "_moderation"
+	}
+
+	if opts.MentionParser == nil {
+		opts.MentionParser = NewMentionParser()
+	}
+
+	if opts.ChatStatusMachine == nil {
+		opts.ChatStatusMachine = NewChatStatusMachine()
+	}
+
+	if opts.MessageStatusMachine == nil {
+		opts.MessageStatusMachine = NewMessageStatusMachine()
+	}
+
+	if opts.Policy == nil {
+		opts.Policy = NewDefaultPolicy()
+	}
+
 	if opts.DB == nil {
 		return nil, errors.New("chat store: DB is required")
 	}
 
+	for _, key := range slices.Concat(opts.ChatIndexedMetaKeys, opts.MessageIndexedMetaKeys) {
+		if !indexedMetaKeyRegexp.MatchString(key) {
+			return nil, fmt.Errorf("chat store: indexed meta key %q may only contain letters, digits and underscores", key)
+		}
+	}
+
+	if opts.Encryptor != nil && len(opts.MessageIndexedMetaKeys) > 0 {
+		return nil, errors.New("chat store: MessageIndexedMetaKeys cannot be used with an Encryptor, as the metas are encrypted")
+	}
+
 	neatDB, err := neat.NewFromSQLDB(opts.DB)
 	if err != nil {
 		return nil, err
@@ -44,12 +151,32 @@ func NewStore(opts NewStoreOptions) (StoreInterface, error) {
 	}
 
 	store := &storeImplementation{
-		tableChat:          opts.TableChatName,
-		tableMessage:       opts.TableMessageName,
-		db:                 neatDB,
-		automigrateEnabled: opts.AutomigrateEnabled,
-		debugEnabled:       opts.DebugEnabled,
-		logger:             opts.Logger,
+		tableChat:             opts.TableChatName,
+		tableMessage:          opts.TableMessageName,
+		tableDelivery:         opts.TableDeliveryName,
+		tableStar:             opts.TableStarName,
+		tableMention:          opts.TableMentionName,
+		tableChatUserSettings: opts.TableChatUserSettingsName,
+		tableModeration:       opts.TableModerationName,
+		mentionParser:         opts.MentionParser,
+		db:                    neatDB,
+		automigrateEnabled:    opts.AutomigrateEnabled,
+		debugEnabled:          opts.DebugEnabled,
+		logger:                opts.Logger,
+
+		chatIndexedMetaKeys:    opts.ChatIndexedMetaKeys,
+		messageIndexedMetaKeys: opts.MessageIndexedMetaKeys,
+
+		chatStatusMachine:    opts.ChatStatusMachine,
+		messageStatusMachine: opts.MessageStatusMachine,
+
+		chatValidators:    opts.ChatValidators,
+		messageValidators: opts.MessageValidators,
+
+		moderator: opts.Moderator,
+		encryptor: opts.Encryptor,
+
+		policy: opts.Policy,
 	}
 
 	if store.automigrateEnabled {
@@ -0,0 +1,201 @@
+package chatstore
+
+import (
+	"errors"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// == PINS AND STARS ==========================================================
+
+// MessagePin pins the message to its chat on behalf of the user.
+// Pinning a pinned message keeps its original pin.
+func (st *storeImplementation) MessagePin(messageID string, userID string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	if err := st.userAuthorize(userID); err != nil {
+		return err
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_PIN); err != nil {
+		return err
+	}
+
+	_, err := st.tenantScope(st.db.Query().Table(st.tableMessage)).
+		Where(COLUMN_ID+" = ?", messageID).
+		WhereNull(COLUMN_PINNED_AT).
+		Update(map[string]any{
+			COLUMN_PINNED_AT: carbon.Now(carbon.UTC).StdTime(),
+			COLUMN_PINNED_BY: userID,
+		})
+	if err != nil {
+		return err
+	}
+
+	return st.messageExists(messageID)
+}
+
+// MessageUnpin unpins the message from its chat.
+func (st *storeImplementation) MessageUnpin(messageID string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_PIN); err != nil {
+		return err
+	}
+
+	_, err := st.tenantScope(st.db.Query().Table(st.tableMessage)).
+		Where(COLUMN_ID+" = ?", messageID).
+		Update(map[string]any{
+			COLUMN_PINNED_AT: nil,
+			COLUMN_PINNED_BY: nil,
+		})
+	if err != nil {
+		return err
+	}
+
+	return st.messageExists(messageID)
+}
+
+// MessageListPinned returns the messages pinned to the chat, most recently
+// pinned first.
+func (st *storeImplementation) MessageListPinned(chatID string) ([]MessageInterface, error) {
+	if chatID == "" {
+		return nil, errors.New("chat ID is required")
+	}
+
+	return st.MessageList(MessageQuery().
+		SetChatID(chatID).
+		SetPinned(true).
+		SetOrderBy(COLUMN_PINNED_AT).
+		SetOrderDirection("desc"))
+}
+
+// MessageStar stars the message for the user. Starring a starred message
+// keeps its original star.
+func (st *storeImplementation) MessageStar(messageID string, userID string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	if err := st.messageExists(messageID); err != nil {
+		return err
+	}
+
+	if err := st.userAuthorize(userID); err != nil {
+		return err
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_READ); err != nil {
+		return err
+	}
+
+	var count int64
+	err := st.db.Query().Table(st.tableStar).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		Where(COLUMN_USER_ID+" = ?", userID).
+		Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return nil
+	}
+
+	return st.db.Query().Table(st.tableStar).Create(map[string]any{
+		COLUMN_MESSAGE_ID: messageID,
+		COLUMN_USER_ID:    userID,
+		COLUMN_STARRED_AT: carbon.Now(carbon.UTC).StdTime(),
+	})
+}
+
+// MessageUnstar removes the star of the user from the message.
+func (st *storeImplementation) MessageUnstar(messageID string, userID string) error {
+	if messageID == "" {
+		return errors.New("message ID is required")
+	}
+
+	if userID == "" {
+		return errors.New("user ID is required")
+	}
+
+	if err := st.tenantMessageCheck(messageID); err != nil {
+		return err
+	}
+
+	if err := st.userAuthorize(userID); err != nil {
+		return err
+	}
+
+	if err := st.messageAuthorize(messageID, ACCESS_ACTION_READ); err != nil {
+		return err
+	}
+
+	_, err := st.db.Query().Table(st.tableStar).
+		Where(COLUMN_MESSAGE_ID+" = ?", messageID).
+		Where(COLUMN_USER_ID+" = ?", userID).
+		Delete()
+	return err
+}
+
+// MessageListStarred returns the messages starred by the user, most recently
+// starred first.
+func (st *storeImplementation) MessageListStarred(userID string) ([]MessageInterface, error) {
+	if userID == "" {
+		return nil, errors.New("user ID is required")
+	}
+
+	if err := st.userAuthorize(userID); err != nil {
+		return nil, err
+	}
+
+	var rows []messageRow
+	err := st.buildMessageQueryFilters(MessageQuery()).
+		Table(st.tableMessage).
+		Select(st.tableMessage+".*").
+		Join(st.tableStar+" starred ON starred."+COLUMN_MESSAGE_ID+" = "+st.tableMessage+"."+COLUMN_ID+
+			" AND starred."+COLUMN_USER_ID+" = ?", userID).
+		OrderBy(COLUMN_STARRED_AT, "desc").
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	messages := make([]MessageInterface, 0, len(rows))
+	for _, r := range rows {
+		message, err := st.messageFromRow(r)
+		if err != nil {
+			return nil, err
+		}
+		messages = append(messages, message)
+	}
+
+	return messages, nil
+}
+
+// messageExists returns ErrNotFound when the message does not exist.
+func (st *storeImplementation) messageExists(messageID string) error {
+	var count int64
+	err := st.tenantScope(st.db.Query().Table(st.tableMessage)).Where(COLUMN_ID+" = ?", messageID).Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_MessagePin(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat_table",
+		TableMessageName:   "message_table",
+		AutomigrateEnabled: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	first := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("First")
+	second := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("Second")
+	third := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O2).SetText("Third")
+
+	for _, message := range []chatstore.MessageInterface{first, second, third} {
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if err := store.MessagePin(second.ID(), testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessagePin(first.ID(), testUser_O2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Pins made within the same second are ordered by backdating one
+	_, err = db.Exec("UPDATE message_table SET pinned_at = ? WHERE id = ?", "2025-03-03 10:00:00", second.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	pinned, err := store.MessageListPinned(testChat_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(pinned) != 2 {
+		t.Fatalf("Expected 2 pinned messages, got %d", len(pinned))
+	}
+
+	if pinned[0].ID() != first.ID() || pinned[1].ID() != second.ID() {
+		t.Fatalf("Expected the most recently pinned message first, got %s and %s", pinned[0].Text(), pinned[1].Text())
+	}
+
+	if !pinned[0].IsPinned() || pinned[0].PinnedBy() != testUser_O2 || pinned[0].PinnedAt() == "" {
+		t.Fatalf("Unexpected pin: pinned by %s at %s", pinned[0].PinnedBy(), pinned[0].PinnedAt())
+	}
+
+	if err := store.MessageUnpin(second.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	unpinned, err := store.MessageList(chatstore.MessageQuery().SetChatID(testChat_O1).SetPinned(false))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(unpinned) != 2 {
+		t.Fatalf("Expected 2 unpinned messages, got %d", len(unpinned))
+	}
+
+	if err := store.MessagePin("missing", testUser_O1); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_MessageStar(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat_table",
+		TableMessageName:   "message_table",
+		AutomigrateEnabled: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	first := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("First")
+	second := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O2).SetText("Second")
+
+	for _, message := range []chatstore.MessageInterface{first, second} {
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if err := store.MessageStar(first.ID(), testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageStar(second.ID(), testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Starring again keeps the original star
+	if err := store.MessageStar(second.ID(), testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.MessageStar(second.ID(), testUser_O2); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	_, err = db.Exec("UPDATE message_table_star SET starred_at = ? WHERE message_id = ?", "2025-03-03 10:00:00", first.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	starred, err := store.MessageListStarred(testUser_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(starred) != 2 {
+		t.Fatalf("Expected 2 starred messages, got %d", len(starred))
+	}
+
+	if starred[0].ID() != second.ID() || starred[1].ID() != first.ID() {
+		t.Fatalf("Expected the most recently starred message first, got %s and %s", starred[0].Text(), starred[1].Text())
+	}
+
+	if err := store.MessageUnstar(second.ID(), testUser_O1); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	count, err := store.MessageCount(chatstore.MessageQuery().SetStarredByUserID(testUser_O1))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 message starred by the first user, got %d", count)
+	}
+
+	count, err = store.MessageCount(chatstore.MessageQuery().SetStarredByUserID(testUser_O2))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 1 {
+		t.Fatalf("Expected 1 message starred by the second user, got %d", count)
+	}
+
+	if err := store.MessageStar("missing", testUser_O1); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
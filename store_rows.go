@@ -0,0 +1,186 @@
+package chatstore
+
+import (
+	"time"
+
+	"github.com/dromara/carbon/v2"
+)
+
+// == ROWS ====================================================================
+
+// chatRow is the database row of a chat, as scanned by the list queries.
+type chatRow struct {
+	ID            string    `db:"id"`
+	Status        string    `db:"status"`
+	OwnerID       string    `db:"owner_id"`
+	Title         string    `db:"title"`
+	Memo          string    `db:"memo"`
+	DirectKey     string    `db:"direct_key"`
+	Metas         string    `db:"metas"`
+	Version       int64     `db:"version"`
+	LastMessageAt time.Time `db:"last_message_at"`
+	MessageCount  int64     `db:"message_count"`
+	TenantID      string    `db:"tenant_id"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+	SoftDeletedAt time.Time `db:"soft_deleted_at"`
+}
+
+// toChat hydrates a clean (not dirty) chat from the row.
+func (r chatRow) toChat() ChatInterface {
+	chat := &chatImplementation{}
+	chat.SetID(r.ID)
+	chat.StatusField = r.Status
+	chat.OwnerIDField = r.OwnerID
+	chat.TitleField = r.Title
+	chat.MemoField = r.Memo
+	chat.DirectKeyField = r.DirectKey
+	chat.MetasField = r.Metas
+	chat.VersionField = r.Version
+	chat.LastMessageAtField = r.LastMessageAt
+	chat.MessageCountField = r.MessageCount
+	chat.TenantIDField = r.TenantID
+	chat.CreatedAtField.CreatedAt = r.CreatedAt
+	chat.UpdatedAtField.UpdatedAt = r.UpdatedAt
+	chat.SoftDeletesMaxDate.SoftDeletedAt = r.SoftDeletedAt
+	chat.MarkAsNotDirty()
+	return chat
+}
+
+// messageRow is the database row of a message, as scanned by the list queries.
+type messageRow struct {
+	ID              string    `db:"id"`
+	ChatID          string    `db:"chat_id"`
+	Status          string    `db:"status"`
+	SenderID        string    `db:"sender_id"`
+	RecipientID     string    `db:"recipient_id"`
+	Text            string    `db:"text"`
+	Memo            string    `db:"memo"`
+	ClientMessageID string    `db:"client_message_id"`
+	ScheduledAt     time.Time `db:"scheduled_at"`
+	ExpiresAt       time.Time `db:"expires_at"`
+	DeliveryStatus  string    `db:"delivery_status"`
+	PinnedAt        time.Time `db:"pinned_at"`
+	PinnedBy        string    `db:"pinned_by"`
+	ModerationState string    `db:"moderation_state"`
+	TenantID        string    `db:"tenant_id"`
+	Metas           string    `db:"metas"`
+	Version         int64     `db:"version"`
+	CreatedAt       time.Time `db:"created_at"`
+	UpdatedAt       time.Time `db:"updated_at"`
+	SoftDeletedAt   time.Time `db:"soft_deleted_at"`
+}
+
+// toMessage hydrates a clean (not dirty) message from the row.
+func (r messageRow) toMessage() MessageInterface {
+	msg := &messageImplementation{}
+	msg.SetID(r.ID)
+	msg.ChatIDField = r.ChatID
+	msg.StatusField = r.Status
+	msg.SenderIDField = r.SenderID
+	msg.RecipientIDField = r.RecipientID
+	msg.TextField = r.Text
+	msg.MemoField = r.Memo
+	msg.ClientMessageIDField = r.ClientMessageID
+	msg.ScheduledAtField = r.ScheduledAt
+	msg.ExpiresAtField = r.ExpiresAt
+	msg.DeliveryStatusField = r.DeliveryStatus
+	msg.PinnedAtField = r.PinnedAt
+	msg.PinnedByField = r.PinnedBy
+	msg.ModerationStateField = r.ModerationState
+	msg.TenantIDField = r.TenantID
+	msg.MetasField = r.Metas
+	msg.VersionField = r.Version
+	msg.CreatedAtField.CreatedAt = r.CreatedAt
+	msg.UpdatedAtField.UpdatedAt = r.UpdatedAt
+	msg.SoftDeletesMaxDate.SoftDeletedAt = r.SoftDeletedAt
+	msg.MarkAsNotDirty()
+	return msg
+}
+
+// chatInsertRow returns the column values of the chat for an insert.
+func chatInsertRow(chat ChatInterface) map[string]any {
+	return map[string]any{
+		COLUMN_ID:              chat.ID(),
+		COLUMN_STATUS:          chat.Status(),
+		COLUMN_OWNER_ID:        chat.OwnerID(),
+		COLUMN_TITLE:           chat.Title(),
+		COLUMN_MEMO:            chat.Memo(),
+		COLUMN_DIRECT_KEY:      nullIfEmpty(chat.DirectKey()),
+		COLUMN_TENANT_ID:       nullIfEmpty(chat.TenantID()),
+		COLUMN_METAS:           chat.(*chatImplementation).MetasField,
+		COLUMN_VERSION:         chat.Version(),
+		COLUMN_CREATED_AT:      chat.CreatedAtCarbon().StdTime(),
+		COLUMN_UPDATED_AT:      chat.UpdatedAtCarbon().StdTime(),
+		COLUMN_SOFT_DELETED_AT: chat.SoftDeletedAtCarbon().StdTime(),
+	}
+}
+
+// messageInsertRow returns the column values of the message for an insert.
+func messageInsertRow(message MessageInterface) map[string]any {
+	return map[string]any{
+		COLUMN_ID:                message.ID(),
+		COLUMN_CHAT_ID:           message.ChatID(),
+		COLUMN_STATUS:            message.Status(),
+		COLUMN_SENDER_ID:         message.SenderID(),
+		COLUMN_RECIPIENT_ID:      message.RecipientID(),
+		COLUMN_TEXT:              message.Text(),
+		COLUMN_MEMO:              message.Memo(),
+		COLUMN_CLIENT_MESSAGE_ID: nullIfEmpty(message.ClientMessageID()),
+		COLUMN_SCHEDULED_AT:      nullIfEmptyTime(message.ScheduledAt()),
+		COLUMN_EXPIRES_AT:        nullIfEmptyTime(message.ExpiresAt()),
+		COLUMN_DELIVERY_STATUS:   nullIfEmpty(message.DeliveryStatus()),
+		COLUMN_MODERATION_STATE:  nullIfEmpty(message.ModerationState()),
+		COLUMN_TENANT_ID:         nullIfEmpty(message.TenantID()),
+		COLUMN_METAS:             message.(*messageImplementation).MetasField,
+		COLUMN_VERSION:           message.Version(),
+		COLUMN_CREATED_AT:        message.CreatedAtCarbon().StdTime(),
+		COLUMN_UPDATED_AT:        message.UpdatedAtCarbon().StdTime(),
+		COLUMN_SOFT_DELETED_AT:   message.SoftDeletedAtCarbon().StdTime(),
+	}
+}
+
+// deliveryRow is the database row of a message delivery.
+type deliveryRow struct {
+	MessageID     string    `db:"message_id"`
+	RecipientID   string    `db:"recipient_id"`
+	Status        string    `db:"status"`
+	Attempts      int64     `db:"attempts"`
+	FailureReason string    `db:"failure_reason"`
+	CreatedAt     time.Time `db:"created_at"`
+	UpdatedAt     time.Time `db:"updated_at"`
+}
+
+// toDelivery converts the row to a message delivery.
+func (r deliveryRow) toDelivery() MessageDelivery {
+	return MessageDelivery{
+		MessageID:     r.MessageID,
+		RecipientID:   r.RecipientID,
+		Status:        r.Status,
+		Attempts:      r.Attempts,
+		FailureReason: r.FailureReason,
+		CreatedAt:     carbon.CreateFromStdTime(r.CreatedAt).ToDateTimeString(),
+		UpdatedAt:     carbon.CreateFromStdTime(r.UpdatedAt).ToDateTimeString(),
+	}
+}
+
+// moderationRow is the database row of a moderation log entry.
+type moderationRow struct {
+	ID         string    `db:"id"`
+	MessageID  string    `db:"message_id"`
+	Action     string    `db:"action"`
+	ReviewerID string    `db:"reviewer_id"`
+	Reason     string    `db:"reason"`
+	CreatedAt  time.Time `db:"created_at"`
+}
+
+// toEntry converts the row to a moderation log entry.
+func (r moderationRow) toEntry() ModerationEntry {
+	return ModerationEntry{
+		MessageID:  r.MessageID,
+		Action:     r.Action,
+		ReviewerID: r.ReviewerID,
+		Reason:     r.Reason,
+		CreatedAt:  carbon.CreateFromStdTime(r.CreatedAt).ToDateTimeString(),
+	}
+}
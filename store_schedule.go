@@ -0,0 +1,188 @@
+package chatstore
+
+import (
+	"slices"
+	"time"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	neatquery "github.com/dracory/neat/database/query"
+)
+
+// == SCHEDULED AND EXPIRING MESSAGES =========================================
+
+// MessagePublishDue publishes the scheduled messages due at the given time,
+// making them active, visible in their chats and sent to their recipients.
+// It returns the published messages; a message published concurrently by
+// another caller is returned by only one of them.
+func (st *storeImplementation) MessagePublishDue(now time.Time) ([]MessageInterface, error) {
+	if err := st.storeAuthorize(ACCESS_ACTION_ADMINISTER); err != nil {
+		return nil, err
+	}
+
+	var rows []messageRow
+	err := st.buildMessageQueryFilters(MessageQuery().SetStatus(MESSAGE_STATUS_SCHEDULED)).
+		Table(st.tableMessage).
+		Select("*").
+		Where(COLUMN_SCHEDULED_AT+" <= ?", st.sqlValue(now.UTC())).
+		OrderBy(COLUMN_SCHEDULED_AT, "asc").
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(rows) == 0 {
+		return []MessageInterface{}, nil
+	}
+
+	published := make([]MessageInterface, 0, len(rows))
+
+	err = st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		chatIDs := []string{}
+
+		for _, r := range rows {
+			// The status precondition skips a message already published by someone else
+			result, err := txQuery(tx).Table(st.tableMessage).
+				Where(COLUMN_ID+" = ?", r.ID).
+				Where(COLUMN_STATUS+" = ?", MESSAGE_STATUS_SCHEDULED).
+				Update(map[string]any{
+					COLUMN_STATUS:     MESSAGE_STATUS_ACTIVE,
+					COLUMN_UPDATED_AT: now,
+					COLUMN_VERSION:    neatquery.RawExpr(COLUMN_VERSION + " + 1"),
+				})
+			if err != nil {
+				return err
+			}
+
+			if result.RowsAffected == 0 {
+				continue
+			}
+
+			// Once published the message is sent to its recipient
+			if r.RecipientID != "" {
+				if err := st.deliveryStatusSet(tx, r.ID, r.RecipientID, DELIVERY_STATUS_SENT, ""); err != nil {
+					return err
+				}
+
+				if err := st.messageDeliveryStatusUpdate(tx, r.ID); err != nil {
+					return err
+				}
+
+				r.DeliveryStatus = DELIVERY_STATUS_SENT
+			}
+
+			r.Status = MESSAGE_STATUS_ACTIVE
+			r.UpdatedAt = now
+			r.Version++
+			message, err := st.messageFromRow(r)
+			if err != nil {
+				return err
+			}
+			published = append(published, message)
+
+			if !slices.Contains(chatIDs, r.ChatID) {
+				chatIDs = append(chatIDs, r.ChatID)
+			}
+		}
+
+		if len(chatIDs) == 0 {
+			return nil
+		}
+
+		return st.chatStatsUpdate(tx, chatIDs)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if st.debugEnabled {
+		st.logger.Debug("Messages published", "count", len(published))
+	}
+
+	return published, nil
+}
+
+// MessagePurgeExpired permanently deletes the messages (including the soft
+// deleted and the rejected ones) which expired at or before the given time,
+// and returns the number of messages deleted.
+func (st *storeImplementation) MessagePurgeExpired(now time.Time) (int64, error) {
+	if err := st.storeAuthorize(ACCESS_ACTION_ADMINISTER); err != nil {
+		return 0, err
+	}
+
+	type expiredRow struct {
+		ID     string `db:"id"`
+		ChatID string `db:"chat_id"`
+	}
+
+	var rows []expiredRow
+	err := st.buildMessageQueryFilters(MessageQuery().
+		SetWithScheduled(true).
+		SetWithExpired(true).
+		SetWithRejected(true).
+		SetWithSoftDeleted(true)).
+		Table(st.tableMessage).
+		Select(COLUMN_ID+", "+COLUMN_CHAT_ID).
+		Where(COLUMN_EXPIRES_AT+" <= ?", st.sqlValue(now.UTC())).
+		Get(&rows)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, 0, len(rows))
+	chatIDs := []string{}
+	for _, r := range rows {
+		ids = append(ids, r.ID)
+		if !slices.Contains(chatIDs, r.ChatID) {
+			chatIDs = append(chatIDs, r.ChatID)
+		}
+	}
+
+	var deleted int64
+
+	err = st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		result, err := txQuery(tx).Table(st.tableMessage).
+			Where(COLUMN_ID+" IN ?", ids).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		deleted = result.RowsAffected
+
+		_, err = txQuery(tx).Table(st.tableDelivery).
+			Where(COLUMN_MESSAGE_ID+" IN ?", ids).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		_, err = txQuery(tx).Table(st.tableStar).
+			Where(COLUMN_MESSAGE_ID+" IN ?", ids).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		_, err = txQuery(tx).Table(st.tableMention).
+			Where(COLUMN_MESSAGE_ID+" IN ?", ids).
+			Delete()
+		if err != nil {
+			return err
+		}
+
+		return st.chatStatsUpdate(tx, chatIDs)
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	if st.debugEnabled {
+		st.logger.Debug("Expired messages purged", "count", deleted)
+	}
+
+	return deleted, nil
+}
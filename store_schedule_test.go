@@ -0,0 +1,382 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dracory/chatstore"
+	"github.com/dromara/carbon/v2"
+)
+
+func TestStore_MessageScheduled(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	scheduledAt := carbon.Now(carbon.UTC).AddHour().ToDateTimeString()
+
+	message := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetRecipientID(testUser_O2).
+		SetText("Good morning").
+		SetScheduledAt(scheduledAt)
+
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if message.Status() != chatstore.MESSAGE_STATUS_SCHEDULED {
+		t.Fatalf("Expected status %s, got %s", chatstore.MESSAGE_STATUS_SCHEDULED, message.Status())
+	}
+
+	if message.CreatedAt() != scheduledAt {
+		t.Fatalf("Expected created at %s, got %s", scheduledAt, message.CreatedAt())
+	}
+
+	// Hidden until published
+	list, err := store.MessageList(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 0 {
+		t.Fatalf("Expected no messages, got %d", len(list))
+	}
+
+	list, err = store.MessageList(chatstore.MessageQuery().SetChatID(chat.ID()).SetWithScheduled(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 scheduled message, got %d", len(list))
+	}
+
+	if list[0].ScheduledAt() != scheduledAt {
+		t.Fatalf("Expected scheduled at %s, got %s", scheduledAt, list[0].ScheduledAt())
+	}
+
+	storedChat, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if storedChat.MessageCount() != 0 {
+		t.Fatalf("Expected message count 0, got %d", storedChat.MessageCount())
+	}
+
+	// Not yet due
+	published, err := store.MessagePublishDue(time.Now())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(published) != 0 {
+		t.Fatalf("Expected no published messages, got %d", len(published))
+	}
+
+	// Due
+	published, err = store.MessagePublishDue(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(published) != 1 {
+		t.Fatalf("Expected 1 published message, got %d", len(published))
+	}
+
+	if published[0].ID() != message.ID() {
+		t.Fatalf("Expected published message %s, got %s", message.ID(), published[0].ID())
+	}
+
+	if published[0].Status() != chatstore.MESSAGE_STATUS_ACTIVE {
+		t.Fatalf("Expected status %s, got %s", chatstore.MESSAGE_STATUS_ACTIVE, published[0].Status())
+	}
+
+	list, err = store.MessageList(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(list) != 1 {
+		t.Fatalf("Expected 1 message, got %d", len(list))
+	}
+
+	storedChat, err = store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if storedChat.MessageCount() != 1 {
+		t.Fatalf("Expected message count 1, got %d", storedChat.MessageCount())
+	}
+
+	if storedChat.LastMessageAt() != scheduledAt {
+		t.Fatalf("Expected last message at %s, got %s", scheduledAt, storedChat.LastMessageAt())
+	}
+
+	// Published only once
+	published, err = store.MessagePublishDue(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(published) != 0 {
+		t.Fatalf("Expected no published messages, got %d", len(published))
+	}
+}
+
+func TestStore_MessageScheduledWithoutTime(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Without a scheduled time the message would never be published
+	message := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Never").
+		SetStatus(chatstore.MESSAGE_STATUS_SCHEDULED)
+
+	if err := store.MessageCreate(message); !errors.Is(err, chatstore.ErrValidation) {
+		t.Fatal("expected ErrValidation, got", err)
+	}
+}
+
+func TestStore_MessageExpiring(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expiring := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Disappearing").
+		SetExpiresAt(carbon.Now(carbon.UTC).AddHour().ToDateTimeString())
+
+	expired := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Gone").
+		SetExpiresAt(carbon.Now(carbon.UTC).SubHour().ToDateTimeString())
+
+	kept := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Kept")
+
+	for _, message := range []chatstore.MessageInterface{expiring, expired, kept} {
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	if !expired.IsExpired() || expiring.IsExpired() || kept.IsExpired() {
+		t.Fatal("Only the expired message MUST be expired")
+	}
+
+	count, err := store.MessageCount(chatstore.MessageQuery().SetChatID(chat.ID()))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("Expected 2 visible messages, got %d", count)
+	}
+
+	count, err = store.MessageCount(chatstore.MessageQuery().SetChatID(chat.ID()).SetWithExpired(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 3 {
+		t.Fatalf("Expected 3 messages with the expired, got %d", count)
+	}
+
+	purged, err := store.MessagePurgeExpired(time.Now())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if purged != 1 {
+		t.Fatalf("Expected 1 purged message, got %d", purged)
+	}
+
+	count, err = store.MessageCount(chatstore.MessageQuery().SetChatID(chat.ID()).SetWithExpired(true))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 2 {
+		t.Fatalf("Expected 2 messages after the purge, got %d", count)
+	}
+
+	// Later the expiring message is purged as well
+	purged, err = store.MessagePurgeExpired(time.Now().Add(2 * time.Hour))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if purged != 1 {
+		t.Fatalf("Expected 1 purged message, got %d", purged)
+	}
+
+	storedChat, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if storedChat.MessageCount() != 1 {
+		t.Fatalf("Expected message count 1, got %d", storedChat.MessageCount())
+	}
+}
+
+func TestScheduler_RunOnce(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	scheduled := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetText("Reminder").
+		SetScheduledAt(carbon.Now(carbon.UTC).AddMinutes(5).ToDateTimeString())
+
+	expiring := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(testUser_O1).
+		SetText("Disappearing").
+		SetExpiresAt(carbon.Now(carbon.UTC).AddMinutes(5).ToDateTimeString())
+
+	for _, message := range []chatstore.MessageInterface{scheduled, expiring} {
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	notified := []string{}
+	scheduler, err := chatstore.NewScheduler(chatstore.NewSchedulerOptions{
+		Store: store,
+		OnPublish: func(message chatstore.MessageInterface) {
+			notified = append(notified, message.ID())
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	published, purged, err := scheduler.RunOnce(time.Now().Add(10 * time.Minute))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if published != 1 || purged != 1 {
+		t.Fatalf("Expected 1 published and 1 purged message, got %d and %d", published, purged)
+	}
+
+	if len(notified) != 1 || notified[0] != scheduled.ID() {
+		t.Fatalf("Expected %s to be notified, got %v", scheduled.ID(), notified)
+	}
+
+	if _, err := chatstore.NewScheduler(chatstore.NewSchedulerOptions{}); err == nil {
+		t.Fatal("Expected an error without a store")
+	}
+}
+
+func TestStore_MessageScheduleLocalTime(t *testing.T) {
+	// The times are compared in UTC, whatever the local time zone
+	local := time.Local
+	time.Local = time.FixedZone("UTC+9", 9*60*60)
+	defer func() { time.Local = local }()
+
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	scheduled := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Later").
+		SetScheduledAt(carbon.Now(carbon.UTC).AddMinutes(30).ToDateTimeString())
+	if err := store.MessageCreate(scheduled); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	expiring := chatstore.NewMessage().
+		SetChatID(chat.ID()).
+		SetSenderID(testUser_O1).
+		SetText("Soon gone").
+		SetExpiresAt(carbon.Now(carbon.UTC).AddMinutes(30).ToDateTimeString())
+	if err := store.MessageCreate(expiring); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	published, err := store.MessagePublishDue(time.Now())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(published) != 0 {
+		t.Fatalf("Expected no message due yet, got %d", len(published))
+	}
+
+	found, err := store.MessageFindByID(expiring.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("Expected the message not to be expired yet")
+	}
+
+	purged, err := store.MessagePurgeExpired(time.Now())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if purged != 0 {
+		t.Fatalf("Expected no message purged yet, got %d", purged)
+	}
+
+	published, err = store.MessagePublishDue(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(published) != 1 {
+		t.Fatalf("Expected 1 published message, got %d", len(published))
+	}
+}
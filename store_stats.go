@@ -0,0 +1,273 @@
+package chatstore
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+)
+
+// == STATS ===================================================================
+
+// MessageVolume holds the number of messages in a stats period, optionally
+// for a single chat or sender
+type MessageVolume struct {
+	// Period is the start of the period, "2006-01-02" for days and weeks
+	// (the Monday starting the week) and "2006-01" for months
+	Period string
+	// Key is the chat ID or sender ID the messages are grouped by, empty when not grouped
+	Key string
+	// Count is the number of messages
+	Count int64
+}
+
+// SenderCount holds the number of messages sent by a sender
+type SenderCount struct {
+	SenderID string
+	Count    int64
+}
+
+// StatsMessageVolume counts the messages matching the query per period (day,
+// week or month), and per chat or sender when groupBy is COLUMN_CHAT_ID or
+// COLUMN_SENDER_ID. The volumes are ordered by period and key.
+func (st *storeImplementation) StatsMessageVolume(query MessageQueryInterface, period string, groupBy string) ([]MessageVolume, error) {
+	if query == nil {
+		return nil, errors.New("query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := st.messageQueryEncryptionCheck(query); err != nil {
+		return nil, err
+	}
+
+	if groupBy != "" && groupBy != COLUMN_CHAT_ID && groupBy != COLUMN_SENDER_ID {
+		return nil, errors.New("stats group by must be chat_id, sender_id or empty")
+	}
+
+	bucket, err := st.dateBucketSQL(COLUMN_CREATED_AT, period)
+	if err != nil {
+		return nil, err
+	}
+
+	type volumeRow struct {
+		Period string `db:"stats_period"`
+		Key    string `db:"stats_key"`
+		Count  int64  `db:"stats_count"`
+	}
+
+	selects := bucket + " AS stats_period, COUNT(*) AS stats_count"
+	groups := []string{"stats_period"}
+	if groupBy != "" {
+		selects += ", " + groupBy + " AS stats_key"
+		groups = append(groups, "stats_key")
+	}
+
+	q := st.buildMessageQueryFilters(query).
+		Table(st.tableMessage).
+		Select(selects)
+
+	for _, group := range groups {
+		q = q.Group(group).OrderBy(group)
+	}
+
+	var rows []volumeRow
+	if err := q.Get(&rows); err != nil {
+		return nil, err
+	}
+
+	volumes := make([]MessageVolume, 0, len(rows))
+	for _, r := range rows {
+		volumes = append(volumes, MessageVolume{Period: r.Period, Key: r.Key, Count: r.Count})
+	}
+
+	return volumes, nil
+}
+
+// StatsActiveChats counts the chats with at least one message matching the
+// query, e.g. sent within a period set with SetCreatedAtGte and SetCreatedAtLte.
+func (st *storeImplementation) StatsActiveChats(query MessageQueryInterface) (int64, error) {
+	if query == nil {
+		return 0, errors.New("query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+
+	if err := st.messageQueryEncryptionCheck(query); err != nil {
+		return 0, err
+	}
+
+	type activeRow struct {
+		Count int64 `db:"stats_count"`
+	}
+
+	var rows []activeRow
+	err := st.buildMessageQueryFilters(query).
+		Table(st.tableMessage).
+		Select("COUNT(DISTINCT " + COLUMN_CHAT_ID + ") AS stats_count").
+		Get(&rows)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(rows) == 0 {
+		return 0, nil
+	}
+
+	return rows[0].Count, nil
+}
+
+// StatsMedianResponseTime returns the median time between a reply matching
+// the query and the message it replies to, a reply being the next message in
+// the same chat sent by another participant. The message replied to need not
+// match the query. Zero is returned when there are no replies.
+// The database pairs and sorts the replies of all the matching messages and
+// only the middle ones are loaded, still narrow the query (e.g. with a date
+// range or chats) on large stores.
+func (st *storeImplementation) StatsMedianResponseTime(query MessageQueryInterface) (time.Duration, error) {
+	if query == nil {
+		return 0, errors.New("query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return 0, err
+	}
+
+	if err := st.messageQueryEncryptionCheck(query); err != nil {
+		return 0, err
+	}
+
+	seconds, err := st.secondsBetweenSQL("stats_previous_at", "stats_created_at")
+	if err != nil {
+		return 0, err
+	}
+
+	window := " OVER (PARTITION BY " + COLUMN_CHAT_ID + " ORDER BY " + COLUMN_CREATED_AT + ", " + COLUMN_ID + ")"
+
+	// The message before each one is taken from all the messages of its
+	// chat, whether it matches the query or not, so only the chats of the
+	// query narrow them
+	chatQuery := MessageQuery()
+	if query.IsChatIDSet() {
+		chatQuery.SetChatID(query.GetChatID())
+	}
+	if query.IsChatIDInSet() {
+		chatQuery.SetChatIDIn(query.GetChatIDIn())
+	}
+
+	// The replies are the messages matching the query which follow a
+	// message of another sender. The query filters the messages with the
+	// message before each, aliased as the message table
+	replies := func() contractsorm.Query {
+		messages := st.buildMessageQueryFilters(chatQuery).
+			Table(st.tableMessage).
+			Select(st.tableMessage + ".*" +
+				", COALESCE(" + COLUMN_SENDER_ID + ", '') AS stats_sender_id" +
+				", " + COLUMN_CREATED_AT + " AS stats_created_at" +
+				", COALESCE(LAG(" + COLUMN_SENDER_ID + ")" + window + ", '') AS stats_previous_sender_id" +
+				", LAG(" + COLUMN_CREATED_AT + ")" + window + " AS stats_previous_at")
+
+		return st.buildMessageQueryFilters(query).
+			Table("(?) AS "+st.tableMessage, func(contractsorm.Query) contractsorm.Query { return messages }).
+			Where("(stats_previous_at IS NOT NULL)").
+			Where("stats_previous_sender_id <> stats_sender_id")
+	}
+
+	var count int64
+	if err := replies().Count(&count); err != nil {
+		return 0, err
+	}
+
+	if count == 0 {
+		return 0, nil
+	}
+
+	// The middle reply, or the two middle replies of an even count
+	type replyRow struct {
+		Seconds int64 `db:"stats_seconds"`
+	}
+
+	var rows []replyRow
+	err = replies().
+		Select(seconds + " AS stats_seconds").
+		OrderBy("stats_seconds").
+		Offset(int((count - 1) / 2)).
+		Limit(int(2 - count%2)).
+		Get(&rows)
+	if err != nil {
+		return 0, err
+	}
+
+	responseTimes := make([]time.Duration, 0, len(rows))
+	for _, r := range rows {
+		responseTimes = append(responseTimes, time.Duration(r.Seconds)*time.Second)
+	}
+
+	return medianDuration(responseTimes), nil
+}
+
+// StatsTopSenders returns the senders with the most messages matching the
+// query, busiest first, limited to the given number of senders.
+func (st *storeImplementation) StatsTopSenders(query MessageQueryInterface, limit int) ([]SenderCount, error) {
+	if query == nil {
+		return nil, errors.New("query is nil")
+	}
+
+	if err := query.Validate(); err != nil {
+		return nil, err
+	}
+
+	if err := st.messageQueryEncryptionCheck(query); err != nil {
+		return nil, err
+	}
+
+	if limit < 1 {
+		return nil, errors.New("stats limit must be positive")
+	}
+
+	type senderRow struct {
+		SenderID string `db:"sender_id"`
+		Count    int64  `db:"stats_count"`
+	}
+
+	var rows []senderRow
+	err := st.buildMessageQueryFilters(query).
+		Table(st.tableMessage).
+		Select(COLUMN_SENDER_ID+", COUNT(*) AS stats_count").
+		Group(COLUMN_SENDER_ID).
+		OrderBy("stats_count", "desc").
+		OrderBy(COLUMN_SENDER_ID).
+		Limit(limit).
+		Get(&rows)
+	if err != nil {
+		return nil, err
+	}
+
+	senders := make([]SenderCount, 0, len(rows))
+	for _, r := range rows {
+		senders = append(senders, SenderCount{SenderID: r.SenderID, Count: r.Count})
+	}
+
+	return senders, nil
+}
+
+// medianDuration returns the median of the durations, zero when there are none.
+func medianDuration(durations []time.Duration) time.Duration {
+	if len(durations) == 0 {
+		return 0
+	}
+
+	slices.Sort(durations)
+
+	middle := len(durations) / 2
+	if len(durations)%2 == 1 {
+		return durations[middle]
+	}
+
+	return (durations[middle-1] + durations[middle]) / 2
+}
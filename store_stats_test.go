@@ -0,0 +1,199 @@
+package chatstore_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_Stats(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat_table",
+		TableMessageName:   "message_table",
+		AutomigrateEnabled: true,
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	const testChat_O2 = "00000000000000000000000000000020"
+
+	messages := []struct {
+		chatID    string
+		senderID  string
+		createdAt string
+	}{
+		// Monday 3 March 2025
+		{testChat_O1, testUser_O1, "2025-03-03 10:00:00"},
+		{testChat_O1, testUser_O2, "2025-03-03 10:02:00"},
+		{testChat_O1, testUser_O2, "2025-03-03 10:03:00"},
+		{testChat_O1, testUser_O1, "2025-03-03 10:07:00"},
+		// Sunday 9 March 2025, same week
+		{testChat_O2, testUser_O1, "2025-03-09 12:00:00"},
+		{testChat_O2, testUser_O2, "2025-03-09 12:10:00"},
+		// Tuesday 1 April 2025
+		{testChat_O2, testUser_O1, "2025-04-01 09:00:00"},
+	}
+
+	// Create stamps the current time, so the creation times are backdated after
+	for _, m := range messages {
+		message := chatstore.NewMessage().SetChatID(m.chatID).SetSenderID(m.senderID).SetText("Message")
+		if err := store.MessageCreate(message); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		_, err := db.Exec("UPDATE message_table SET created_at = ? WHERE id = ?", m.createdAt, message.ID())
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	t.Run("volume per period", func(t *testing.T) {
+		testCases := []struct {
+			period   string
+			expected []chatstore.MessageVolume
+		}{
+			{chatstore.STATS_PERIOD_DAY, []chatstore.MessageVolume{
+				{Period: "2025-03-03", Count: 4},
+				{Period: "2025-03-09", Count: 2},
+				{Period: "2025-04-01", Count: 1},
+			}},
+			{chatstore.STATS_PERIOD_WEEK, []chatstore.MessageVolume{
+				{Period: "2025-03-03", Count: 6},
+				{Period: "2025-03-31", Count: 1},
+			}},
+			{chatstore.STATS_PERIOD_MONTH, []chatstore.MessageVolume{
+				{Period: "2025-03", Count: 6},
+				{Period: "2025-04", Count: 1},
+			}},
+		}
+
+		for _, tc := range testCases {
+			volumes, err := store.StatsMessageVolume(chatstore.MessageQuery(), tc.period, "")
+			if err != nil {
+				t.Fatalf("%s: unexpected error: %v", tc.period, err)
+			}
+
+			if len(volumes) != len(tc.expected) {
+				t.Fatalf("%s: expected %v, got %v", tc.period, tc.expected, volumes)
+			}
+
+			for i := range volumes {
+				if volumes[i] != tc.expected[i] {
+					t.Fatalf("%s: expected %v, got %v", tc.period, tc.expected, volumes)
+				}
+			}
+		}
+	})
+
+	t.Run("volume per sender", func(t *testing.T) {
+		volumes, err := store.StatsMessageVolume(chatstore.MessageQuery().SetChatID(testChat_O1), chatstore.STATS_PERIOD_MONTH, chatstore.COLUMN_SENDER_ID)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		expected := []chatstore.MessageVolume{
+			{Period: "2025-03", Key: testUser_O1, Count: 2},
+			{Period: "2025-03", Key: testUser_O2, Count: 2},
+		}
+
+		if len(volumes) != len(expected) || volumes[0] != expected[0] || volumes[1] != expected[1] {
+			t.Fatalf("expected %v, got %v", expected, volumes)
+		}
+
+		_, err = store.StatsMessageVolume(chatstore.MessageQuery(), "year", "")
+		if err == nil {
+			t.Fatal("expected error for unsupported period")
+		}
+	})
+
+	t.Run("active chats", func(t *testing.T) {
+		count, err := store.StatsActiveChats(chatstore.MessageQuery().SetCreatedAtGte("2025-03-05 00:00:00"))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if count != 1 {
+			t.Fatal("expected 1 active chat, got", count)
+		}
+	})
+
+	t.Run("median response time", func(t *testing.T) {
+		// Replies in March after 2, 4 and 10 minutes, the second message in a row is not a reply
+		median, err := store.StatsMedianResponseTime(chatstore.MessageQuery().SetCreatedAtLte("2025-03-31 00:00:00"))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if median != 4*time.Minute {
+			t.Fatal("expected a median of 4 minutes, got", median)
+		}
+	})
+
+	t.Run("median response time of a sender", func(t *testing.T) {
+		// The replies of the second user after 2 and 10 minutes, measured from
+		// the messages of the first user left out by the query
+		median, err := store.StatsMedianResponseTime(chatstore.MessageQuery().
+			SetSenderID(testUser_O2).
+			SetCreatedAtLte("2025-03-31 00:00:00"))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if median != 6*time.Minute {
+			t.Fatal("expected a median of 6 minutes, got", median)
+		}
+	})
+
+	t.Run("median response time per chat", func(t *testing.T) {
+		testCases := []struct {
+			chatID   string
+			expected time.Duration
+		}{
+			// The median of the replies after 2 and 4 minutes
+			{testChat_O1, 3 * time.Minute},
+			// The reply in April is left out by the date range
+			{testChat_O2, 10 * time.Minute},
+		}
+
+		for _, tc := range testCases {
+			median, err := store.StatsMedianResponseTime(chatstore.MessageQuery().
+				SetChatID(tc.chatID).
+				SetCreatedAtLte("2025-03-31 00:00:00"))
+			if err != nil {
+				t.Fatal("unexpected error:", err)
+			}
+
+			if median != tc.expected {
+				t.Fatalf("expected a median of %s in chat %s, got %s", tc.expected, tc.chatID, median)
+			}
+		}
+
+		median, err := store.StatsMedianResponseTime(chatstore.MessageQuery().SetCreatedAtGte("2026-01-01 00:00:00"))
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if median != 0 {
+			t.Fatal("expected no median without replies, got", median)
+		}
+	})
+
+	t.Run("top senders", func(t *testing.T) {
+		senders, err := store.StatsTopSenders(chatstore.MessageQuery(), 1)
+		if err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+
+		if len(senders) != 1 || senders[0].SenderID != testUser_O1 || senders[0].Count != 4 {
+			t.Fatal("expected the first user with 4 messages, got", senders)
+		}
+	})
+}
@@ -0,0 +1,45 @@
+package chatstore
+
+import contractsorm "github.com/dracory/neat/contracts/database/orm"
+
+// == STATUSES ================================================================
+
+// ChatStatusMachine returns the allowed chat statuses and transitions.
+func (st *storeImplementation) ChatStatusMachine() *StatusMachine {
+	return st.chatStatusMachine
+}
+
+// MessageStatusMachine returns the allowed message statuses and transitions.
+func (st *storeImplementation) MessageStatusMachine() *StatusMachine {
+	return st.messageStatusMachine
+}
+
+// statusTransitionCheck checks that the stored record may move to the status.
+// It returns ErrNotFound when the record does not exist, and ErrStaleEntity
+// when it was modified since it was loaded at the version, as its stored
+// status may no longer be the one the change was made from.
+func (st *storeImplementation) statusTransitionCheck(q contractsorm.Query, table string, machine *StatusMachine, id string, version int64, status string) error {
+	type statusRow struct {
+		Status  string `db:"status"`
+		Version int64  `db:"version"`
+	}
+
+	var rows []statusRow
+	err := st.tenantScope(q.Table(table)).
+		Select(COLUMN_STATUS+", "+COLUMN_VERSION).
+		Where(COLUMN_ID+" = ?", id).
+		Get(&rows)
+	if err != nil {
+		return err
+	}
+
+	if len(rows) == 0 {
+		return ErrNotFound
+	}
+
+	if rows[0].Version != version {
+		return ErrStaleEntity
+	}
+
+	return machine.ValidateTransition(rows[0].Status, status)
+}
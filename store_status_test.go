@@ -0,0 +1,194 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_ChatStatusValidation(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	typo := chatstore.NewChat().SetOwnerID(testUser_O1).SetStatus("actve")
+	if err := store.ChatCreate(typo); !errors.Is(err, chatstore.ErrInvalidStatus) {
+		t.Fatal("Expected ErrInvalidStatus, got", err)
+	}
+
+	// A custom status which only an active chat may move to
+	err = store.ChatStatusMachine().RegisterStatus("archived")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatStatusMachine().AllowTransition(chatstore.CHAT_STATUS_ACTIVE, "archived")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1).SetStatus(chatstore.CHAT_STATUS_INACTIVE)
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat.SetStatus("archived")
+	if err := store.ChatUpdate(chat); !errors.Is(err, chatstore.ErrInvalidStatusTransition) {
+		t.Fatal("Expected ErrInvalidStatusTransition, got", err)
+	}
+
+	chat.SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+	if err := store.ChatUpdate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat.SetStatus("archived")
+	if err := store.ChatUpdate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Status() != "archived" {
+		t.Fatal("Expected the archived status, got", found.Status())
+	}
+}
+
+func TestStore_MessageStatusValidation(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	typo := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetStatus("actve").SetText("Hi")
+	if err := store.MessageCreate(typo); !errors.Is(err, chatstore.ErrInvalidStatus) {
+		t.Fatal("Expected ErrInvalidStatus, got", err)
+	}
+
+	// A custom status for messages held for moderation
+	machine := store.MessageStatusMachine()
+	if err := machine.RegisterStatus("pending_review"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = machine.AllowTransition("pending_review", chatstore.MESSAGE_STATUS_ACTIVE, chatstore.MESSAGE_STATUS_DELETED)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetStatus("pending_review").SetText("Hi")
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message.SetStatus(chatstore.MESSAGE_STATUS_ACTIVE)
+	if err := store.MessageUpdate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message.SetStatus("pending_review")
+	if err := store.MessageUpdate(message); !errors.Is(err, chatstore.ErrInvalidStatusTransition) {
+		t.Fatal("Expected ErrInvalidStatusTransition, got", err)
+	}
+
+	// A status check on a missing message
+	missing := chatstore.NewMessage().SetChatID(testChat_O1).SetSenderID(testUser_O1).SetText("Hi")
+	missing.SetStatus(chatstore.MESSAGE_STATUS_INACTIVE)
+	if err := store.MessageUpdate(missing); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+}
+
+func TestStore_StatusTransitionOnUpsert(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// An archived chat may not be reopened
+	if err := store.ChatStatusMachine().RegisterStatus("archived"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := store.ChatStatusMachine().AllowTransition(chatstore.CHAT_STATUS_ACTIVE, "archived"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1).SetStatus("archived")
+	if err := store.ChatUpsert(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat.SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+	if err := store.ChatUpsert(chat); !errors.Is(err, chatstore.ErrInvalidStatusTransition) {
+		t.Fatal("Expected ErrInvalidStatusTransition, got", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(chat.ID()).SetSenderID(testUser_O1).SetText("Hi")
+	if err := store.MessageUpsert(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message.SetStatus(chatstore.MESSAGE_STATUS_SCHEDULED).SetScheduledAt("2099-01-01 00:00:00")
+	if err := store.MessageUpsert(message); !errors.Is(err, chatstore.ErrInvalidStatusTransition) {
+		t.Fatal("Expected ErrInvalidStatusTransition, got", err)
+	}
+}
+
+func TestStore_StatusRepair(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	options := chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+	}
+
+	// A chat stored with a status the store no longer registers
+	legacy, err := chatstore.NewStore(options)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := legacy.ChatStatusMachine().RegisterStatus("actve"); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1).SetStatus("actve")
+	if err := legacy.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(options)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found.SetStatus(chatstore.CHAT_STATUS_ACTIVE)
+	if err := store.ChatUpdate(found); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = store.ChatFindByID(chat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.Status() != chatstore.CHAT_STATUS_ACTIVE {
+		t.Fatal("Expected the status to be repaired, got", found.Status())
+	}
+}
@@ -0,0 +1,117 @@
+package chatstore
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+)
+
+// == TENANTS =================================================================
+
+// ForTenant returns a view of the store scoped to the tenant. The chats and
+// messages created through the view belong to the tenant, and the view only
+// finds, lists, counts, changes and deletes the chats and messages of the
+// tenant. A tenant view cannot be scoped to another tenant.
+func (st *storeImplementation) ForTenant(tenantID string) (StoreInterface, error) {
+	if tenantID == "" {
+		return nil, errors.New("tenant ID is required")
+	}
+
+	if len(tenantID) > MAX_LENGTH_TENANT_ID {
+		return nil, fmt.Errorf("tenant ID must be at most %d characters", MAX_LENGTH_TENANT_ID)
+	}
+
+	// The tenant prefixes the direct keys of its chats
+	if strings.ContainsAny(tenantID, directKeySeparators) {
+		return nil, errors.New("tenant ID must not contain a colon or a slash")
+	}
+
+	if st.tenantID != "" && st.tenantID != tenantID {
+		return nil, errors.New("chat store: the store is scoped to another tenant")
+	}
+
+	view := *st
+	view.tenantID = tenantID
+	return &view, nil
+}
+
+// TenantID returns the ID of the tenant the store is scoped to, empty
+// when the store is not a tenant view.
+func (st *storeImplementation) TenantID() string {
+	return st.tenantID
+}
+
+// tenantScope narrows the chat or message table query to the rows of the
+// tenant of the view.
+func (st *storeImplementation) tenantScope(q contractsorm.Query) contractsorm.Query {
+	if st.tenantID == "" {
+		return q
+	}
+	return q.Where(COLUMN_TENANT_ID+" = ?", st.tenantID)
+}
+
+// tenantChatCheck returns ErrNotFound when the chat is not one of the
+// tenant of the view. Outside of a tenant view any chat is accepted.
+func (st *storeImplementation) tenantChatCheck(q contractsorm.Query, chatID string) error {
+	if st.tenantID == "" {
+		return nil
+	}
+
+	var count int64
+	err := st.tenantScope(txQuery(q).Table(st.tableChat)).Where(COLUMN_ID+" = ?", chatID).Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// tenantMessageCheck returns ErrNotFound when the message is not one of
+// the tenant of the view, guarding the tables related to the messages.
+// Outside of a tenant view any message is accepted.
+func (st *storeImplementation) tenantMessageCheck(messageID string) error {
+	if st.tenantID == "" {
+		return nil
+	}
+	return st.messageExists(messageID)
+}
+
+// tenantIDConflict returns ErrNotFound when a record with the ID exists
+// in the table outside of the tenant of the view, so that an upsert does
+// not take over the record of another tenant.
+func (st *storeImplementation) tenantIDConflict(table string, id string) error {
+	if st.tenantID == "" {
+		return nil
+	}
+
+	var count int64
+	err := st.db.Query().Table(table).
+		Where(COLUMN_ID+" = ?", id).
+		Where("("+COLUMN_TENANT_ID+" IS NULL OR "+COLUMN_TENANT_ID+" <> ?)", st.tenantID).
+		Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// tenantDirectKey returns the direct key of the one-to-one chat between
+// the users, prefixed with the tenant of the view, so that the same users
+// have a direct chat in each of their tenants.
+func (st *storeImplementation) tenantDirectKey(userA string, userB string) string {
+	if st.tenantID == "" {
+		return DirectChatKey(userA, userB)
+	}
+	return st.tenantID + "/" + DirectChatKey(userA, userB)
+}
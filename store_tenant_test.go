@@ -0,0 +1,362 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_ForTenant(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if _, err := store.ForTenant(""); err == nil {
+		t.Fatal("Expected an error for an empty tenant ID")
+	}
+
+	if _, err := store.ForTenant("acme:east"); err == nil {
+		t.Fatal("Expected an error for a tenant ID with a colon")
+	}
+
+	acme, err := store.ForTenant("acme")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if acme.TenantID() != "acme" {
+		t.Fatal("Expected the acme tenant, got", acme.TenantID())
+	}
+
+	if store.TenantID() != "" {
+		t.Fatal("Expected the root store to be unscoped, got", store.TenantID())
+	}
+
+	if _, err := acme.ForTenant("globex"); err == nil {
+		t.Fatal("Expected an error scoping a tenant view to another tenant")
+	}
+
+	same, err := acme.ForTenant("acme")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if same.TenantID() != "acme" {
+		t.Fatal("Expected the acme tenant, got", same.TenantID())
+	}
+}
+
+func TestStore_TenantIsolation(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acme, err := store.ForTenant("acme")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globex, err := store.ForTenant("globex")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acmeChat := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle("Acme")
+	if err := acme.ChatCreate(acmeChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if acmeChat.TenantID() != "acme" {
+		t.Fatal("Expected the chat to belong to acme, got", acmeChat.TenantID())
+	}
+
+	globexChat := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle("Globex")
+	if err := globex.ChatCreate(globexChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acmeMessage := chatstore.NewMessage().SetChatID(acmeChat.ID()).SetSenderID(testUser_O1).SetText("Hello acme")
+	if err := acme.MessageCreate(acmeMessage); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A message cannot be created in the chat of another tenant
+	intruder := chatstore.NewMessage().SetChatID(acmeChat.ID()).SetSenderID(testUser_O2).SetText("Hello")
+	if err := globex.MessageCreate(intruder); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	chats, err := globex.ChatList(chatstore.ChatQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if len(chats) != 1 || chats[0].ID() != globexChat.ID() {
+		t.Fatal("Expected only the globex chat, got", len(chats))
+	}
+
+	found, err := globex.ChatFindByID(acmeChat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("Expected the acme chat not to be found by globex")
+	}
+
+	message, err := globex.MessageFindByID(acmeMessage.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if message != nil {
+		t.Fatal("Expected the acme message not to be found by globex")
+	}
+
+	count, err := globex.MessageCount(chatstore.MessageQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if count != 0 {
+		t.Fatal("Expected no globex messages, got", count)
+	}
+
+	acmeChat.SetTitle("Taken over")
+	if err := globex.ChatUpdate(acmeChat); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	if err := globex.ChatMetaSet(acmeChat.ID(), "color", "red"); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	if err := globex.MessageStar(acmeMessage.ID(), testUser_O2); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	if _, err := globex.MessageMentionList(acmeMessage.ID()); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	// An upsert cannot take over the chat of another tenant
+	if err := globex.ChatUpsert(chatstore.NewChat().SetID(acmeChat.ID()).SetOwnerID(testUser_O2)); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	if err := globex.MessageDeleteByID(acmeMessage.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := globex.ChatDeleteByID(acmeChat.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = acme.ChatFindByID(acmeChat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil {
+		t.Fatal("Expected the acme chat to survive the globex delete")
+	}
+
+	if found.Title() != "Acme" {
+		t.Fatal("Expected the acme chat unchanged, got", found.Title())
+	}
+
+	message, err = acme.MessageFindByID(acmeMessage.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if message == nil {
+		t.Fatal("Expected the acme message to survive the globex delete")
+	}
+
+	// The root store sees every tenant
+	all, err := store.ChatCount(chatstore.ChatQuery())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if all != 2 {
+		t.Fatal("Expected 2 chats in the root store, got", all)
+	}
+
+	if err := acme.ChatDeleteByID(acmeChat.ID()); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err = acme.ChatFindByID(acmeChat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found != nil {
+		t.Fatal("Expected the acme chat to be deleted")
+	}
+}
+
+func TestStore_TenantDirectChats(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acme, err := store.ForTenant("acme")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globex, err := store.ForTenant("globex")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acmeChat, created, err := acme.ChatFindOrCreateDirect(testUser_O1, testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !created {
+		t.Fatal("Expected the acme direct chat to be created")
+	}
+
+	globexChat, created, err := globex.ChatFindOrCreateDirect(testUser_O2, testUser_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !created {
+		t.Fatal("Expected the globex direct chat to be created")
+	}
+
+	if acmeChat.ID() == globexChat.ID() {
+		t.Fatal("Expected a direct chat per tenant")
+	}
+
+	again, created, err := acme.ChatFindOrCreateDirect(testUser_O2, testUser_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if created || again.ID() != acmeChat.ID() {
+		t.Fatal("Expected the acme direct chat to be found")
+	}
+}
+
+func TestStore_TenantMessageMove(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acme, err := store.ForTenant("acme")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globex, err := store.ForTenant("globex")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acmeChat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := acme.ChatCreate(acmeChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globexChat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := globex.ChatCreate(globexChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message := chatstore.NewMessage().SetChatID(acmeChat.ID()).SetSenderID(testUser_O1).SetText("Hello")
+	if err := acme.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// A message cannot be moved to the chat of another tenant
+	message.SetChatID(globexChat.ID())
+	if err := acme.MessageUpdate(message); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	found, err := store.MessageFindByID(message.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found == nil || found.ChatID() != acmeChat.ID() {
+		t.Fatal("Expected the message to stay in the acme chat")
+	}
+}
+
+func TestStore_TenantMessageSoftDelete(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acme, err := store.ForTenant("acme")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globex, err := store.ForTenant("globex")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	acmeChat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := acme.ChatCreate(acmeChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globexChat := chatstore.NewChat().SetOwnerID(testUser_O1)
+	if err := globex.ChatCreate(globexChat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	globexMessage := chatstore.NewMessage().SetChatID(globexChat.ID()).SetSenderID(testUser_O1).SetText("Hello")
+	if err := globex.MessageCreate(globexMessage); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if err := acme.MessageSoftDelete(globexMessage); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound, got", err)
+	}
+
+	acmeMessage := chatstore.NewMessage().SetChatID(acmeChat.ID()).SetSenderID(testUser_O1).SetText("Hello")
+	if err := acme.MessageCreate(acmeMessage); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// The stats of the stored chat are recomputed, not of the chat passed in
+	acmeMessage.SetChatID(globexChat.ID())
+	if err := acme.MessageSoftDelete(acmeMessage); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	found, err := store.ChatFindByID(acmeChat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.MessageCount() != 0 {
+		t.Fatal("Expected the acme chat to count no messages, got", found.MessageCount())
+	}
+
+	found, err = store.ChatFindByID(globexChat.ID())
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if found.MessageCount() != 1 {
+		t.Fatal("Expected the globex chat to count 1 message, got", found.MessageCount())
+	}
+}
@@ -0,0 +1,176 @@
+package chatstore
+
+import (
+	"errors"
+	"slices"
+	"time"
+
+	contractsorm "github.com/dracory/neat/contracts/database/orm"
+	"github.com/dromara/carbon/v2"
+)
+
+// == CHAT USER SETTINGS ======================================================
+
+// ChatUserSettingsFind returns the settings of the chat for the user,
+// the default settings when the user has not changed them.
+func (st *storeImplementation) ChatUserSettingsFind(chatID string, userID string) (ChatUserSettings, error) {
+	if err := st.chatUserSettingsAuthorize(chatID, userID); err != nil {
+		return ChatUserSettings{}, err
+	}
+
+	return st.chatUserSettingsFind(st.db.Query(), chatID, userID)
+}
+
+// ChatUserSettingsSave saves the settings of the chat for the user.
+// It returns ErrNotFound when the chat does not exist.
+func (st *storeImplementation) ChatUserSettingsSave(settings ChatUserSettings) error {
+	if err := st.chatUserSettingsAuthorize(settings.ChatID, settings.UserID); err != nil {
+		return err
+	}
+
+	return st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		return st.chatUserSettingsSave(tx, settings)
+	})
+}
+
+// ChatUserSettingsUpdate changes the settings of the chat for the user with
+// the mutate function, e.g. to archive or mute the chat, and saves them.
+func (st *storeImplementation) ChatUserSettingsUpdate(chatID string, userID string, mutate func(settings *ChatUserSettings)) error {
+	if mutate == nil {
+		return errors.New("mutate function is nil")
+	}
+
+	if err := st.chatUserSettingsAuthorize(chatID, userID); err != nil {
+		return err
+	}
+
+	return st.db.Query().Transaction(func(tx contractsorm.Query) error {
+		settings, err := st.chatUserSettingsFind(tx, chatID, userID)
+		if err != nil {
+			return err
+		}
+
+		mutate(&settings)
+
+		// The chat and user of the settings stay the same
+		settings.ChatID = chatID
+		settings.UserID = userID
+
+		return st.chatUserSettingsSave(tx, settings)
+	})
+}
+
+// chatUserSettingsAuthorize returns ErrForbidden when the principal may not
+// read the chat, or acts on the settings of another user.
+func (st *storeImplementation) chatUserSettingsAuthorize(chatID string, userID string) error {
+	if err := st.userAuthorize(userID); err != nil {
+		return err
+	}
+	return st.chatAuthorize(chatID, ACCESS_ACTION_READ)
+}
+
+// chatUserSettingsFind returns the settings of the chat for the user.
+func (st *storeImplementation) chatUserSettingsFind(q contractsorm.Query, chatID string, userID string) (ChatUserSettings, error) {
+	if chatID == "" {
+		return ChatUserSettings{}, errors.New("chat ID is required")
+	}
+
+	if userID == "" {
+		return ChatUserSettings{}, errors.New("user ID is required")
+	}
+
+	if err := st.tenantChatCheck(q, chatID); err != nil {
+		return ChatUserSettings{}, err
+	}
+
+	type settingsRow struct {
+		Archived          bool      `db:"archived"`
+		Hidden            bool      `db:"hidden"`
+		MutedUntil        time.Time `db:"muted_until"`
+		NotificationLevel string    `db:"notification_level"`
+		CustomTitle       string    `db:"custom_title"`
+	}
+
+	var rows []settingsRow
+	err := txQuery(q).Table(st.tableChatUserSettings).
+		Where(COLUMN_CHAT_ID+" = ?", chatID).
+		Where(COLUMN_USER_ID+" = ?", userID).
+		Limit(1).
+		Get(&rows)
+	if err != nil {
+		return ChatUserSettings{}, err
+	}
+
+	settings := NewChatUserSettings(chatID, userID)
+	if len(rows) == 0 {
+		return settings, nil
+	}
+
+	settings.Archived = rows[0].Archived
+	settings.Hidden = rows[0].Hidden
+	settings.NotificationLevel = rows[0].NotificationLevel
+	settings.CustomTitle = rows[0].CustomTitle
+	if !rows[0].MutedUntil.IsZero() {
+		settings.MutedUntil = carbon.CreateFromStdTime(rows[0].MutedUntil).ToDateTimeString()
+	}
+
+	return settings, nil
+}
+
+// chatUserSettingsSave inserts or updates the settings of the chat for the user.
+func (st *storeImplementation) chatUserSettingsSave(tx contractsorm.Query, settings ChatUserSettings) error {
+	if settings.ChatID == "" {
+		return errors.New("chat ID is required")
+	}
+
+	if settings.UserID == "" {
+		return errors.New("user ID is required")
+	}
+
+	levels := []string{NOTIFICATION_LEVEL_ALL, NOTIFICATION_LEVEL_MENTIONS, NOTIFICATION_LEVEL_NONE}
+	if !slices.Contains(levels, settings.NotificationLevel) {
+		return errors.New("notification level must be one of all, mentions or none")
+	}
+
+	var count int64
+	err := st.tenantScope(txQuery(tx).Table(st.tableChat)).Where(COLUMN_ID+" = ?", settings.ChatID).Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	now := carbon.Now(carbon.UTC).StdTime()
+	row := map[string]any{
+		COLUMN_ARCHIVED:           settings.Archived,
+		COLUMN_HIDDEN:             settings.Hidden,
+		COLUMN_MUTED_UNTIL:        nullIfEmptyTime(settings.MutedUntil),
+		COLUMN_NOTIFICATION_LEVEL: settings.NotificationLevel,
+		COLUMN_CUSTOM_TITLE:       nullIfEmpty(settings.CustomTitle),
+		COLUMN_UPDATED_AT:         now,
+	}
+
+	err = txQuery(tx).Table(st.tableChatUserSettings).
+		Where(COLUMN_CHAT_ID+" = ?", settings.ChatID).
+		Where(COLUMN_USER_ID+" = ?", settings.UserID).
+		Count(&count)
+	if err != nil {
+		return err
+	}
+
+	if count > 0 {
+		_, err := txQuery(tx).Table(st.tableChatUserSettings).
+			Where(COLUMN_CHAT_ID+" = ?", settings.ChatID).
+			Where(COLUMN_USER_ID+" = ?", settings.UserID).
+			Update(row)
+		return err
+	}
+
+	row[COLUMN_CHAT_ID] = settings.ChatID
+	row[COLUMN_USER_ID] = settings.UserID
+	row[COLUMN_CREATED_AT] = now
+
+	return txQuery(tx).Table(st.tableChatUserSettings).Create(row)
+}
@@ -0,0 +1,151 @@
+package chatstore_test
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/dracory/chatstore"
+	"github.com/dromara/carbon/v2"
+)
+
+func TestStore_ChatUserSettings(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	chat := chatstore.NewChat().
+		SetOwnerID(testUser_O1).
+		SetStatus(chatstore.CHAT_STATUS_ACTIVE).
+		SetTitle("Team")
+
+	if err := store.ChatCreate(chat); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// Defaults until changed
+	settings, err := store.ChatUserSettingsFind(chat.ID(), testUser_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if settings.Archived || settings.Hidden || settings.IsMuted() || settings.NotificationLevel != chatstore.NOTIFICATION_LEVEL_ALL {
+		t.Fatalf("Unexpected default settings: %+v", settings)
+	}
+
+	settings.NotificationLevel = chatstore.NOTIFICATION_LEVEL_MENTIONS
+	settings.CustomTitle = "My team"
+	settings.MutedUntil = carbon.Now(carbon.UTC).AddHour().ToDateTimeString()
+
+	if err := store.ChatUserSettingsSave(settings); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatUserSettingsUpdate(chat.ID(), testUser_O1, func(settings *chatstore.ChatUserSettings) {
+		settings.Archived = true
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	saved, err := store.ChatUserSettingsFind(chat.ID(), testUser_O1)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if !saved.Archived || !saved.IsMuted() || saved.NotificationLevel != chatstore.NOTIFICATION_LEVEL_MENTIONS || saved.CustomTitle != "My team" {
+		t.Fatalf("Unexpected saved settings: %+v", saved)
+	}
+
+	if saved.MutedUntil != settings.MutedUntil {
+		t.Fatalf("Expected muted until %s, got %s", settings.MutedUntil, saved.MutedUntil)
+	}
+
+	// The settings of the other user are unchanged
+	other, err := store.ChatUserSettingsFind(chat.ID(), testUser_O2)
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	if other.Archived {
+		t.Fatal("Chat MUST NOT be archived for the other user")
+	}
+
+	settings.NotificationLevel = "sometimes"
+	if err := store.ChatUserSettingsSave(settings); err == nil {
+		t.Fatal("Expected an error for an unknown notification level")
+	}
+
+	if err := store.ChatUserSettingsSave(chatstore.NewChatUserSettings("missing", testUser_O1)); !errors.Is(err, chatstore.ErrNotFound) {
+		t.Fatalf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestStore_ChatListUserSettingsFilters(t *testing.T) {
+	store, err := initStore(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	archived := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle("Archived")
+	hidden := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle("Hidden")
+	inbox := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle("Inbox")
+
+	for _, chat := range []chatstore.ChatInterface{archived, hidden, inbox} {
+		if err := store.ChatCreate(chat); err != nil {
+			t.Fatal("unexpected error:", err)
+		}
+	}
+
+	err = store.ChatUserSettingsUpdate(archived.ID(), testUser_O1, func(settings *chatstore.ChatUserSettings) {
+		settings.Archived = true
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	err = store.ChatUserSettingsUpdate(hidden.ID(), testUser_O1, func(settings *chatstore.ChatUserSettings) {
+		settings.Hidden = true
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	testCases := []struct {
+		name     string
+		query    chatstore.ChatQueryInterface
+		expected []string
+	}{
+		{"inbox", chatstore.ChatQuery().SetSettingsUserID(testUser_O1).SetArchived(false).SetHidden(false), []string{inbox.ID()}},
+		{"archived", chatstore.ChatQuery().SetSettingsUserID(testUser_O1).SetArchived(true), []string{archived.ID()}},
+		{"hidden", chatstore.ChatQuery().SetSettingsUserID(testUser_O1).SetHidden(true), []string{hidden.ID()}},
+		{"not hidden", chatstore.ChatQuery().SetSettingsUserID(testUser_O1).SetHidden(false), []string{archived.ID(), inbox.ID()}},
+		{"other user", chatstore.ChatQuery().SetSettingsUserID(testUser_O2).SetArchived(false).SetHidden(false), []string{archived.ID(), hidden.ID(), inbox.ID()}},
+	}
+
+	for _, tc := range testCases {
+		chats, err := store.ChatList(tc.query.SetOrderBy(chatstore.COLUMN_TITLE).SetOrderDirection("asc"))
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", tc.name, err)
+		}
+
+		ids := []string{}
+		for _, chat := range chats {
+			ids = append(ids, chat.ID())
+		}
+
+		if len(ids) != len(tc.expected) {
+			t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, ids)
+		}
+
+		for i := range ids {
+			if ids[i] != tc.expected[i] {
+				t.Fatalf("%s: expected %v, got %v", tc.name, tc.expected, ids)
+			}
+		}
+	}
+
+	if err := chatstore.ChatQuery().SetArchived(true).Validate(); err == nil {
+		t.Fatal("Expected an error without a settings user")
+	}
+}
@@ -0,0 +1,37 @@
+package chatstore
+
+// == VALIDATION ==============================================================
+
+// chatValidate validates the chat, then runs the custom chat validators,
+// returning all the field errors together.
+func (st *storeImplementation) chatValidate(chat ChatInterface) error {
+	errs := ValidationErrors{}
+	if err := errs.add(chat.Validate()); err != nil {
+		return err
+	}
+
+	for _, validator := range st.chatValidators {
+		if err := errs.add(validator(chat)); err != nil {
+			return err
+		}
+	}
+
+	return errs.errorOrNil()
+}
+
+// messageValidate validates the message, then runs the custom message
+// validators, returning all the field errors together.
+func (st *storeImplementation) messageValidate(message MessageInterface) error {
+	errs := ValidationErrors{}
+	if err := errs.add(message.Validate()); err != nil {
+		return err
+	}
+
+	for _, validator := range st.messageValidators {
+		if err := errs.add(validator(message)); err != nil {
+			return err
+		}
+	}
+
+	return errs.errorOrNil()
+}
@@ -0,0 +1,69 @@
+package chatstore_test
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dracory/chatstore"
+)
+
+func TestStore_Validation(t *testing.T) {
+	db, err := initDB(":memory:")
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	store, err := chatstore.NewStore(chatstore.NewStoreOptions{
+		DB:                 db,
+		TableChatName:      "chat",
+		TableMessageName:   "message",
+		AutomigrateEnabled: true,
+		MessageValidators: []chatstore.MessageValidator{
+			func(message chatstore.MessageInterface) error {
+				if strings.TrimSpace(message.Text()) == "" {
+					return chatstore.FieldError{Field: chatstore.COLUMN_TEXT, Message: "is required"}
+				}
+				return nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	// The field errors of the message and of the custom validator together
+	message := chatstore.NewMessage().
+		SetChatID(testChat_O1).
+		SetSenderID(strings.Repeat("x", chatstore.MAX_LENGTH_USER_ID+1)).
+		SetText("  ")
+
+	err = store.MessageCreate(message)
+	if !errors.Is(err, chatstore.ErrValidation) {
+		t.Fatal("expected ErrValidation, got", err)
+	}
+
+	var fieldErrors chatstore.ValidationErrors
+	if !errors.As(err, &fieldErrors) || len(fieldErrors) != 2 {
+		t.Fatal("expected 2 field errors, got", err)
+	}
+
+	if fieldErrors[0].Field != chatstore.COLUMN_SENDER_ID || fieldErrors[1].Field != chatstore.COLUMN_TEXT {
+		t.Fatal("unexpected field errors:", fieldErrors)
+	}
+
+	message.SetSenderID(testUser_O1).SetText("Hello")
+	if err := store.MessageCreate(message); err != nil {
+		t.Fatal("unexpected error:", err)
+	}
+
+	message.SetText("")
+	if err := store.MessageUpdate(message); !errors.Is(err, chatstore.ErrValidation) {
+		t.Fatal("expected ErrValidation, got", err)
+	}
+
+	chat := chatstore.NewChat().SetOwnerID(testUser_O1).SetTitle(strings.Repeat("x", chatstore.MAX_LENGTH_TITLE+1))
+	if err := store.ChatCreate(chat); !errors.Is(err, chatstore.ErrValidation) {
+		t.Fatal("expected ErrValidation, got", err)
+	}
+}
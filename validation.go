@@ -0,0 +1,89 @@
+package chatstore
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// FieldError is a field of a chat or message which failed validation.
+type FieldError struct {
+	// Field is the column name of the field, e.g. "title"
+	Field   string
+	Message string
+}
+
+// Error returns the field and the reason it failed validation.
+func (e FieldError) Error() string {
+	return e.Field + ": " + e.Message
+}
+
+// ValidationErrors holds all the fields of a chat or message which failed
+// validation. It matches ErrValidation with errors.Is.
+type ValidationErrors []FieldError
+
+// Error returns the failed fields, separated by semicolons.
+func (e ValidationErrors) Error() string {
+	messages := make([]string, 0, len(e))
+	for _, fieldError := range e {
+		messages = append(messages, fieldError.Error())
+	}
+	return ErrValidation.Error() + ": " + strings.Join(messages, "; ")
+}
+
+// Is reports whether the target is ErrValidation.
+func (e ValidationErrors) Is(target error) bool {
+	return target == ErrValidation
+}
+
+// ChatValidator is a custom validation of chats, run by the store after
+// the chat validates itself. Field errors are returned as a FieldError or
+// ValidationErrors, and are added to the field errors of the chat.
+type ChatValidator func(chat ChatInterface) error
+
+// MessageValidator is a custom validation of messages, run by the store
+// after the message validates itself. Field errors are returned as a
+// FieldError or ValidationErrors, and are added to the field errors of the message.
+type MessageValidator func(message MessageInterface) error
+
+// fieldRequired adds a field error when the value is empty.
+func (e *ValidationErrors) fieldRequired(field string, value string) {
+	if value == "" {
+		*e = append(*e, FieldError{Field: field, Message: "is required"})
+	}
+}
+
+// fieldMaxLength adds a field error when the value is longer than the
+// column, counted in characters as by VARCHAR columns.
+func (e *ValidationErrors) fieldMaxLength(field string, value string, max int) {
+	if utf8.RuneCountInString(value) > max {
+		*e = append(*e, FieldError{Field: field, Message: "must be at most " + strconv.Itoa(max) + " characters"})
+	}
+}
+
+// add adds the field errors of the error of a custom validator. Any other
+// error is returned as is.
+func (e *ValidationErrors) add(err error) error {
+	var fieldErrors ValidationErrors
+	if errors.As(err, &fieldErrors) {
+		*e = append(*e, fieldErrors...)
+		return nil
+	}
+
+	var fieldError FieldError
+	if errors.As(err, &fieldError) {
+		*e = append(*e, fieldError)
+		return nil
+	}
+
+	return err
+}
+
+// errorOrNil returns the field errors as an error, nil when there are none.
+func (e ValidationErrors) errorOrNil() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}